@@ -0,0 +1,117 @@
+package bookingperiod
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const dateLayout = `2006-01-02`
+
+// BookingPeriod represents the period of Seller Center transactions booked by one run
+// From is included and To is excluded: From <= created_at < To
+type BookingPeriod struct {
+	From time.Time
+	To   time.Time
+}
+
+// PreviousMonth returns the calendar month before now, the default period of a monthly close
+func PreviousMonth(now time.Time) BookingPeriod {
+	firstDayOfCurrentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return BookingPeriod{
+		From: firstDayOfCurrentMonth.AddDate(0, -1, 0),
+		To:   firstDayOfCurrentMonth,
+	}
+}
+
+// FromMonth returns the calendar month month/year
+func FromMonth(month, year int) (BookingPeriod, error) {
+	if month < 1 || month > 12 {
+		return BookingPeriod{}, fmt.Errorf("invalid month %d: month should be between 1 and 12", month)
+	}
+	if year < 2000 || year > 2100 {
+		return BookingPeriod{}, fmt.Errorf("invalid year %d", year)
+	}
+	from := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	return BookingPeriod{
+		From: from,
+		To:   from.AddDate(0, 1, 0),
+	}, nil
+}
+
+// FromDateRange returns the period from the date from to the date to, both included
+// dates are formatted as YYYY-MM-DD
+func FromDateRange(from, to string) (BookingPeriod, error) {
+	fromDate, err := time.Parse(dateLayout, from)
+	if err != nil {
+		return BookingPeriod{}, fmt.Errorf("invalid from date %q: %v", from, err)
+	}
+	toDate, err := time.Parse(dateLayout, to)
+	if err != nil {
+		return BookingPeriod{}, fmt.Errorf("invalid to date %q: %v", to, err)
+	}
+	if toDate.Before(fromDate) {
+		return BookingPeriod{}, fmt.Errorf("invalid date range: to date %s is before from date %s", to, from)
+	}
+	return BookingPeriod{
+		From: fromDate,
+		To:   toDate.AddDate(0, 0, 1),
+	}, nil
+}
+
+// Parse resolves the booking period from the command line options:
+// - from and to define an explicit date range
+// - month and year define a calendar month
+// - if nothing is provided, the previous month of now is booked
+func Parse(month, year int, from, to string, now time.Time) (BookingPeriod, error) {
+	switch {
+	case from != `` || to != ``:
+		if month != 0 || year != 0 {
+			return BookingPeriod{}, errors.New("choose either month/year or from/to, not both")
+		}
+		if from == `` || to == `` {
+			return BookingPeriod{}, errors.New("both from and to are required for a date range")
+		}
+		return FromDateRange(from, to)
+	case month != 0 || year != 0:
+		if month == 0 || year == 0 {
+			return BookingPeriod{}, errors.New("both month and year are required")
+		}
+		return FromMonth(month, year)
+	default:
+		return PreviousMonth(now), nil
+	}
+}
+
+// IsCalendarMonth is true if bookingPeriod covers exactly one calendar month
+func (bookingPeriod BookingPeriod) IsCalendarMonth() bool {
+	return bookingPeriod.From.Day() == 1 && bookingPeriod.From.AddDate(0, 1, 0).Equal(bookingPeriod.To)
+}
+
+// FromDate returns the first date of bookingPeriod (included) as YYYY-MM-DD
+func (bookingPeriod BookingPeriod) FromDate() string {
+	return bookingPeriod.From.Format(dateLayout)
+}
+
+// ToDate returns the first date after bookingPeriod (excluded) as YYYY-MM-DD
+func (bookingPeriod BookingPeriod) ToDate() string {
+	return bookingPeriod.To.Format(dateLayout)
+}
+
+// Label identifies bookingPeriod in file names and log lines:
+// 2018-04 for a calendar month, 20180401-20180415 for a date range (both dates included)
+func (bookingPeriod BookingPeriod) Label() string {
+	if bookingPeriod.IsCalendarMonth() {
+		return bookingPeriod.From.Format(`2006-01`)
+	}
+	return bookingPeriod.From.Format(`20060102`) + `-` + bookingPeriod.To.AddDate(0, 0, -1).Format(`20060102`)
+}
+
+// FileName stamps the Label of bookingPeriod into fileName:
+// ngsTemplateIpcIptC.csv becomes ngsTemplateIpcIptC_2018-04.csv
+func (bookingPeriod BookingPeriod) FileName(fileName string) string {
+	extension := filepath.Ext(fileName)
+	return strings.TrimSuffix(fileName, extension) + `_` + bookingPeriod.Label() + extension
+}
@@ -0,0 +1,102 @@
+package chartofaccount
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Role of an Account Code in the NGS template
+const (
+	Voucher                       = `voucher`
+	SellerPayable                 = `seller_payable`
+	CommissionRevenue             = `commission_revenue`
+	CommissionVat                 = `commission_vat`
+	ShippingFee                   = `shipping_fee`
+	ShippingFeeVat                = `shipping_fee_vat`
+	CancelPenaltyRevenueWithin24h = `cancel_penalty_wi_24_revenue`
+	CancelPenaltyRevenueAfter24h  = `cancel_penalty_a_24_revenue`
+	CancelPenaltyVat              = `cancel_penalty_vat`
+	ConsignHandlingFee            = `consign_handling_fee`
+	StorageFee                    = `storage_fee`
+	DownPaymentCredit             = `down_payment_credit`
+	LostDamagedCredit             = `lost_damaged_credit`
+	OtherTransactionVat           = `other_transaction_vat`
+	RoundingDifference            = `rounding_difference`
+)
+
+// Role lists every Role referenced by the default posting rules of the NGS template
+var Role = []string{
+	Voucher,
+	SellerPayable,
+	CommissionRevenue,
+	CommissionVat,
+	ShippingFee,
+	ShippingFeeVat,
+	CancelPenaltyRevenueWithin24h,
+	CancelPenaltyRevenueAfter24h,
+	CancelPenaltyVat,
+	ConsignHandlingFee,
+	StorageFee,
+	DownPaymentCredit,
+	LostDamagedCredit,
+	OtherTransactionVat,
+	RoundingDifference,
+}
+
+// ChartOfAccount maps each Role to its Account Code
+type ChartOfAccount map[string]string
+
+// Validate checks that every role of referencedRole (e.g. the roles of the posting rules) has an Account Code:
+// there is no default Account Code, every role must be defined in chart_of_account table of BAA database or on the command line
+// every Account Code must be an integer, since Account Codes are written as is into the SQL of the ledger amount views,
+// and an Account Code of accountMaster, the account master of NGS
+// and that chartOfAccount has no role which is neither referenced nor a role of Role, most likely a typo
+func (chartOfAccount ChartOfAccount) Validate(referencedRole, accountMaster []string) error {
+	invalid := chartOfAccount.Invalid(referencedRole, accountMaster)
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid chart of account: %s", strings.Join(invalid, `; `))
+	}
+	return nil
+}
+
+// Invalid returns why chartOfAccount is invalid for referencedRole and accountMaster, one reason per role, sorted, see Validate
+func (chartOfAccount ChartOfAccount) Invalid(referencedRole, accountMaster []string) (invalid []string) {
+
+	if len(accountMaster) == 0 {
+		invalid = append(invalid, `empty account master: Account Codes cannot be checked`)
+	}
+	isAccount := make(map[string]bool)
+	for _, accountCode := range accountMaster {
+		isAccount[accountCode] = true
+	}
+	isReferenced := make(map[string]bool)
+	for _, role := range referencedRole {
+		isReferenced[role] = true
+		accountCode, ok := chartOfAccount[role]
+		if !ok || accountCode == `` {
+			invalid = append(invalid, fmt.Sprintf("missing Account Code for %s", role))
+			continue
+		}
+		if _, err := strconv.Atoi(accountCode); err != nil {
+			invalid = append(invalid, fmt.Sprintf("invalid Account Code for %s: %q is not an integer", role, accountCode))
+			continue
+		}
+		if len(accountMaster) > 0 && !isAccount[accountCode] {
+			invalid = append(invalid, fmt.Sprintf("invalid Account Code for %s: %s is not in the account master", role, accountCode))
+		}
+	}
+	isRole := make(map[string]bool)
+	for _, role := range Role {
+		isRole[role] = true
+	}
+	for role := range chartOfAccount {
+		if !isReferenced[role] && !isRole[role] {
+			invalid = append(invalid, fmt.Sprintf("unknown role %q", role))
+		}
+	}
+
+	sort.Strings(invalid)
+	return invalid
+}
@@ -8,9 +8,13 @@ import (
 	"time"
 
 	"github.com/gocarina/gocsv"
+	"github.com/thomas-bamilo/financebooking/row/accountrow"
 	"github.com/thomas-bamilo/financebooking/row/beneficiarycoderow"
+	"github.com/thomas-bamilo/financebooking/row/chartofaccountrow"
 	"github.com/thomas-bamilo/financebooking/row/ledgermaprow"
+	"github.com/thomas-bamilo/financebooking/row/quarantinerow"
 	"github.com/thomas-bamilo/financebooking/row/retailshortcoderow"
+	"github.com/thomas-bamilo/financebooking/row/vatraterow"
 )
 
 func ReadBeneficiaryCodeCSV(beneficiaryCodeTableP []*beneficiarycoderow.BeneficiaryCodeRow) (beneficiaryCodeTable []beneficiarycoderow.BeneficiaryCodeRow) {
@@ -98,12 +102,148 @@ func ReadLedgerMapCSV(ledgerMapTableP []*ledgermaprow.LedgerMapRow) (ledgerMapTa
 				ShipmentProviderName: ledgerMapRow.ShipmentProviderName,
 				Ledger:               ledgerMapRow.Ledger,
 				Subledger:            ledgerMapRow.Subledger,
+				Priority:             ledgerMapRow.Priority,
 			})
 	}
 	return ledgerMapTable
 
 }
 
+// ReadLedgerMapTemplateCSV reads ledger_map.csv filled in from the ledger_map template, with the suggested ledger and subledger
+func ReadLedgerMapTemplateCSV(ledgerMapTemplateTableP []*ledgermaprow.LedgerMapTemplateRow) (ledgerMapTemplateTable []ledgermaprow.LedgerMapTemplateRow) {
+
+	ledgerMapFile, err := os.OpenFile("ledger_map.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+	if err != nil {
+		fmt.Printf("FAILURE! %v\n", err)
+		writeErrorToFile(err, `err_open_ledger_map.txt`)
+		time.Sleep(30 * time.Second)
+		log.Fatal(err)
+	}
+	defer ledgerMapFile.Close()
+
+	if err := gocsv.UnmarshalFile(ledgerMapFile, &ledgerMapTemplateTableP); err != nil {
+		fmt.Printf("FAILURE! %v\n", err)
+		writeErrorToFile(err, `err_read_ledger_map.txt`)
+		time.Sleep(30 * time.Second)
+		log.Fatal(err)
+	}
+
+	for _, ledgerMapTemplateRow := range ledgerMapTemplateTableP {
+		ledgerMapTemplateTable = append(ledgerMapTemplateTable, *ledgerMapTemplateRow)
+	}
+	return ledgerMapTemplateTable
+
+}
+
+func ReadVatRateCSV(vatRateTableP []*vatraterow.VatRateRow) (vatRateTable []vatraterow.VatRateRow) {
+
+	vatRateFile, err := os.OpenFile("vat_rate.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+	if err != nil {
+		fmt.Printf("FAILURE! %v\n", err)
+		writeErrorToFile(err, `err_open_vat_rate.txt`)
+		time.Sleep(30 * time.Second)
+		log.Fatal(err)
+	}
+	defer vatRateFile.Close()
+
+	if err := gocsv.UnmarshalFile(vatRateFile, &vatRateTableP); err != nil {
+		fmt.Printf("FAILURE! %v\n", err)
+		writeErrorToFile(err, `err_read_vat_rate.txt`)
+		time.Sleep(30 * time.Second)
+		log.Fatal(err)
+	}
+
+	for _, vatRateRow := range vatRateTableP {
+		vatRateTable = append(vatRateTable,
+			vatraterow.VatRateRow{
+				ValidFrom: vatRateRow.ValidFrom,
+				ValidTo:   vatRateRow.ValidTo,
+				VatRate:   vatRateRow.VatRate,
+			})
+	}
+	return vatRateTable
+
+}
+
+func ReadChartOfAccountCSV(chartOfAccountTableP []*chartofaccountrow.ChartOfAccountRow) (chartOfAccountTable []chartofaccountrow.ChartOfAccountRow) {
+
+	chartOfAccountFile, err := os.OpenFile("chart_of_account.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+	if err != nil {
+		fmt.Printf("FAILURE! %v\n", err)
+		writeErrorToFile(err, `err_open_chart_of_account.txt`)
+		time.Sleep(30 * time.Second)
+		log.Fatal(err)
+	}
+	defer chartOfAccountFile.Close()
+
+	if err := gocsv.UnmarshalFile(chartOfAccountFile, &chartOfAccountTableP); err != nil {
+		fmt.Printf("FAILURE! %v\n", err)
+		writeErrorToFile(err, `err_read_chart_of_account.txt`)
+		time.Sleep(30 * time.Second)
+		log.Fatal(err)
+	}
+
+	for _, chartOfAccountRow := range chartOfAccountTableP {
+		chartOfAccountTable = append(chartOfAccountTable,
+			chartofaccountrow.ChartOfAccountRow{
+				AccountRole: chartOfAccountRow.AccountRole,
+				AccountCode: chartOfAccountRow.AccountCode,
+			})
+	}
+	return chartOfAccountTable
+
+}
+
+func ReadAccountCSV(accountTableP []*accountrow.AccountRow) (accountTable []accountrow.AccountRow) {
+
+	accountFile, err := os.OpenFile("account.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+	if err != nil {
+		fmt.Printf("FAILURE! %v\n", err)
+		writeErrorToFile(err, `err_open_account.txt`)
+		time.Sleep(30 * time.Second)
+		log.Fatal(err)
+	}
+	defer accountFile.Close()
+
+	if err := gocsv.UnmarshalFile(accountFile, &accountTableP); err != nil {
+		fmt.Printf("FAILURE! %v\n", err)
+		writeErrorToFile(err, `err_read_account.txt`)
+		time.Sleep(30 * time.Second)
+		log.Fatal(err)
+	}
+
+	for _, accountRow := range accountTableP {
+		accountTable = append(accountTable,
+			accountrow.AccountRow{
+				AccountCode: accountRow.AccountCode,
+				AccountName: accountRow.AccountName,
+			})
+	}
+	return accountTable
+
+}
+
+// ReadQuarantineCSV reads the rows quarantined by a previous run from quarantineFileName, see validate.DownloadQuarantineToCsv
+func ReadQuarantineCSV(quarantineFileName string, quarantineTableP []*quarantinerow.QuarantineRow) (quarantineTable []quarantinerow.QuarantineRow, err error) {
+
+	quarantineFile, err := os.Open(quarantineFileName)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", quarantineFileName, err)
+	}
+	defer quarantineFile.Close()
+
+	err = gocsv.UnmarshalFile(quarantineFile, &quarantineTableP)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", quarantineFileName, err)
+	}
+
+	for _, quarantineRow := range quarantineTableP {
+		quarantineTable = append(quarantineTable, *quarantineRow)
+	}
+	return quarantineTable, nil
+
+}
+
 func writeErrorToFile(errr error, filename string) {
 	file, err := os.Create(filename)
 	checkError(err)
@@ -5,16 +5,20 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gocarina/gocsv"
+	"github.com/thomas-bamilo/financebooking/row/accountrow"
 	"github.com/thomas-bamilo/financebooking/row/beneficiarycoderow"
+	"github.com/thomas-bamilo/financebooking/row/chartofaccountrow"
 	"github.com/thomas-bamilo/financebooking/row/ledgermaprow"
 	"github.com/thomas-bamilo/financebooking/row/retailshortcoderow"
 	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+	"github.com/thomas-bamilo/financebooking/row/vatraterow"
 )
 
-func LoadValidBeneficiaryCodeToBaa(dbBaa *sql.DB, beneficiaryCodeTableValidRow []beneficiarycoderow.BeneficiaryCodeRow) {
+func LoadValidBeneficiaryCodeToBaa(dbBaa *sql.DB, beneficiaryCodeTableValidRow []beneficiarycoderow.BeneficiaryCodeRow) error {
 
 	// prepare statement to insert values into beneficiary_code_map table
 	insertBeneficiaryCodeTableStr := `INSERT INTO baa_application.finance.beneficiary_code_map (
@@ -23,12 +27,10 @@ func LoadValidBeneficiaryCodeToBaa(dbBaa *sql.DB, beneficiaryCodeTableValidRow [
 	VALUES (@p1,@p2)`
 	insertBeneficiaryCodeTable, err := dbBaa.Prepare(insertBeneficiaryCodeTableStr)
 	if err != nil {
-		fmt.Printf("FAILURE! %v\n", err)
 		writeErrorToFile(err, `err_prepare_beneficiary_code_map.txt`)
-		time.Sleep(30 * time.Second)
-		log.Fatal(err)
-
+		return fmt.Errorf("prepare insert into beneficiary_code_map: %w", err)
 	}
+	defer insertBeneficiaryCodeTable.Close()
 
 	csvErrorLogP := []*beneficiarycoderow.BeneficiaryCodeRow{}
 
@@ -51,19 +53,24 @@ func LoadValidBeneficiaryCodeToBaa(dbBaa *sql.DB, beneficiaryCodeTableValidRow [
 
 			// to write csvErrorLog to csv
 			file, err := os.OpenFile("BeneficiaryCodeErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
-			checkError(err)
+			if err != nil {
+				return fmt.Errorf("open BeneficiaryCodeErrorLog.csv: %w", err)
+			}
 			defer file.Close()
 			// save csvErrorLog to csv
 			err = gocsv.MarshalFile(&csvErrorLogP, file)
-			//log.Fatal(err)
+			if err != nil {
+				return fmt.Errorf("write BeneficiaryCodeErrorLog.csv: %w", err)
+			}
 
 		}
 		time.Sleep(1 * time.Millisecond)
 	}
 
+	return nil
 }
 
-func LoadValidRetailShortCodeToBaa(dbBaa *sql.DB, retailShortCodeTableValidRow []retailshortcoderow.RetailShortCodeRow) {
+func LoadValidRetailShortCodeToBaa(dbBaa *sql.DB, retailShortCodeTableValidRow []retailshortcoderow.RetailShortCodeRow) error {
 
 	// prepare statement to insert values into retail_short_code table
 	insertRetailShortCodeTableStr := `INSERT INTO baa_application.finance.retail_short_code (
@@ -71,11 +78,10 @@ func LoadValidRetailShortCodeToBaa(dbBaa *sql.DB, retailShortCodeTableValidRow [
 	VALUES (@p1)`
 	insertRetailShortCodeTable, err := dbBaa.Prepare(insertRetailShortCodeTableStr)
 	if err != nil {
-		fmt.Printf("FAILURE! %v\n", err)
 		writeErrorToFile(err, `err_prepare_retail_short_code.txt`)
-		log.Fatal(err)
-		time.Sleep(30 * time.Second)
+		return fmt.Errorf("prepare insert into retail_short_code: %w", err)
 	}
+	defer insertRetailShortCodeTable.Close()
 
 	csvErrorLogP := []*retailshortcoderow.RetailShortCodeRow{}
 
@@ -96,36 +102,60 @@ func LoadValidRetailShortCodeToBaa(dbBaa *sql.DB, retailShortCodeTableValidRow [
 
 			// to write csvErrorLog to csv
 			file, err := os.OpenFile("RetailShortCodeErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
-			checkError(err)
+			if err != nil {
+				return fmt.Errorf("open RetailShortCodeErrorLog.csv: %w", err)
+			}
 			defer file.Close()
 			// save csvErrorLog to csv
 			err = gocsv.MarshalFile(&csvErrorLogP, file)
-			//log.Fatal(err)
+			if err != nil {
+				return fmt.Errorf("write RetailShortCodeErrorLog.csv: %w", err)
+			}
 
 		}
 		time.Sleep(1 * time.Millisecond)
 	}
 
+	return nil
 }
 
-func LoadValidLedgerMapToBaa(dbBaa *sql.DB, ledgerMapTableValidRow []ledgermaprow.LedgerMapRow) {
-
-	// prepare statement to insert values into ledger_map table
-	insertLedgerMapTableStr := `INSERT INTO baa_application.finance.ledger_map (
+// LoadValidLedgerMapToBaa upserts ledgerMapTableValidRow into ledger_map table of BAA database:
+// the row with the same dimensions and priority as an uploaded row is replaced by it, see ledgermaprow.Upsert
+func LoadValidLedgerMapToBaa(dbBaa *sql.DB, ledgerMapTableValidRow []ledgermaprow.LedgerMapRow) error {
+
+	// prepare statement to upsert values into ledger_map table on its dimensions and priority
+	insertLedgerMapTableStr := `MERGE baa_application.finance.ledger_map AS lm
+	USING (SELECT 
+		@p1 'transaction_type'
+		,@p2 'item_status'
+		,@p3 'payment_method'
+		,@p4 'shipment_provider_name'
+		,@p5 'ledger'
+		,@p6 'subledger'
+		,@p7 'priority') AS upload
+	ON lm.transaction_type = upload.transaction_type
+	AND lm.item_status = upload.item_status
+	AND lm.payment_method = upload.payment_method
+	AND lm.shipment_provider_name = upload.shipment_provider_name
+	AND lm.priority = upload.priority
+	WHEN MATCHED THEN UPDATE SET 
+		lm.ledger = upload.ledger
+		,lm.subledger = upload.subledger
+	WHEN NOT MATCHED THEN INSERT (
 		transaction_type
 		,item_status
 		,payment_method 
 		,shipment_provider_name
 		,ledger
-		,subledger) 
-	VALUES (@p1,@p2,@p3,@p4,@p5,@p6)`
+		,subledger
+		,priority) 
+	VALUES (upload.transaction_type,upload.item_status,upload.payment_method,upload.shipment_provider_name,upload.ledger,upload.subledger,upload.priority);`
 	insertLedgerMapTable, err := dbBaa.Prepare(insertLedgerMapTableStr)
 	if err != nil {
-		fmt.Printf("FAILURE! %v\n", err)
 		writeErrorToFile(err, `err_prepare_ledger_map.txt`)
-		//log.Fatal(err)
-
+		return fmt.Errorf("prepare merge into ledger_map: %w", err)
 	}
+	defer insertLedgerMapTable.Close()
 
 	csvErrorLogP := []*ledgermaprow.LedgerMapRow{}
 
@@ -139,6 +169,7 @@ func LoadValidLedgerMapToBaa(dbBaa *sql.DB, ledgerMapTableValidRow []ledgermapro
 			ledgerMapTableValidRow[i].ShipmentProviderName,
 			ledgerMapTableValidRow[i].Ledger,
 			ledgerMapTableValidRow[i].Subledger,
+			ledgerMapTableValidRow[i].PriorityLevel(),
 		)
 		if err != nil {
 			fmt.Printf("WARNING! %v\n", err)
@@ -152,57 +183,409 @@ func LoadValidLedgerMapToBaa(dbBaa *sql.DB, ledgerMapTableValidRow []ledgermapro
 					ShipmentProviderName: ledgerMapTableValidRow[i].ShipmentProviderName,
 					Ledger:               ledgerMapTableValidRow[i].Ledger,
 					Subledger:            ledgerMapTableValidRow[i].Subledger,
+					Priority:             ledgerMapTableValidRow[i].Priority,
 				})
 
 			// to write csvErrorLog to csv
 			file, err := os.OpenFile("LedgerMapErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
-			checkError(err)
+			if err != nil {
+				return fmt.Errorf("open LedgerMapErrorLog.csv: %w", err)
+			}
+			defer file.Close()
+			// save csvErrorLog to csv
+			err = gocsv.MarshalFile(&csvErrorLogP, file)
+			if err != nil {
+				return fmt.Errorf("write LedgerMapErrorLog.csv: %w", err)
+			}
+
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// LoadValidVatRateToBaa upserts vatRateTableValidRow into vat_rate table of BAA database:
+// a row with the valid_from of an existing row replaces its valid_to and vat_rate
+// and a new row closes the VAT rate still valid before its valid_from, so that a transaction date matches exactly one VAT rate
+func LoadValidVatRateToBaa(dbBaa *sql.DB, vatRateTableValidRow []vatraterow.VatRateRow) error {
+
+	// prepare statement to close the VAT rate still valid (valid_to NULL) before the valid_from of the uploaded row
+	closeVatRateTableStr := `UPDATE baa_application.finance.vat_rate 
+	SET valid_to = CONVERT(DATE,@p1)
+	WHERE valid_to IS NULL
+	AND valid_from < CONVERT(DATE,@p1)`
+	closeVatRateTable, err := dbBaa.Prepare(closeVatRateTableStr)
+	if err != nil {
+		writeErrorToFile(err, `err_prepare_vat_rate.txt`)
+		return fmt.Errorf("prepare update of vat_rate: %w", err)
+	}
+	defer closeVatRateTable.Close()
+
+	// prepare statement to upsert values into vat_rate table on valid_from
+	// an empty valid_to is stored as NULL: the VAT rate is still valid
+	mergeVatRateTableStr := `MERGE baa_application.finance.vat_rate AS vr
+	USING (SELECT 
+		CONVERT(DATE,@p1) 'valid_from'
+		,CONVERT(DATE,NULLIF(@p2,'')) 'valid_to'
+		,CONVERT(DECIMAL(5,2),@p3) 'vat_rate') AS upload
+	ON vr.valid_from = upload.valid_from
+	WHEN MATCHED THEN UPDATE SET 
+		vr.valid_to = upload.valid_to
+		,vr.vat_rate = upload.vat_rate
+	WHEN NOT MATCHED THEN INSERT (
+		valid_from
+		,valid_to
+		,vat_rate) 
+	VALUES (upload.valid_from,upload.valid_to,upload.vat_rate);`
+	mergeVatRateTable, err := dbBaa.Prepare(mergeVatRateTableStr)
+	if err != nil {
+		writeErrorToFile(err, `err_prepare_vat_rate.txt`)
+		return fmt.Errorf("prepare merge into vat_rate: %w", err)
+	}
+	defer mergeVatRateTable.Close()
+
+	csvErrorLogP := []*vatraterow.VatRateRow{}
+
+	// write vatRateTableValidRow into vat_rate table, sorted by valid_from by vatraterow.FilterVatRateTable
+	// and write csvErrorLog to csvErrorLog.csv
+	for i := 0; i < len(vatRateTableValidRow); i++ {
+		_, err = closeVatRateTable.Exec(vatRateTableValidRow[i].ValidFrom)
+		if err == nil {
+			_, err = mergeVatRateTable.Exec(
+				vatRateTableValidRow[i].ValidFrom,
+				vatRateTableValidRow[i].ValidTo,
+				vatRateTableValidRow[i].VatRate,
+			)
+		}
+		if err != nil {
+			fmt.Printf("WARNING! %v\n", err)
+
+			csvErrorLogP = append(csvErrorLogP,
+				&vatraterow.VatRateRow{
+					Err:       string(err.Error()),
+					ValidFrom: vatRateTableValidRow[i].ValidFrom,
+					ValidTo:   vatRateTableValidRow[i].ValidTo,
+					VatRate:   vatRateTableValidRow[i].VatRate,
+				})
+
+			// to write csvErrorLog to csv
+			file, err := os.OpenFile("VatRateErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+			if err != nil {
+				return fmt.Errorf("open VatRateErrorLog.csv: %w", err)
+			}
+			defer file.Close()
+			// save csvErrorLog to csv
+			err = gocsv.MarshalFile(&csvErrorLogP, file)
+			if err != nil {
+				return fmt.Errorf("write VatRateErrorLog.csv: %w", err)
+			}
+
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// GetVatRateTable gets the VAT rates and their validity dates from vat_rate table of BAA database
+func GetVatRateTable(dbBaa *sql.DB) ([]vatraterow.VatRateRow, error) {
+
+	// store vatRateQuery in a string
+	// dates are formatted as YYYY-MM-DD (style 23) to be compared with the transaction_date of Seller Center
+	// and VAT rates with 2 decimals, e.g. 9.00 or 9.50
+	vatRateQuery := `SELECT 
+	CONVERT(VARCHAR(10),vr.valid_from,23) 'valid_from'
+	,COALESCE(CONVERT(VARCHAR(10),vr.valid_to,23),'') 'valid_to'
+	,CONVERT(VARCHAR(6),CONVERT(DECIMAL(5,2),vr.vat_rate)) 'vat_rate'
+	FROM baa_application.finance.vat_rate vr`
+
+	// write vatRateQuery result to an array of vatraterow.VatRateRow, this array of rows represents vatRateTable
+	var validFrom, validTo, vatRate string
+	var vatRateTable []vatraterow.VatRateRow
+
+	rows, err := dbBaa.Query(vatRateQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query vat_rate: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := rows.Scan(&validFrom, &validTo, &vatRate)
+		if err != nil {
+			return nil, fmt.Errorf("scan vat_rate: %w", err)
+		}
+		vatRateTable = append(vatRateTable,
+			vatraterow.VatRateRow{
+				ValidFrom: validFrom,
+				ValidTo:   validTo,
+				VatRate:   vatRate,
+			})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read vat_rate: %w", err)
+	}
+
+	return vatRateTable, nil
+}
+
+// LoadValidChartOfAccountToBaa upserts chartOfAccountTableValidRow into chart_of_account table of BAA database:
+// the row of an account role already in chart_of_account replaces its Account Code
+func LoadValidChartOfAccountToBaa(dbBaa *sql.DB, chartOfAccountTableValidRow []chartofaccountrow.ChartOfAccountRow) error {
+
+	// prepare statement to upsert values into chart_of_account table on account_role
+	insertChartOfAccountTableStr := `MERGE baa_application.finance.chart_of_account AS coa
+	USING (SELECT 
+		@p1 'account_role'
+		,@p2 'account_code') AS upload
+	ON coa.account_role = upload.account_role
+	WHEN MATCHED THEN UPDATE SET 
+		coa.account_code = upload.account_code
+	WHEN NOT MATCHED THEN INSERT (
+		account_role
+		,account_code) 
+	VALUES (upload.account_role,upload.account_code);`
+	insertChartOfAccountTable, err := dbBaa.Prepare(insertChartOfAccountTableStr)
+	if err != nil {
+		writeErrorToFile(err, `err_prepare_chart_of_account.txt`)
+		return fmt.Errorf("prepare merge into chart_of_account: %w", err)
+	}
+	defer insertChartOfAccountTable.Close()
+
+	csvErrorLogP := []*chartofaccountrow.ChartOfAccountRow{}
+
+	// write chartOfAccountTableValidRow into chart_of_account table
+	// and write csvErrorLog to csvErrorLog.csv
+	for i := 0; i < len(chartOfAccountTableValidRow); i++ {
+		_, err = insertChartOfAccountTable.Exec(
+			chartOfAccountTableValidRow[i].AccountRole,
+			chartOfAccountTableValidRow[i].AccountCode,
+		)
+		if err != nil {
+			fmt.Printf("WARNING! %v\n", err)
+
+			csvErrorLogP = append(csvErrorLogP,
+				&chartofaccountrow.ChartOfAccountRow{
+					Err:         string(err.Error()),
+					AccountRole: chartOfAccountTableValidRow[i].AccountRole,
+					AccountCode: chartOfAccountTableValidRow[i].AccountCode,
+				})
+
+			// to write csvErrorLog to csv
+			file, err := os.OpenFile("ChartOfAccountErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+			if err != nil {
+				return fmt.Errorf("open ChartOfAccountErrorLog.csv: %w", err)
+			}
 			defer file.Close()
 			// save csvErrorLog to csv
 			err = gocsv.MarshalFile(&csvErrorLogP, file)
-			//log.Fatal(err)
+			if err != nil {
+				return fmt.Errorf("write ChartOfAccountErrorLog.csv: %w", err)
+			}
 
 		}
 		time.Sleep(1 * time.Millisecond)
 	}
 
+	return nil
 }
 
-func GetLedgerMap(dbBaa *sql.DB) []scomsrow.ScOmsRow {
+// GetChartOfAccountTable gets the Account Code of each account role from chart_of_account table of BAA database
+func GetChartOfAccountTable(dbBaa *sql.DB) ([]chartofaccountrow.ChartOfAccountRow, error) {
+
+	// store chartOfAccountQuery in a string
+	chartOfAccountQuery := `SELECT 
+	coa.account_role
+	,CONVERT(VARCHAR(20),coa.account_code) 'account_code'
+	FROM baa_application.finance.chart_of_account coa`
+
+	// write chartOfAccountQuery result to an array of chartofaccountrow.ChartOfAccountRow, this array of rows represents chartOfAccountTable
+	var accountRole, accountCode string
+	var chartOfAccountTable []chartofaccountrow.ChartOfAccountRow
+
+	rows, err := dbBaa.Query(chartOfAccountQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query chart_of_account: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := rows.Scan(&accountRole, &accountCode)
+		if err != nil {
+			return nil, fmt.Errorf("scan chart_of_account: %w", err)
+		}
+		chartOfAccountTable = append(chartOfAccountTable,
+			chartofaccountrow.ChartOfAccountRow{
+				AccountRole: accountRole,
+				AccountCode: accountCode,
+			})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read chart_of_account: %w", err)
+	}
+
+	return chartOfAccountTable, nil
+}
+
+// LoadValidAccountToBaa upserts accountTableValidRow into account table of BAA database, the account master of NGS:
+// the row of an Account Code already in account replaces its name
+func LoadValidAccountToBaa(dbBaa *sql.DB, accountTableValidRow []accountrow.AccountRow) error {
+
+	// prepare statement to upsert values into account table on account_code
+	insertAccountTableStr := `MERGE baa_application.finance.account AS a
+	USING (SELECT 
+		CONVERT(INT,@p1) 'account_code'
+		,@p2 'account_name') AS upload
+	ON a.account_code = upload.account_code
+	WHEN MATCHED THEN UPDATE SET 
+		a.account_name = upload.account_name
+	WHEN NOT MATCHED THEN INSERT (
+		account_code
+		,account_name) 
+	VALUES (upload.account_code,upload.account_name);`
+	insertAccountTable, err := dbBaa.Prepare(insertAccountTableStr)
+	if err != nil {
+		writeErrorToFile(err, `err_prepare_account.txt`)
+		return fmt.Errorf("prepare merge into account: %w", err)
+	}
+	defer insertAccountTable.Close()
+
+	csvErrorLogP := []*accountrow.AccountRow{}
+
+	// write accountTableValidRow into account table
+	// and write csvErrorLog to csvErrorLog.csv
+	for i := 0; i < len(accountTableValidRow); i++ {
+		_, err = insertAccountTable.Exec(
+			accountTableValidRow[i].AccountCode,
+			accountTableValidRow[i].AccountName,
+		)
+		if err != nil {
+			fmt.Printf("WARNING! %v\n", err)
+
+			csvErrorLogP = append(csvErrorLogP,
+				&accountrow.AccountRow{
+					Err:         string(err.Error()),
+					AccountCode: accountTableValidRow[i].AccountCode,
+					AccountName: accountTableValidRow[i].AccountName,
+				})
+
+			// to write csvErrorLog to csv
+			file, err := os.OpenFile("AccountErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+			if err != nil {
+				return fmt.Errorf("open AccountErrorLog.csv: %w", err)
+			}
+			defer file.Close()
+			// save csvErrorLog to csv
+			err = gocsv.MarshalFile(&csvErrorLogP, file)
+			if err != nil {
+				return fmt.Errorf("write AccountErrorLog.csv: %w", err)
+			}
+
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// GetAccountTable gets the account master of NGS from account table of BAA database
+func GetAccountTable(dbBaa *sql.DB) ([]accountrow.AccountRow, error) {
+
+	// store accountQuery in a string
+	accountQuery := `SELECT 
+	CONVERT(VARCHAR(20),a.account_code) 'account_code'
+	,a.account_name
+	FROM baa_application.finance.account a`
+
+	// write accountQuery result to an array of accountrow.AccountRow, this array of rows represents accountTable
+	var accountCode, accountName string
+	var accountTable []accountrow.AccountRow
+
+	rows, err := dbBaa.Query(accountQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query account: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := rows.Scan(&accountCode, &accountName)
+		if err != nil {
+			return nil, fmt.Errorf("scan account: %w", err)
+		}
+		accountTable = append(accountTable,
+			accountrow.AccountRow{
+				AccountCode: accountCode,
+				AccountName: accountName,
+			})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read account: %w", err)
+	}
+
+	return accountTable, nil
+}
+
+// GetLedgerMap gets the rows of ledger_map table of BAA database, see ledgermaprow.LedgerMapRow
+func GetLedgerMap(dbBaa *sql.DB) ([]ledgermaprow.LedgerMapRow, error) {
 
 	// store LedgerMapQuery in a string
 	ledgerMapQuery := `SELECT 
-	CONCAT(lm.transaction_type,'-',lm.item_status,'-',lm.payment_method,'-',lm.shipment_provider_name) 'ledger_map_key'
+	lm.transaction_type
+	,lm.item_status
+	,lm.payment_method
+	,lm.shipment_provider_name
 	,lm.ledger
 	,lm.subledger
+	,ISNULL(lm.priority,0) 'priority'
 	FROM baa_application.finance.ledger_map lm`
 
-	// write LedgerMapQuery result to an array of scomsrow.ScOmsRow , this array of rows represents ledgerMapTable
-	var ledgerMapKey string
-	var ledger, subledger int
-	var ledgerMapTable []scomsrow.ScOmsRow
+	// write LedgerMapQuery result to an array of ledgermaprow.LedgerMapRow , this array of rows represents ledgerMapTable
+	var transactionType, itemStatus, paymentMethod, shipmentProviderName, subledgerStr string
+	var ledger, subledger, priority int
+	var ledgerMapTable []ledgermaprow.LedgerMapRow
 
 	rows, err := dbBaa.Query(ledgerMapQuery)
-	checkError(err)
+	if err != nil {
+		return nil, fmt.Errorf("query ledger_map: %w", err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
-		err := rows.Scan(&ledgerMapKey, &ledger, &subledger)
-		checkError(err)
+		err := rows.Scan(&transactionType, &itemStatus, &paymentMethod, &shipmentProviderName, &ledger, &subledger, &priority)
+		if err != nil {
+			return nil, fmt.Errorf("scan ledger_map: %w", err)
+		}
+		// an empty subledger of ledger_map.csv is stored as 0 in ledger_map table
+		subledgerStr = ``
+		if subledger != 0 {
+			subledgerStr = strconv.Itoa(subledger)
+		}
 		ledgerMapTable = append(ledgerMapTable,
-			scomsrow.ScOmsRow{
-				LedgerMapKey: ledgerMapKey,
-				Ledger:       ledger,
-				Subledger:    subledger,
+			ledgermaprow.LedgerMapRow{
+				TransactionType:      transactionType,
+				ItemStatus:           itemStatus,
+				PaymentMethod:        paymentMethod,
+				ShipmentProviderName: shipmentProviderName,
+				Ledger:               strconv.Itoa(ledger),
+				Subledger:            subledgerStr,
+				Priority:             strconv.Itoa(priority),
 			})
 
 		//err = sqltocsv.WriteFile("ledgerMapTable.csv", rows)
 		//checkError(err)
 	}
 
-	return ledgerMapTable
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read ledger_map: %w", err)
+	}
+
+	return ledgerMapTable, nil
 }
 
-func GetBeneficiaryCodeTable(dbBaa *sql.DB) []scomsrow.ScOmsRow {
+func GetBeneficiaryCodeTable(dbBaa *sql.DB) ([]scomsrow.ScOmsRow, error) {
 
 	// store BeneficiaryCodeQuery in a string
 	beneficiaryCodeQuery := `SELECT 
@@ -215,11 +598,17 @@ func GetBeneficiaryCodeTable(dbBaa *sql.DB) []scomsrow.ScOmsRow {
 	var beneficiaryCode int
 	var beneficiaryCodeTable []scomsrow.ScOmsRow
 
-	rows, _ := dbBaa.Query(beneficiaryCodeQuery)
+	rows, err := dbBaa.Query(beneficiaryCodeQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query beneficiary_code_map: %w", err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 		err := rows.Scan(&shortCode, &beneficiaryCode)
-		checkError(err)
+		if err != nil {
+			return nil, fmt.Errorf("scan beneficiary_code_map: %w", err)
+		}
 		beneficiaryCodeTable = append(beneficiaryCodeTable,
 			scomsrow.ScOmsRow{
 				ShortCode:       shortCode,
@@ -227,10 +616,14 @@ func GetBeneficiaryCodeTable(dbBaa *sql.DB) []scomsrow.ScOmsRow {
 			})
 	}
 
-	return beneficiaryCodeTable
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read beneficiary_code_map: %w", err)
+	}
+
+	return beneficiaryCodeTable, nil
 }
 
-func GetRetailShortCodeFromBaa(dbBaa *sql.DB) []scomsrow.ScOmsRow {
+func GetRetailShortCodeFromBaa(dbBaa *sql.DB) ([]scomsrow.ScOmsRow, error) {
 
 	// store RetailShortCodeQuery in a string
 	retailShortCodeQuery := `SELECT 
@@ -241,29 +634,37 @@ func GetRetailShortCodeFromBaa(dbBaa *sql.DB) []scomsrow.ScOmsRow {
 	var shortCode string
 	var retailShortCodeTable []scomsrow.ScOmsRow
 
-	rows, _ := dbBaa.Query(retailShortCodeQuery)
+	rows, err := dbBaa.Query(retailShortCodeQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query retail_short_code: %w", err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 		err := rows.Scan(&shortCode)
-		checkError(err)
+		if err != nil {
+			return nil, fmt.Errorf("scan retail_short_code: %w", err)
+		}
 		retailShortCodeTable = append(retailShortCodeTable,
 			scomsrow.ScOmsRow{
 				ShortCode: shortCode,
 			})
 	}
 
-	return retailShortCodeTable
-}
-
-func checkError(err error) {
-	if err != nil {
-		log.Fatal(err.Error())
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read retail_short_code: %w", err)
 	}
+
+	return retailShortCodeTable, nil
 }
 
+// writeErrorToFile writes errr to filename for the user of userinteract, the error is returned anyway
 func writeErrorToFile(errr error, filename string) {
 	file, err := os.Create(filename)
-	checkError(err)
+	if err != nil {
+		log.Println(`WARNING: could not write ` + filename + `: ` + err.Error())
+		return
+	}
 	defer file.Close()
 
 	fmt.Fprintf(file, string(errr.Error()))
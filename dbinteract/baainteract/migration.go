@@ -0,0 +1,49 @@
+package baainteract
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration lists the changes of the finance schema of BAA database required by the booking, in order
+// every migration checks the current schema first so that Migrate can run before every upload
+var migration = []struct {
+	name  string
+	query string
+}{
+	{
+		// VAT rates can have decimals, e.g. 9.5
+		name: `vat_rate decimal`,
+		query: `IF EXISTS (SELECT 1 FROM baa_application.INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = 'finance' AND TABLE_NAME = 'vat_rate' AND COLUMN_NAME = 'vat_rate' AND DATA_TYPE <> 'decimal')
+	ALTER TABLE baa_application.finance.vat_rate ALTER COLUMN vat_rate DECIMAL(5,2) NOT NULL`,
+	},
+	{
+		// account master of NGS, the Account Codes of chart_of_account are checked against it
+		name: `account table`,
+		query: `IF OBJECT_ID('baa_application.finance.account', 'U') IS NULL
+	CREATE TABLE baa_application.finance.account (
+		account_code INT NOT NULL PRIMARY KEY
+		,account_name NVARCHAR(255) NOT NULL)`,
+	},
+	{
+		// priority of the rows of ledger_map matching the same transactions with the same specificity, see ledgermaprow.Match
+		name: `ledger_map priority`,
+		query: `IF COL_LENGTH('baa_application.finance.ledger_map', 'priority') IS NULL
+	ALTER TABLE baa_application.finance.ledger_map ADD priority INT NOT NULL CONSTRAINT df_ledger_map_priority DEFAULT 0`,
+	},
+}
+
+// Migrate applies every migration of the finance schema of BAA database which is not applied yet
+func Migrate(dbBaa *sql.DB) error {
+
+	for _, m := range migration {
+		_, err := dbBaa.Exec(m.query)
+		if err != nil {
+			writeErrorToFile(err, `err_migrate_baa.txt`)
+			return fmt.Errorf("migrate BAA database (%s): %w", m.name, err)
+		}
+	}
+
+	return nil
+}
@@ -2,14 +2,98 @@ package omsinteract
 
 import (
 	"database/sql"
-	"log"
+	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/thomas-bamilo/financebooking/money"
 	"github.com/thomas-bamilo/financebooking/row/scomsrow"
 )
 
+// DefaultChunkSize is the default number of oms_id_sales_order_item looked up in OMS per query,
+// well below the maximum number of parameters of a query
+const DefaultChunkSize = 1000
+
+// DefaultWorkerCount is the default number of queries run concurrently on OMS database
+const DefaultWorkerCount = 4
+
 // GetOmsData gets the OMS data required for Finance Booking process
-// filtered for omsIDSalesOrderItemList found in Seller Center data
-func GetOmsData(dbOms *sql.DB, omsIDSalesOrderItemList string) []scomsrow.ScOmsRow {
+// filtered for omsIDSalesOrderItem found in Seller Center data, chunkSize ids per query bound as parameters,
+// at most workerCount queries at a time, and returns the ids of omsIDSalesOrderItem not found in OMS
+func GetOmsData(dbOms *sql.DB, omsIDSalesOrderItem []int, chunkSize, workerCount int) (omsTable []scomsrow.ScOmsRow, notFoundOmsIDSalesOrderItem []int, err error) {
+
+	if chunkSize <= 0 {
+		return nil, nil, fmt.Errorf("invalid OMS chunk size %d: it should be positive", chunkSize)
+	}
+	if workerCount <= 0 {
+		return nil, nil, fmt.Errorf("invalid OMS worker count %d: it should be positive", workerCount)
+	}
+
+	// each worker queries the next chunk not queried yet, the chunks are then gathered in order
+	// the first error closes stop so that no chunk is queried after it
+	chunkCount := (len(omsIDSalesOrderItem) + chunkSize - 1) / chunkSize
+	omsTableChunk := make([][]scomsrow.ScOmsRow, chunkCount)
+	chunkErr := make([]error, chunkCount)
+	chunkIndex := make(chan int)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	var wg sync.WaitGroup
+	for worker := 0; worker < workerCount && worker < chunkCount; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range chunkIndex {
+				first := i * chunkSize
+				last := first + chunkSize
+				if last > len(omsIDSalesOrderItem) {
+					last = len(omsIDSalesOrderItem)
+				}
+				omsTableChunk[i], chunkErr[i] = getOmsDataChunk(dbOms, omsIDSalesOrderItem[first:last])
+				if chunkErr[i] != nil {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}()
+	}
+dispatch:
+	for i := 0; i < chunkCount; i++ {
+		select {
+		case chunkIndex <- i:
+		case <-stop:
+			break dispatch
+		}
+	}
+	close(chunkIndex)
+	wg.Wait()
+
+	foundOmsIDSalesOrderItem := make(map[int]bool)
+	for i := 0; i < chunkCount; i++ {
+		if chunkErr[i] != nil {
+			return nil, nil, chunkErr[i]
+		}
+		for _, omsRow := range omsTableChunk[i] {
+			foundOmsIDSalesOrderItem[omsRow.OmsIDSalesOrderItem] = true
+		}
+		omsTable = append(omsTable, omsTableChunk[i]...)
+	}
+
+	for _, oneOmsIDSalesOrderItem := range omsIDSalesOrderItem {
+		if !foundOmsIDSalesOrderItem[oneOmsIDSalesOrderItem] {
+			notFoundOmsIDSalesOrderItem = append(notFoundOmsIDSalesOrderItem, oneOmsIDSalesOrderItem)
+		}
+	}
+
+	return omsTable, notFoundOmsIDSalesOrderItem, nil
+}
+
+// getOmsDataChunk gets the OMS data of the chunk omsIDSalesOrderItem, see GetOmsData
+func getOmsDataChunk(dbOms *sql.DB, omsIDSalesOrderItem []int) ([]scomsrow.ScOmsRow, error) {
+
+	// one parameter per id
+	omsIDSalesOrderItemParameter := make([]interface{}, len(omsIDSalesOrderItem))
+	for i, oneOmsIDSalesOrderItem := range omsIDSalesOrderItem {
+		omsIDSalesOrderItemParameter[i] = oneOmsIDSalesOrderItem
+	}
 
 	// store LedgerMapKeyQuery in a string
 	LedgerMapKeyQuery := `
@@ -18,7 +102,7 @@ func GetOmsData(dbOms *sql.DB, omsIDSalesOrderItemList string) []scomsrow.ScOmsR
 	,COALESCE(isois.name,'NULL') 'item_status'
 	,COALESCE(iso.payment_method,'NULL') 'payment_method'
 	,COALESCE(osp.shipment_provider_name,'NULL') 'shipment_provider_name'
-	,COALESCE(isoi.paid_price,'NULL') 'paid_price'
+	,COALESCE(isoi.paid_price,0) 'paid_price'
   
 	FROM ims_sales_order_item isoi
   
@@ -37,34 +121,46 @@ func GetOmsData(dbOms *sql.DB, omsIDSalesOrderItemList string) []scomsrow.ScOmsR
 	LEFT JOIN ims_sales_order_item_status isois
 	ON isois.id_sales_order_item_status = isoi.fk_sales_order_item_status
 
-	WHERE isoi.id_sales_order_item IN(` + omsIDSalesOrderItemList + `)
+	WHERE isoi.id_sales_order_item IN(?` + strings.Repeat(`,?`, len(omsIDSalesOrderItem)-1) + `)
 	
 	GROUP BY isoi.id_sales_order_item`
 
 	// write LedgerMapKeyQuery result to an array of scomsrow.ScOmsRow , this array of rows represents omsTable
 	var itemStatus, paymentMethod, shipmentProviderName string
-	var omsIDSalesOrderItem int
-	var paidPrice float32
+	var omsIDSalesOrderItemValue int
+	var paidPrice money.Rial
 
 	var omsTable []scomsrow.ScOmsRow
 
-	rows, err := dbOms.Query(LedgerMapKeyQuery)
-	checkError(err)
+	rows, err := dbOms.Query(LedgerMapKeyQuery, omsIDSalesOrderItemParameter...)
+	if err != nil {
+		return nil, fmt.Errorf("query OMS sales order items: %w", err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
-		err := rows.Scan(&omsIDSalesOrderItem, &itemStatus, &paymentMethod, &shipmentProviderName, &paidPrice)
-		checkError(err)
+		err := rows.Scan(&omsIDSalesOrderItemValue, &itemStatus, &paymentMethod, &shipmentProviderName, &paidPrice)
+		if err != nil {
+			return nil, fmt.Errorf("scan OMS sales order item: %w", err)
+		}
 		omsTable = append(omsTable,
 			scomsrow.ScOmsRow{
-				OmsIDSalesOrderItem:  omsIDSalesOrderItem,
+				OmsIDSalesOrderItem:  omsIDSalesOrderItemValue,
 				ItemStatus:           itemStatus,
 				PaymentMethod:        paymentMethod,
 				ShipmentProviderName: shipmentProviderName,
 				PaidPrice:            paidPrice,
 			})
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read OMS sales order items: %w", err)
+	}
+	// Close is deferred in case of error, it does nothing once rows is closed
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("close OMS sales order items: %w", err)
+	}
 
-	return omsTable
+	return omsTable, nil
 }
 
 /*// GetLedgerMapKey gets all the existing id_seller_rejection from baa_application.baa_application_schema.seller_rejection and store then into an array of scomsrow.ScOmsRow
@@ -118,9 +214,3 @@ func GetLedgerMapKey(dbOms *sql.DB, omsIDSalesOrderItemList string) []scomsrow.S
 
 	return omsTable
 }*/
-
-func checkError(err error) {
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-}
@@ -2,13 +2,16 @@ package scinteract
 
 import (
 	"database/sql"
-	"log"
+	"fmt"
 
+	"github.com/thomas-bamilo/financebooking/bookingperiod"
+	"github.com/thomas-bamilo/financebooking/money"
 	"github.com/thomas-bamilo/financebooking/row/scomsrow"
 )
 
 // GetSellerCenterData gets the Seller Center data required for Finance Booking process
-func GetSellerCenterData(dbSc *sql.DB) []scomsrow.ScOmsRow {
+// for the transactions created during bookingPeriod
+func GetSellerCenterData(dbSc *sql.DB, bookingPeriod bookingperiod.BookingPeriod) ([]scomsrow.ScOmsRow, error) {
 
 	// store sellerCenterQuery in a string
 	sellerCenterQuery := `
@@ -22,6 +25,7 @@ func GetSellerCenterData(dbSc *sql.DB) []scomsrow.ScOmsRow {
 	,COALESCE(tasg.name,'NULL') 'transaction_type'
 	,COALESCE(tasg.id_tre2_account_statement_group,0) 'id_transaction_type'
 	,COALESCE(t.value,0) 'transaction_value'
+	,COALESCE(DATE_FORMAT(t.created_at,'%Y-%m-%d'),'NULL') 'transaction_date'
 	,COALESCE(ts.id_transaction_statement,0) 'id_transaction_statement'
 	,COALESCE(ts.start_date,'NULL') 'statement_start_date'
 	,COALESCE(ts.end_date,'NULL') 'statement_end_date'
@@ -47,24 +51,26 @@ func GetSellerCenterData(dbSc *sql.DB) []scomsrow.ScOmsRow {
 	LEFT JOIN transaction_statement ts
 	ON ts.id_transaction_statement = t.fk_transaction_statement
 
-	WHERE MONTH(t.created_at) = 4
-	AND YEAR(t.created_at) = 2018`
-
-	//WHERE MONTH(t.created_at) = CASE WHEN MONTH(CURRENT_DATE()) = 1 THEN 12 ELSE MONTH(CURRENT_DATE())-1 END
-	//AND YEAR(t.created_at) = CASE WHEN MONTH(CURRENT_DATE()) = 1 THEN YEAR(CURRENT_DATE())-1 ELSE YEAR(CURRENT_DATE()) END
+	WHERE t.created_at >= ?
+	AND t.created_at < ?`
 
 	// write sellerCenterQuery result to an array of scomsrow.ScOmsRow, this array of rows represents sellerCenterTable
-	var orderNr, shortCode, supplierName, transactionType, statementStartDate, statementEndDate, comment string
+	var orderNr, shortCode, supplierName, transactionType, transactionDate, statementStartDate, statementEndDate, comment string
 	var iDTransaction, omsIDSalesOrderItem, iDSupplier, iDTransactionStatement, iDTransactionType int
-	var transactionValue float32
+	var transactionValue money.Rial
 	var sellerCenterTable []scomsrow.ScOmsRow
 
-	rows, err := dbSc.Query(sellerCenterQuery)
-	checkError(err)
+	rows, err := dbSc.Query(sellerCenterQuery, bookingPeriod.FromDate(), bookingPeriod.ToDate())
+	if err != nil {
+		return nil, fmt.Errorf("query Seller Center transactions: %w", err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
-		err := rows.Scan(&iDTransaction, &omsIDSalesOrderItem, &orderNr, &iDSupplier, &shortCode, &supplierName, &transactionType, &iDTransactionType, &transactionValue, &iDTransactionStatement, &statementStartDate, &statementEndDate, &comment)
-		checkError(err)
+		err := rows.Scan(&iDTransaction, &omsIDSalesOrderItem, &orderNr, &iDSupplier, &shortCode, &supplierName, &transactionType, &iDTransactionType, &transactionValue, &transactionDate, &iDTransactionStatement, &statementStartDate, &statementEndDate, &comment)
+		if err != nil {
+			return nil, fmt.Errorf("scan Seller Center transaction: %w", err)
+		}
 		sellerCenterTable = append(sellerCenterTable,
 			scomsrow.ScOmsRow{
 				IDTransaction:          iDTransaction,
@@ -76,6 +82,7 @@ func GetSellerCenterData(dbSc *sql.DB) []scomsrow.ScOmsRow {
 				TransactionType:        transactionType,
 				IDTransactionType:      iDTransactionType,
 				TransactionValue:       transactionValue,
+				TransactionDate:        transactionDate,
 				IDTransactionStatement: iDTransactionStatement,
 				StatementStartDate:     statementStartDate,
 				StatementEndDate:       statementEndDate,
@@ -85,12 +92,9 @@ func GetSellerCenterData(dbSc *sql.DB) []scomsrow.ScOmsRow {
 		//err = sqltocsv.WriteFile("sellerCenterTable.csv", rows)
 		//checkError(err)
 	}
-
-	return sellerCenterTable
-}
-
-func checkError(err error) {
-	if err != nil {
-		log.Fatal(err.Error())
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read Seller Center transactions: %w", err)
 	}
+
+	return sellerCenterTable, nil
 }
@@ -0,0 +1,134 @@
+package bulkload
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+)
+
+// BatchSize is the maximum number of rows inserted by each INSERT statement
+const BatchSize = 500
+
+// maxVariable is the maximum number of ? of a SQLite statement (SQLITE_MAX_VARIABLE_NUMBER of older SQLite versions)
+const maxVariable = 999
+
+// FailedRow is the row Index of a table which could not be inserted into SQLite because of Err
+type FailedRow struct {
+	Index int
+	Err   string
+}
+
+// ScOmsColumn is a column of a SQLite table loaded from an array of ScOmsRow and its Value for a row
+type ScOmsColumn struct {
+	Name  string
+	Value func(row scomsrow.ScOmsRow) interface{}
+}
+
+// InsertScOmsTable inserts table into the SQLite table tableName, see Insert,
+// and returns the rows of table which could not be inserted, with their error
+func InsertScOmsTable(db *sql.DB, tableName string, column []ScOmsColumn, table []scomsrow.ScOmsRow) (failedScOmsRow []scomsrow.ScOmsRow, err error) {
+
+	var columnName []string
+	for _, oneColumn := range column {
+		columnName = append(columnName, oneColumn.Name)
+	}
+	failedRow, err := Insert(db, tableName, columnName, len(table), func(i int) []interface{} {
+		value := make([]interface{}, len(column))
+		for j, oneColumn := range column {
+			value[j] = oneColumn.Value(table[i])
+		}
+		return value
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, oneFailedRow := range failedRow {
+		failedScOmsRow = append(failedScOmsRow, table[oneFailedRow.Index])
+		failedScOmsRow[len(failedScOmsRow)-1].Err = oneFailedRow.Err
+	}
+	return failedScOmsRow, nil
+}
+
+// Insert inserts rowCount rows into the columns columnName of the SQLite table tableName in a single transaction,
+// BatchSize rows per INSERT statement; value returns the values of the row i in the order of columnName
+// - a batch which fails is inserted again row by row to return the rows which could not be inserted: all the other rows are inserted
+// - err is only returned if the transaction itself fails, then no row is inserted
+func Insert(db *sql.DB, tableName string, columnName []string, rowCount int, value func(i int) []interface{}) (failedRow []FailedRow, err error) {
+
+	if rowCount == 0 {
+		return nil, nil
+	}
+	batchSize := BatchSize
+	if batchSize*len(columnName) > maxVariable {
+		batchSize = maxVariable / len(columnName)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("insert into %s table: %w", tableName, err)
+	}
+	// Rollback does nothing once tx is committed
+	defer tx.Rollback()
+
+	insertBatch, err := tx.Prepare(insertStr(tableName, columnName, batchSize))
+	if err != nil {
+		return nil, fmt.Errorf("insert into %s table: %w", tableName, err)
+	}
+	defer insertBatch.Close()
+	insertRow, err := tx.Prepare(insertStr(tableName, columnName, 1))
+	if err != nil {
+		return nil, fmt.Errorf("insert into %s table: %w", tableName, err)
+	}
+	defer insertRow.Close()
+
+	for first := 0; first < rowCount; first += batchSize {
+
+		// the last batch is usually not full, it is inserted row by row
+		if first+batchSize <= rowCount {
+			var batchValue []interface{}
+			for i := first; i < first+batchSize; i++ {
+				batchValue = append(batchValue, value(i)...)
+			}
+			_, err = insertBatch.Exec(batchValue...)
+			if err == nil {
+				continue
+			}
+		}
+
+		// FYI: a failed statement does not roll the transaction back in SQLite, only the statement itself
+		for i := first; i < first+batchSize && i < rowCount; i++ {
+			_, err = insertRow.Exec(value(i)...)
+			if err != nil {
+				failedRow = append(failedRow, FailedRow{Index: i, Err: err.Error()})
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("insert into %s table: %w", tableName, err)
+	}
+	return failedRow, nil
+}
+
+// Err returns an error listing failedRow of the SQLite table tableName, or nil if no row failed,
+// for the tables whose rows are all required to go on with the booking process
+func Err(tableName string, failedRow []FailedRow) error {
+	if len(failedRow) == 0 {
+		return nil
+	}
+	return fmt.Errorf("insert into %s table: %d rows could not be inserted, e.g. row %d: %s", tableName, len(failedRow), failedRow[0].Index, failedRow[0].Err)
+}
+
+// insertStr returns the INSERT statement of rowCount rows into the columns columnName of the SQLite table tableName
+func insertStr(tableName string, columnName []string, rowCount int) string {
+	rowStr := `(?` + strings.Repeat(`, ?`, len(columnName)-1) + `)`
+	return `INSERT INTO ` + tableName + ` (
+		` + strings.Join(columnName, `
+		,`) + `)
+	VALUES ` + rowStr + strings.Repeat(`
+	,`+rowStr, rowCount-1)
+}
@@ -0,0 +1,155 @@
+package bulkload
+
+import (
+	"database/sql"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+
+	// SQLite driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTable opens an in-memory SQLite database with the table t of columnCount columns c0, c1... NOT NULL
+func openTable(t *testing.T, columnCount int) (db *sql.DB, columnName []string) {
+	t.Helper()
+	db, err := sql.Open(`sqlite3`, `:memory:`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one connection: the in-memory database is per connection
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	var columnDefinition []string
+	for i := 0; i < columnCount; i++ {
+		columnName = append(columnName, `c`+strconv.Itoa(i))
+		columnDefinition = append(columnDefinition, columnName[i]+` INTEGER NOT NULL`)
+	}
+	_, err = db.Exec(`CREATE TABLE t (` + strings.Join(columnDefinition, `, `) + `)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, columnName
+}
+
+func TestInsert(t *testing.T) {
+	tests := []struct {
+		name        string
+		columnCount int
+		rowCount    int
+		// nullRow are the rows with a NULL value, which cannot be inserted
+		nullRow       []int
+		wantFailedRow []int
+	}{
+		{name: "no row", columnCount: 2, rowCount: 0},
+		{name: "less than a batch", columnCount: 2, rowCount: 3},
+		{name: "full batches and the last batch row by row", columnCount: 2, rowCount: 2*BatchSize + 203},
+		{name: "batches limited by the number of variables", columnCount: 3, rowCount: 1000},
+		{name: "failed rows of full batches and of the last batch", columnCount: 2, rowCount: 2*BatchSize + 203, nullRow: []int{7, BatchSize, 2*BatchSize + 100}, wantFailedRow: []int{7, BatchSize, 2*BatchSize + 100}},
+		{name: "every row failed", columnCount: 1, rowCount: 2, nullRow: []int{0, 1}, wantFailedRow: []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, columnName := openTable(t, tt.columnCount)
+			isNull := make(map[int]bool)
+			for _, i := range tt.nullRow {
+				isNull[i] = true
+			}
+			failedRow, err := Insert(db, `t`, columnName, tt.rowCount, func(i int) []interface{} {
+				value := make([]interface{}, tt.columnCount)
+				for j := range value {
+					value[j] = i*10 + j
+				}
+				if isNull[i] {
+					value[tt.columnCount-1] = nil
+				}
+				return value
+			})
+			if err != nil {
+				t.Fatalf("Insert() error = %v", err)
+			}
+
+			var gotFailedRow []int
+			for _, row := range failedRow {
+				gotFailedRow = append(gotFailedRow, row.Index)
+				if !strings.Contains(row.Err, `NOT NULL`) {
+					t.Errorf("Insert() failed row %d error = %s, want a NOT NULL error", row.Index, row.Err)
+				}
+			}
+			if !reflect.DeepEqual(gotFailedRow, tt.wantFailedRow) {
+				t.Errorf("Insert() failed rows = %v, want %v", gotFailedRow, tt.wantFailedRow)
+			}
+
+			// every other row is inserted once, with its values in the order of columnName: the value of column j of row i is i*10 + j
+			lastColumn := strconv.Itoa(tt.columnCount - 1)
+			var rowCount, checkedRowCount int
+			err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(c0 % 10 = 0 AND c`+lastColumn+` - c0 = `+lastColumn+`), 0) FROM t`).Scan(&rowCount, &checkedRowCount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.rowCount - len(tt.wantFailedRow); rowCount != want || checkedRowCount != want {
+				t.Errorf("Insert() inserted %d rows (%d with the right values), want %d", rowCount, checkedRowCount, want)
+			}
+			var distinctRowCount int
+			err = db.QueryRow(`SELECT COUNT(DISTINCT c0) FROM t`).Scan(&distinctRowCount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if distinctRowCount != rowCount {
+				t.Errorf("Insert() inserted %d rows but %d distinct rows", rowCount, distinctRowCount)
+			}
+		})
+	}
+}
+
+func TestInsertMissingTable(t *testing.T) {
+	db, columnName := openTable(t, 1)
+	_, err := Insert(db, `missing`, columnName, 1, func(i int) []interface{} { return []interface{}{i} })
+	if err == nil {
+		t.Errorf("Insert() into a missing table error = nil, want an error")
+	}
+}
+
+func TestInsertScOmsTable(t *testing.T) {
+	db, _ := openTable(t, 2)
+	table := []scomsrow.ScOmsRow{{IDTransaction: 1, OrderNr: `10`}, {IDTransaction: 2}, {IDTransaction: 3, OrderNr: `30`}}
+	column := []ScOmsColumn{
+		{Name: `c0`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.IDTransaction }},
+		{Name: `c1`, Value: func(row scomsrow.ScOmsRow) interface{} {
+			if row.OrderNr == `` {
+				return nil
+			}
+			return row.OrderNr
+		}},
+	}
+	failedScOmsRow, err := InsertScOmsTable(db, `t`, column, table)
+	if err != nil {
+		t.Fatalf("InsertScOmsTable() error = %v", err)
+	}
+	if len(failedScOmsRow) != 1 || failedScOmsRow[0].IDTransaction != 2 || failedScOmsRow[0].Err == `` {
+		t.Errorf("InsertScOmsTable() failed rows = %+v, want the row of id_transaction 2 with its error", failedScOmsRow)
+	}
+	if table[1].Err != `` {
+		t.Errorf("InsertScOmsTable() changed the error of table")
+	}
+}
+
+func TestErr(t *testing.T) {
+	if err := Err(`t`, nil); err != nil {
+		t.Errorf("Err() without failed row = %v, want nil", err)
+	}
+	err := Err(`t`, []FailedRow{{Index: 4, Err: `NOT NULL constraint failed`}, {Index: 9, Err: `other`}})
+	if err == nil || err.Error() != `insert into t table: 2 rows could not be inserted, e.g. row 4: NOT NULL constraint failed` {
+		t.Errorf("Err() = %v", err)
+	}
+}
+
+func TestInsertStr(t *testing.T) {
+	got := insertStr(`t`, []string{`c0`, `c1`, `c2`}, 2)
+	if strings.Count(got, `?`) != 6 || strings.Count(got, `(?, ?, ?)`) != 2 {
+		t.Errorf("insertStr() = %s, want 2 rows of 3 values", got)
+	}
+}
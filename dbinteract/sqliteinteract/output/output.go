@@ -2,318 +2,377 @@ package output
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"path/filepath"
+	"strings"
 
 	"github.com/joho/sqltocsv"
 
-	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+	"github.com/thomas-bamilo/financebooking/chartofaccount"
+	"github.com/thomas-bamilo/financebooking/money"
+	"github.com/thomas-bamilo/financebooking/postingrule"
+	"github.com/thomas-bamilo/financebooking/row/transactiontyperow"
+	"github.com/thomas-bamilo/financebooking/runstate"
 )
 
-const ledgerBookedAtSubledgerLevel = `'13004','33001','31006','33002','84006','32021','94001'`
+// CreateLedgerAmountView compiles the posting rules of ledgerAmountView, see postingrule.PostingRule:
+// Account Code, Account Free and Amount of each posting rule
+// to create ledgerAmountView SQLite table
+func CreateLedgerAmountView(db *sql.DB, ledgerAmountView string, postingRule []postingrule.PostingRule, chartOfAccount chartofaccount.ChartOfAccount) error {
 
-// CreateVoucherLedgerAmountView unions ipc_final and ipt_final,
-// defines Account Code (62002), Account Free (null) and Amount (voucher)
-// to create voucher_ledger_amount SQLite table
-func CreateVoucherLedgerAmountView(db *sql.DB) {
+	createLedgerAmountViewStr := postingrule.LedgerAmountViewSQL(ledgerAmountView, postingRule, chartOfAccount)
 
-	createVoucherLedgerAmountViewStr := `
-	CREATE VIEW voucher_ledger_amount AS
-	SELECT 
-		vla.'Account Code'
-		,vla.'Account Free'
-		,SUM(vla.Amount) 'Amount'
-	FROM
-	(SELECT 
-		62002 'Account Code'
-		,NULL 'Account Free'
-		,ipc_final.voucher 'Amount'
-	FROM ipc_final
-	UNION ALL
-	SELECT 
-		62002 'Account Code'
-		,NULL 'Account Free'
-		,ipt_final.voucher 'Amount'
-	FROM ipt_final) vla
-	GROUP BY vla.'Account Code', vla.'Account Free'
-	`
-
-	createVoucherLedgerAmountView, err := db.Prepare(createVoucherLedgerAmountViewStr)
-	checkError(err)
-	createVoucherLedgerAmountView.Exec()
+	createLedgerAmountView, err := db.Prepare(createLedgerAmountViewStr)
+	if err != nil {
+		return fmt.Errorf("create view %s: %w", ledgerAmountView, err)
+	}
+	defer createLedgerAmountView.Close()
+	_, err = createLedgerAmountView.Exec()
+	if err != nil {
+		return fmt.Errorf("create view %s: %w", ledgerAmountView, err)
+	}
 
+	return nil
 }
 
-// CreateIpcPaidPriceLedgerAmountView defines:
-// Account Code (ipc_final.ledger), Account Free (ipc_final.subledger) and Amount (ipc_final.paid_price)
-// to create ipc_paid_price_ledger_amount SQLite table
-func CreateIpcPaidPriceLedgerAmountView(db *sql.DB) {
-
-	createIpcPaidPriceLedgerAmountViewStr := `
-	CREATE VIEW ipc_paid_price_ledger_amount AS
-	SELECT 
-		ipc_final.ledger 'Account Code'
-		,ipc_final.subledger 'Account Free'
-		,ipc_final.paid_price 'Amount'
-	FROM ipc_final
-	WHERE ipc_final.ledger IN(` + ledgerBookedAtSubledgerLevel + `)
-	GROUP BY ipc_final.ledger, ipc_final.subledger
-	`
+// UNDERSTAND THIS BLANK LEDGER STUFF, MAYBE WE NEED TO STILL RECORD VOUCHERS EVEN IF NO LEDGER MAP
+// WARNING!! IF DIFFERENCE IN VOUCHER AMOUNT BETWEEN THIS AND R THEN CHECK THIS
 
-	createIpcPaidPriceLedgerAmountView, err := db.Prepare(createIpcPaidPriceLedgerAmountViewStr)
-	checkError(err)
-	createIpcPaidPriceLedgerAmountView.Exec()
+// CreateTotalLedgerAmountView compiles all the posting rules into their counterpart:
+// Account Code (chartofaccount.SellerPayable), Account Free (beneficiary_code), Amount (depending on the posting rule)
+// and Source View (the ledger amount view of the posting rule)
+// to create total_ledger_amount_source and total_ledger_amount SQLite tables.
+func CreateTotalLedgerAmountView(db *sql.DB, postingRule []postingrule.PostingRule, chartOfAccount chartofaccount.ChartOfAccount) error {
 
-}
+	// total_ledger_amount_source keeps the Source View of each amount booked on chartofaccount.SellerPayable
+	// to break the balance of the NGS template down by Source View
+	createTotalLedgerAmountSourceViewStr := postingrule.SellerPayableSourceSQL(`total_ledger_amount_source`, postingRule, chartOfAccount)
 
-// CreateIptPaidPriceLedgerAmountView defines:
-// Account Code (ipt_final.ledger), Account Free (ipt_final.subledger) and Amount (ipt_final.paid_price)
-// to create ipt_paid_price_ledger_amount SQLite table
-func CreateIptPaidPriceLedgerAmountView(db *sql.DB) {
+	createTotalLedgerAmountSourceView, err := db.Prepare(createTotalLedgerAmountSourceViewStr)
+	if err != nil {
+		return fmt.Errorf("create view total_ledger_amount_source: %w", err)
+	}
+	defer createTotalLedgerAmountSourceView.Close()
+	_, err = createTotalLedgerAmountSourceView.Exec()
+	if err != nil {
+		return fmt.Errorf("create view total_ledger_amount_source: %w", err)
+	}
 
-	createIptPaidPriceLedgerAmountViewStr := `
-	CREATE VIEW ipt_paid_price_ledger_amount AS
+	createTotalLedgerAmountViewStr := `
+	CREATE VIEW total_ledger_amount AS
 	SELECT 
-		ipt_final.ledger 'Account Code'
-		,ipt_final.subledger 'Account Free'
-		,ipt_final.paid_price 'Amount'
-	FROM ipt_final
-	WHERE ipt_final.ledger IN(` + ledgerBookedAtSubledgerLevel + `)
-	GROUP BY ipt_final.ledger, ipt_final.subledger
+	total.'Account Code'
+	,total.'Account Free'
+	,SUM(total.Amount*-1) 'Amount' -- (-1) because total + sum of amounts should = 0
+	FROM total_ledger_amount_source total
+	GROUP BY total.'Account Code', total.'Account Free'
 	`
 
-	createIptPaidPriceLedgerAmountView, err := db.Prepare(createIptPaidPriceLedgerAmountViewStr)
-	checkError(err)
-	createIptPaidPriceLedgerAmountView.Exec()
+	createTotalLedgerAmountView, err := db.Prepare(createTotalLedgerAmountViewStr)
+	if err != nil {
+		return fmt.Errorf("create view total_ledger_amount: %w", err)
+	}
+	defer createTotalLedgerAmountView.Close()
+	_, err = createTotalLedgerAmountView.Exec()
+	if err != nil {
+		return fmt.Errorf("create view total_ledger_amount: %w", err)
+	}
 
+	return nil
 }
 
-// CreateCommissionVatLedgerAmountView defines:
-// Account Code (32021), Account Free (NULL) and Amount (commission_final.commission_vat)
-// to create commission_vat_ledger_amount SQLite table
-func CreateCommissionVatLedgerAmountView(db *sql.DB) {
+// ReturnBookedTransactionValue returns the row count and total transaction_value
+// of the rows of the final views booked into the NGS template by at least one rule of postingRule
+func ReturnBookedTransactionValue(db *sql.DB, postingRule []postingrule.PostingRule) (rowCount int, transactionValue money.Rial, err error) {
+
+	selectSourceViewStr := postingrule.BookedSourceViewSQL(postingRule)
 
-	createCommissionVatLedgerAmountViewStr := `
-	CREATE VIEW commission_vat_ledger_amount AS
+	query := `
 	SELECT 
-	cf.'Account Code'
-	,cf.'Account Free'
-	,SUM(cf.Amount) 'Amount'
-	FROM 
-	(SELECT 
-		32021 'Account Code'
-		,NULL 'Account Free'
-		,commission_final.commission_vat 'Amount'
-	FROM commission_final) cf
-	GROUP BY cf.'Account Code', cf.'Account Free'
+	COUNT(*) 'row_count'
+	,COALESCE(SUM(booked.transaction_value),0) 'transaction_value'
+	FROM (` + strings.Join(selectSourceViewStr, `
+	UNION ALL`) + `
+	) booked
 	`
 
-	createCommissionVatLedgerAmountView, err := db.Prepare(createCommissionVatLedgerAmountViewStr)
-	checkError(err)
-	createCommissionVatLedgerAmountView.Exec()
+	err = db.QueryRow(query).Scan(&rowCount, &transactionValue)
+	if err != nil {
+		return 0, 0, fmt.Errorf("query booked transaction value: %w", err)
+	}
 
+	return rowCount, transactionValue, nil
 }
 
-// CreateCommissionRevenueLedgerAmountView defines:
-// Account Code (62001), Account Free (commission_final.beneficiary_code) and Amount (commission_final.commission_revenue)
-// to create commission_revenue_ledger_amount SQLite table
-func CreateCommissionRevenueLedgerAmountView(db *sql.DB) {
+// ReturnBookedTransactionValueByTransactionType returns the row count and total transaction_value by transaction_type
+// of the rows of the final views booked into the NGS template by at least one rule of postingRule
+func ReturnBookedTransactionValueByTransactionType(db *sql.DB, postingRule []postingrule.PostingRule) ([]transactiontyperow.TransactionTypeRow, error) {
+
+	selectSourceViewStr := postingrule.BookedSourceViewSQL(postingRule)
 
-	createCommissionRevenueLedgerAmountViewStr := `
-	CREATE VIEW commission_revenue_ledger_amount AS
+	query := `
 	SELECT 
-	cr.'Account Code'
-	,cr.'Account Free'
-	,SUM(cr.'Amount') 'Amount'
-	FROM 
-	(SELECT 
-		62001 'Account Code'
-		,commission_final.beneficiary_code 'Account Free'
-		,commission_final.commission_revenue 'Amount'
-	FROM commission_final) cr
-	GROUP BY cr.'Account Code', cr.'Account Free'
+	booked.transaction_type
+	,COUNT(*) 'row_count'
+	,COALESCE(SUM(booked.transaction_value),0) 'transaction_value'
+	FROM (` + strings.Join(selectSourceViewStr, `
+	UNION ALL`) + `
+	) booked
+	GROUP BY booked.transaction_type
+	ORDER BY booked.transaction_type
 	`
 
-	createCommissionRevenueLedgerAmountView, err := db.Prepare(createCommissionRevenueLedgerAmountViewStr)
-	checkError(err)
-	createCommissionRevenueLedgerAmountView.Exec()
-
+	bookedTable, err := returnTransactionTypeTable(db, query)
+	if err != nil {
+		return nil, fmt.Errorf("query booked transaction value by transaction type: %w", err)
+	}
+	return bookedTable, nil
 }
 
-// UNDERSTAND THIS BLANK LEDGER STUFF, MAYBE WE NEED TO STILL RECORD VOUCHERS EVEN IF NO LEDGER MAP
-// WARNING!! IF DIFFERENCE IN VOUCHER AMOUNT BETWEEN THIS AND R THEN CHECK THIS
+// ReturnSellerPayableByTransactionType returns the row count and total Transaction Value by Transaction Type of total_ledger_amount_source:
+// the amounts of the lines of total_ledger_amount in the NGS template with the sign of transaction_value
+func ReturnSellerPayableByTransactionType(db *sql.DB) ([]transactiontyperow.TransactionTypeRow, error) {
 
-// CreateTotalLedgerAmountView unions:
-// ipc_voucher_ledger_amount, ipt_voucher_ledger_amount,
-// ipc_paid_price_ledger_amount, ipt_paid_price_ledger_amount,
-// commission_vat_ledger_amount and commission_revenue_ledger_amount;
-// and defines Account Code (31002), Account Free (beneficiary_code) and Amount (depending on the table)
-// to create total_ledger_amount SQLite table.
-func CreateTotalLedgerAmountView(db *sql.DB) {
-
-	// ipc_paid_price_ledger_amount: in R, no filter is used here...
-	// which makes me think filtering by ledgerBookedAtSubledgerLevel is useless in the original ipc_paid_price_ledger_amount...
-	// yes, I think in R it is only useful for the commission booking which is bullshit and you changed here so now no need of filter probably
-	createTotalLedgerAmountViewStr := `
-	CREATE VIEW total_ledger_amount AS
+	query := `
 	SELECT 
-	total.'Account Code'
-	,total.'Account Free'
-	,SUM(total.Amount*-1) 'Amount' -- (-1) because total + sum of amounts should = 0
-
-	FROM (
-
-	-- ipc_voucher_ledger_amount
-	SELECT
-		31002 'Account Code'
-		,ipc_final.beneficiary_code 'Account Free'
-		,ipc_final.voucher 'Amount'
-	FROM ipc_final
+	tlas.'Transaction Type'
+	,COUNT(*) 'row_count'
+	,COALESCE(SUM(tlas.'Transaction Value'),0) 'transaction_value'
+	FROM total_ledger_amount_source tlas
+	GROUP BY tlas.'Transaction Type'
+	ORDER BY tlas.'Transaction Type'
+	`
 
-	UNION ALL
+	sellerPayableTable, err := returnTransactionTypeTable(db, query)
+	if err != nil {
+		return nil, fmt.Errorf("query seller payable by transaction type: %w", err)
+	}
+	return sellerPayableTable, nil
+}
 
-	-- ipt_voucher_ledger_amount
-	SELECT 
-		31002 'Account Code'
-		,ipt_final.beneficiary_code 'Account Free'
-		,ipt_final.voucher 'Amount'
-	FROM ipt_final
+// returnTransactionTypeTable returns the transaction type, row count and transaction value of each row of query
+func returnTransactionTypeTable(db *sql.DB, query string) ([]transactiontyperow.TransactionTypeRow, error) {
 
-	UNION ALL
+	var transactionType sql.NullString
+	var rowCount int
+	var transactionValue money.Rial
+	var transactionTypeTable []transactiontyperow.TransactionTypeRow
 
-	-- ipc_paid_price_ledger_amount
-	SELECT 
-		31002 'Account Code'
-		,ipc_final.beneficiary_code 'Account Free'
-		,ipc_final.paid_price 'Amount'
-	FROM ipc_final
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	UNION ALL
+	for rows.Next() {
+		err := rows.Scan(&transactionType, &rowCount, &transactionValue)
+		if err != nil {
+			return nil, err
+		}
+		transactionTypeTable = append(transactionTypeTable,
+			transactiontyperow.TransactionTypeRow{
+				TransactionType:  transactionType.String,
+				RowCount:         rowCount,
+				TransactionValue: transactionValue,
+			})
+	}
 
-	-- ipt_paid_price_ledger_amount
-	SELECT 
-		31002 'Account Code'
-		,ipt_final.beneficiary_code 'Account Free'
-		,ipt_final.paid_price 'Amount'
-	FROM ipt_final
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	UNION ALL
+	return transactionTypeTable, nil
+}
 
-	-- commission_vat_ledger_amount
-	SELECT 
-		31002 'Account Code'
-		,commission_final.beneficiary_code 'Account Free'
-		,commission_final.commission_vat 'Amount'
-	FROM commission_final
+// ReturnSellerPayableAmount returns the row count and total Amount of the lines of the NGS template
+// booked on chartofaccount.SellerPayable: total_ledger_amount and the rows of the ledger amount views of postingRule booked on it
+func ReturnSellerPayableAmount(db *sql.DB, postingRule []postingrule.PostingRule, chartOfAccount chartofaccount.ChartOfAccount) (rowCount int, amount money.Rial, err error) {
 
-	UNION ALL
+	sellerPayable := chartOfAccount[chartofaccount.SellerPayable]
+	var selectSourceViewStr []string
+	for _, sourceView := range ngsIpcIptCSourceView(postingRule) {
+		selectSourceViewStr = append(selectSourceViewStr, `
+		SELECT `+sourceView+`.'Amount' FROM `+sourceView+`
+		WHERE CAST(`+sourceView+`.'Account Code' AS TEXT) = '`+sellerPayable+`'`)
+	}
 
-	-- commission_revenue_ledger_amount
+	query := `
 	SELECT 
-		31002 'Account Code'
-		,commission_final.beneficiary_code 'Account Free'
-		,commission_final.commission_revenue 'Amount'
-	FROM commission_final	
-	
-	) total
-
-	GROUP BY total.'Account Code', total.'Account Free'
+	COUNT(*) 'row_count'
+	,COALESCE(SUM(sellerpayable.'Amount'),0) 'Amount'
+	FROM (` + strings.Join(selectSourceViewStr, `
+		UNION ALL`) + `
+	) sellerpayable
 	`
 
-	createTotalLedgerAmountView, err := db.Prepare(createTotalLedgerAmountViewStr)
-	checkError(err)
-	createTotalLedgerAmountView.Exec()
+	err = db.QueryRow(query).Scan(&rowCount, &amount)
+	if err != nil {
+		return 0, 0, fmt.Errorf("query seller payable amount: %w", err)
+	}
+
+	return rowCount, amount, nil
 }
 
-func DownloadToCsvTest(db *sql.DB, tableName string) {
+// DownloadToCsvTest writes tableName to a csv file stamped with the booking period and the ID of run, in the directory of run
+func DownloadToCsvTest(db *sql.DB, tableName string, run *runstate.Run) error {
 
 	query := `SELECT 
 	COALESCE(` + tableName + `.'Account Code','') 'Account Code',
 	COALESCE(` + tableName + `.'Account Free','') 'Account Free',
 	COALESCE(` + tableName + `.'Amount','') 'Amount'
 	FROM ` + tableName
-	var accountCode, accountFree, amount string
-	var ngsTemplate []scomsrow.NgsRow
 
 	rows, err := db.Query(query)
-	checkError(err)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", tableName, err)
+	}
+	defer rows.Close()
 
-	for rows.Next() {
-		err := rows.Scan(&accountCode, &accountFree, &amount)
-		checkError(err)
-		ngsTemplate = append(ngsTemplate,
-			scomsrow.NgsRow{
-				AccountCode: accountCode,
-				AccountFree: accountFree,
-				Amount:      amount,
-			})
-		err = sqltocsv.WriteFile(tableName+".csv", rows)
-		checkError(err)
+	// write all the rows at once: a row scanned before sqltocsv.WriteFile would be left out of the csv file
+	err = sqltocsv.WriteFile(run.FileName(tableName+".csv"), rows)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", tableName, err)
 	}
 
+	return nil
 }
 
-// ReturnNgsIpcIptC
-func ReturnNgsIpcIptC(db *sql.DB) {
+// ngsIpcIptCSourceView lists the ledger amount views of postingRule unioned into the NGS template, in order
+func ngsIpcIptCSourceView(postingRule []postingrule.PostingRule) []string {
+	return append(postingrule.LedgerAmountView(postingRule), `total_ledger_amount`)
+}
 
-	query := `
+// ReturnNgsIpcIptC unions all the ledger amount views of postingRule and total_ledger_amount
+// into ngs_template_ipc_ipt_c SQLite view and writes it to ngsTemplateIpcIptC.csv stamped with the booking period and the ID of run, in the directory of run
+// - it first writes ngsTemplateIpcIptCBalance.csv: the balance of the NGS template broken down by Source View
+// - if the NGS template does not balance within tolerance, it returns an error to STOP the booking process
+// or, if allowUnbalancedDraft, writes the NGS template as DRAFT_UNBALANCED_ngsTemplateIpcIptC.csv
+// it returns the name of the file written
+func ReturnNgsIpcIptC(db *sql.DB, run *runstate.Run, postingRule []postingrule.PostingRule, tolerance money.Rial, allowUnbalancedDraft bool) (ngsTemplateFileName string, err error) {
+
+	var selectSourceViewStr []string
+	for _, sourceView := range ngsIpcIptCSourceView(postingRule) {
+		selectSourceViewStr = append(selectSourceViewStr, `
+		SELECT 
+		COALESCE(`+sourceView+`.'Account Code','') 'Account Code'
+		,COALESCE(`+sourceView+`.'Account Free','') 'Account Free'
+		,COALESCE(`+sourceView+`.'Amount','') 'Amount'
+		FROM `+sourceView)
+	}
+	err = createView(db, `ngs_template_ipc_ipt_c`, strings.Join(selectSourceViewStr, `
+		UNION ALL`))
+	if err != nil {
+		return ``, err
+	}
+
+	// check that total + sum of amounts = 0 before writing the NGS template
+	ngsTemplateNet, err := returnNgsIpcIptCBalance(db, run, postingRule)
+	if err != nil {
+		return ``, err
+	}
+	ngsTemplateFileName = run.FileName("ngsTemplateIpcIptC.csv")
+	if ngsTemplateNet.Abs() > tolerance {
+		ngsTemplateBalanceFileName := run.FileName("ngsTemplateIpcIptCBalance.csv")
+		if !allowUnbalancedDraft {
+			return ``, fmt.Errorf("ngsTemplateIpcIptC does not balance (net amount %s), please see %s for more details", ngsTemplateNet, ngsTemplateBalanceFileName)
+		}
+		log.Printf("WARNING: ngsTemplateIpcIptC does not balance (net amount %s), only a draft is written, please see %s for more details", ngsTemplateNet, ngsTemplateBalanceFileName)
+		ngsTemplateFileName = filepath.Join(run.Dir(), `DRAFT_UNBALANCED_`+filepath.Base(ngsTemplateFileName))
+	}
+
+	rows, err := db.Query(`SELECT * FROM ngs_template_ipc_ipt_c`)
+	if err != nil {
+		return ``, fmt.Errorf("query ngsTemplateIpcIptC: %w", err)
+	}
+	defer rows.Close()
+
+	// write all the rows at once: a row scanned before sqltocsv.WriteFile would be left out of the template
+	// and the template would not reconcile with Seller Center data
+	err = sqltocsv.WriteFile(ngsTemplateFileName, rows)
+	if err != nil {
+		return ``, fmt.Errorf("write %s: %w", ngsTemplateFileName, err)
+	}
+
+	return ngsTemplateFileName, nil
+}
+
+// returnNgsIpcIptCBalance creates ngs_template_ipc_ipt_c_balance SQLite view
+// and writes it to ngsTemplateIpcIptCBalance.csv stamped with the booking period and the ID of run, in the directory of run:
+// for each ledger amount view of postingRule, its Amount, its counterpart in total_ledger_amount and their Net
+// and returns the net amount of the whole NGS template
+func returnNgsIpcIptCBalance(db *sql.DB, run *runstate.Run, postingRule []postingrule.PostingRule) (ngsTemplateNet money.Rial, err error) {
+
+	// total_ledger_amount is broken down by Source View thanks to total_ledger_amount_source
+	var selectSourceViewStr []string
+	for _, sourceView := range ngsIpcIptCSourceView(postingRule) {
+		if sourceView == `total_ledger_amount` {
+			continue
+		}
+		selectSourceViewStr = append(selectSourceViewStr, `
 		SELECT 
-		COALESCE(vla.'Account Code','') 'Account Code'
-		,COALESCE(vla.'Account Free','') 'Account Free'
-		,COALESCE(vla.'Amount','') 'Amount'
-		FROM voucher_ledger_amount vla
-		UNION ALL
-		SELECT
-		COALESCE(ippla.'Account Code','') 'Account Code'
-		,COALESCE(ippla.'Account Free','') 'Account Free'
-		,COALESCE(ippla.'Amount','') 'Amount'
-		FROM ipc_paid_price_ledger_amount ippla
-		UNION ALL
+		'`+sourceView+`' 'Source View'
+		,COALESCE(`+sourceView+`.'Amount',0) 'Amount'
+		,0 'Total Amount'
+		FROM `+sourceView)
+	}
+	selectSourceViewStr = append(selectSourceViewStr, `
 		SELECT 
-		COALESCE(ipplab.'Account Code','') 'Account Code'
-		,COALESCE(ipplab.'Account Free','') 'Account Free'
-		,COALESCE(ipplab.'Amount' ,'') 'Amount'
-		FROM ipt_paid_price_ledger_amount ipplab
-		UNION ALL
-		SELECT
-		COALESCE(cvla.'Account Code','') 'Account Code'
-		,COALESCE(cvla.'Account Free','') 'Account Free'
-		,COALESCE(cvla.'Amount' ,'') 'Amount'
-		FROM commission_vat_ledger_amount cvla
-		UNION ALL
-		SELECT
-		COALESCE(crla.'Account Code','') 'Account Code'
-		,COALESCE(crla.'Account Free','') 'Account Free'
-		,COALESCE(crla.'Amount','') 'Amount'
-		FROM commission_revenue_ledger_amount crla
-		UNION ALL
-		SELECT
-		COALESCE(tla.'Account Code','') 'Account Code'
-		,COALESCE(tla.'Account Free','') 'Account Free'
-		,COALESCE(tla.'Amount','') 'Amount'
-		FROM total_ledger_amount tla
+		tlas.'Source View'
+		,0 'Amount'
+		,COALESCE(tlas.'Amount',0)*-1 'Total Amount'
+		FROM total_ledger_amount_source tlas`)
+
+	query := `
+	SELECT 
+	balance.'Source View'
+	,SUM(balance.'Amount') 'Amount'
+	,SUM(balance.'Total Amount') 'Total Amount'
+	,SUM(balance.'Amount') + SUM(balance.'Total Amount') 'Net'
+	FROM (` + strings.Join(selectSourceViewStr, `
+		UNION ALL`) + `
+	) balance
+	GROUP BY balance.'Source View'
 	`
-	var accountCode, accountFree, amount string
-	var ngsTemplate []scomsrow.NgsRow
+	err = createView(db, `ngs_template_ipc_ipt_c_balance`, query)
+	if err != nil {
+		return 0, err
+	}
 
-	rows, err := db.Query(query)
-	checkError(err)
+	err = db.QueryRow(`SELECT COALESCE(SUM(balance.Net),0) FROM ngs_template_ipc_ipt_c_balance balance`).Scan(&ngsTemplateNet)
+	if err != nil {
+		return 0, fmt.Errorf("query ngsTemplateIpcIptC balance: %w", err)
+	}
 
-	for rows.Next() {
-		err := rows.Scan(&accountCode, &accountFree, &amount)
-		checkError(err)
-		ngsTemplate = append(ngsTemplate,
-			scomsrow.NgsRow{
-				AccountCode: accountCode,
-				AccountFree: accountFree,
-				Amount:      amount,
-			})
-		err = sqltocsv.WriteFile("ngsTemplateIpcIptC.csv", rows)
-		checkError(err)
+	rows, err := db.Query(`SELECT * FROM ngs_template_ipc_ipt_c_balance`)
+	if err != nil {
+		return 0, fmt.Errorf("query ngsTemplateIpcIptC balance: %w", err)
+	}
+	defer rows.Close()
+
+	err = sqltocsv.WriteFile(run.FileName("ngsTemplateIpcIptCBalance.csv"), rows)
+	if err != nil {
+		return 0, fmt.Errorf("write ngsTemplateIpcIptCBalance.csv: %w", err)
 	}
+
+	return ngsTemplateNet, nil
 }
 
-func checkError(err error) {
+// createView creates the SQLite view viewName from the SELECT statement query
+// so that the templates can be investigated in the SQLite database of the run
+func createView(db *sql.DB, viewName, query string) error {
+
+	createViewStr := `CREATE VIEW ` + viewName + ` AS ` + query
+
+	createView, err := db.Prepare(createViewStr)
 	if err != nil {
-		log.Fatal(err.Error())
+		return fmt.Errorf("create view %s: %w", viewName, err)
 	}
+	defer createView.Close()
+	_, err = createView.Exec()
+	if err != nil {
+		return fmt.Errorf("create view %s: %w", viewName, err)
+	}
+
+	return nil
 }
@@ -0,0 +1,104 @@
+package output
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thomas-bamilo/financebooking/bookingperiod"
+	"github.com/thomas-bamilo/financebooking/money"
+	"github.com/thomas-bamilo/financebooking/postingrule"
+	"github.com/thomas-bamilo/financebooking/runstate"
+
+	// SQLite driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openLedgerAmount opens an in-memory SQLite database with commission_revenue_ledger_amount of amount
+// and its counterpart total in total_ledger_amount and total_ledger_amount_source
+func openLedgerAmount(t *testing.T, amount, total money.Rial) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(`sqlite3`, `:memory:`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one connection: the in-memory database is per connection
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	for _, query := range []string{
+		`CREATE TABLE commission_revenue_ledger_amount ('Account Code' INTEGER, 'Account Free' TEXT, 'Amount' INTEGER)`,
+		`CREATE TABLE total_ledger_amount ('Account Code' INTEGER, 'Account Free' TEXT, 'Amount' INTEGER)`,
+		`CREATE TABLE total_ledger_amount_source ('Source View' TEXT, 'Amount' INTEGER)`,
+	} {
+		if _, err = db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO commission_revenue_ledger_amount VALUES (41001, '', ?)`, int64(amount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO total_ledger_amount VALUES (31002, '1234', ?)`, int64(-total))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO total_ledger_amount_source VALUES ('commission_revenue_ledger_amount', ?)`, int64(total))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestReturnNgsIpcIptC(t *testing.T) {
+	postingRule := []postingrule.PostingRule{{LedgerAmountView: `commission_revenue_ledger_amount`}}
+	tests := []struct {
+		name                 string
+		total                money.Rial
+		allowUnbalancedDraft bool
+		wantErr              bool
+		// wantPrefix is the prefix of the base name of the file written
+		wantPrefix string
+	}{
+		{name: "balanced", total: 1000, wantPrefix: `ngsTemplateIpcIptC_`},
+		{name: "balanced within tolerance", total: 999, wantPrefix: `ngsTemplateIpcIptC_`},
+		{name: "unbalanced", total: 900, wantErr: true},
+		{name: "unbalanced draft", total: 900, allowUnbalancedDraft: true, wantPrefix: `DRAFT_UNBALANCED_ngsTemplateIpcIptC_`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bookingPeriod, err := bookingperiod.FromMonth(4, 2018)
+			if err != nil {
+				t.Fatal(err)
+			}
+			run, err := runstate.Create(t.TempDir(), `2018-04_20180502-093000`, bookingPeriod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db := openLedgerAmount(t, 1000, tt.total)
+
+			ngsTemplateFileName, err := ReturnNgsIpcIptC(db, run, postingRule, 1, tt.allowUnbalancedDraft)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReturnNgsIpcIptC() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := filepath.Dir(ngsTemplateFileName); got != run.Dir() {
+				t.Errorf("ReturnNgsIpcIptC() directory = %s, want %s", got, run.Dir())
+			}
+			if got := filepath.Base(ngsTemplateFileName); !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("ReturnNgsIpcIptC() file = %s, want prefix %s", got, tt.wantPrefix)
+			}
+			ngsTemplate, err := os.ReadFile(ngsTemplateFileName)
+			if err != nil {
+				t.Fatalf("read NGS template: %v", err)
+			}
+			// the header and one line per ledger amount
+			if got := strings.Count(string(ngsTemplate), "\n"); got != 3 {
+				t.Errorf("NGS template has %d lines, want 3:\n%s", got, ngsTemplate)
+			}
+		})
+	}
+}
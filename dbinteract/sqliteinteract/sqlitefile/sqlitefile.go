@@ -0,0 +1,83 @@
+package sqlitefile
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	// SQLite driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open opens the SQLite database file fileName, created if it does not exist,
+// so that the tables and views of a booking run can be investigated once the run is over
+func Open(fileName string) (*sql.DB, error) {
+	db, err := sql.Open(`sqlite3`, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("open SQLite database %s: %w", fileName, err)
+	}
+	// one connection: every statement sees the tables created by the previous ones
+	db.SetMaxOpenConns(1)
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open SQLite database %s: %w", fileName, err)
+	}
+	return db, nil
+}
+
+// Remove deletes the SQLite database file fileName, if any, and its journal
+func Remove(fileName string) error {
+	for _, oneFileName := range []string{fileName, fileName + `-journal`} {
+		err := os.Remove(oneFileName)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove SQLite database %s: %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+// Snapshot overwrites snapshotFileName with a copy of the SQLite database file fileName
+// FYI: the database fileName should be closed, so that the copy holds every committed statement
+// and nothing else, with any SQLite version, unlike VACUUM INTO which requires SQLite 3.27
+func Snapshot(fileName, snapshotFileName string) error {
+	err := copyDatabase(fileName, snapshotFileName)
+	if err != nil {
+		return fmt.Errorf("snapshot SQLite database %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// Restore overwrites the SQLite database file fileName with the copy snapshotFileName, see Snapshot
+// FYI: the database fileName should be closed
+func Restore(snapshotFileName, fileName string) error {
+	err := copyDatabase(snapshotFileName, fileName)
+	if err != nil {
+		return fmt.Errorf("restore SQLite database %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// copyDatabase overwrites the SQLite database file toFileName with the SQLite database file fromFileName
+func copyDatabase(fromFileName, toFileName string) error {
+	err := Remove(toFileName)
+	if err != nil {
+		return err
+	}
+	fromFile, err := os.Open(fromFileName)
+	if err != nil {
+		return err
+	}
+	defer fromFile.Close()
+	toFile, err := os.Create(toFileName)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(toFile, fromFile)
+	if err != nil {
+		toFile.Close()
+		return err
+	}
+	return toFile.Close()
+}
@@ -2,78 +2,218 @@ package transform
 
 import (
 	"database/sql"
-	"log"
-	"time"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/joho/sqltocsv"
+	"github.com/thomas-bamilo/financebooking/dbinteract/sqliteinteract/bulkload"
+	"github.com/thomas-bamilo/financebooking/money"
+	"github.com/thomas-bamilo/financebooking/row/ledgermaprow"
 	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+	"github.com/thomas-bamilo/financebooking/row/vatraterow"
+	"github.com/thomas-bamilo/financebooking/runstate"
 )
 
-// CreateLedgerMapTable creates the SQLite table ledger_map from ledgerMapTable
-func CreateLedgerMapTable(db *sql.DB, ledgerMapTable []scomsrow.ScOmsRow) {
+// CreateLedgerMapTable creates the SQLite table ledger_map from ledgerMapTable with the specificity and priority of each row
+// and the SQLite table ledger_map_match with the ledger and subledger of each distinct transaction_type, item_status, payment_method
+// and shipment_provider_name of item_price_credit_valid and item_price_valid tables, see ledgerMapJoin
+func CreateLedgerMapTable(db *sql.DB, ledgerMapTable []ledgermaprow.LedgerMapRow) error {
 
 	// create ledger_map table
 	createLedgerMapTableStr := `CREATE TABLE ledger_map (
-	ledger_map_key TEXT
+	transaction_type TEXT
+	,item_status TEXT
+	,payment_method TEXT
+	,shipment_provider_name TEXT
 	,ledger INTEGER
-	,subledger INTEGER)`
+	,subledger INTEGER
+	,specificity INTEGER
+	,priority INTEGER)`
 	createLedgerMapTable, err := db.Prepare(createLedgerMapTableStr)
-	checkError(err)
-	createLedgerMapTable.Exec()
+	if err != nil {
+		return fmt.Errorf("create ledger_map table: %w", err)
+	}
+	defer createLedgerMapTable.Close()
+	_, err = createLedgerMapTable.Exec()
+	if err != nil {
+		return fmt.Errorf("create ledger_map table: %w", err)
+	}
 
 	// insert values into ledger_map table
-	insertLedgerMapTableStr := `INSERT INTO ledger_map (
-		ledger_map_key
-		,ledger
-		,subledger) 
-	VALUES (?, ?, ?)`
-	insertLedgerMapTable, err := db.Prepare(insertLedgerMapTableStr)
-	checkError(err)
-	for i := 0; i < len(ledgerMapTable); i++ {
-
-		insertLedgerMapTable.Exec(
-			ledgerMapTable[i].LedgerMapKey,
+	failedRow, err := bulkload.Insert(db, `ledger_map`, []string{
+		`transaction_type`,
+		`item_status`,
+		`payment_method`,
+		`shipment_provider_name`,
+		`ledger`,
+		`subledger`,
+		`specificity`,
+		`priority`,
+	}, len(ledgerMapTable), func(i int) []interface{} {
+		// an empty subledger is booked as 0
+		subledger, _ := strconv.Atoi(ledgerMapTable[i].Subledger)
+		return []interface{}{
+			ledgerMapTable[i].TransactionType,
+			ledgerMapTable[i].ItemStatus,
+			ledgerMapTable[i].PaymentMethod,
+			ledgerMapTable[i].ShipmentProviderName,
 			ledgerMapTable[i].Ledger,
-			ledgerMapTable[i].Subledger,
-		)
-		time.Sleep(1 * time.Millisecond)
+			subledger,
+			ledgerMapTable[i].Specificity(),
+			ledgerMapTable[i].PriorityLevel(),
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = bulkload.Err(`ledger_map`, failedRow)
+	if err != nil {
+		return err
+	}
+
+	return createLedgerMapMatchTable(db, ledgerMapTable)
+}
+
+// createLedgerMapMatchTable creates the SQLite table ledger_map_match with the ledger and subledger of the row of ledgerMapTable
+// applying to each distinct transaction_type, item_status, payment_method and shipment_provider_name
+// of item_price_credit_valid and item_price_valid tables, see ledgermaprow.Match:
+// the mapping is resolved once per distinct key instead of once per transaction
+// the keys matching no row of ledgerMapTable are left out, their ledger and subledger are NULL in ipc_final and ipt_final
+func createLedgerMapMatchTable(db *sql.DB, ledgerMapTable []ledgermaprow.LedgerMapRow) error {
+
+	// create ledger_map_match table, its primary key indexes the join of ledgerMapJoin
+	createLedgerMapMatchTableStr := `CREATE TABLE ledger_map_match (
+	transaction_type TEXT
+	,item_status TEXT
+	,payment_method TEXT
+	,shipment_provider_name TEXT
+	,ledger INTEGER
+	,subledger INTEGER
+	,PRIMARY KEY (transaction_type, item_status, payment_method, shipment_provider_name))`
+	createLedgerMapMatchTable, err := db.Prepare(createLedgerMapMatchTableStr)
+	if err != nil {
+		return fmt.Errorf("create ledger_map_match table: %w", err)
+	}
+	defer createLedgerMapMatchTable.Close()
+	_, err = createLedgerMapMatchTable.Exec()
+	if err != nil {
+		return fmt.Errorf("create ledger_map_match table: %w", err)
+	}
 
+	// resolve the ledger and subledger of each distinct key
+	distinctKeyQuery := `
+	SELECT transaction_type, item_status, payment_method, shipment_provider_name FROM item_price_credit_valid
+	UNION
+	SELECT transaction_type, item_status, payment_method, shipment_provider_name FROM item_price_valid
+	`
+	rows, err := db.Query(distinctKeyQuery)
+	if err != nil {
+		return fmt.Errorf("query ledger_map_match keys: %w", err)
 	}
+	defer rows.Close()
 
+	var transactionType, itemStatus, paymentMethod, shipmentProviderName string
+	var ledgerMapMatchTable []ledgermaprow.LedgerMapRow
+	for rows.Next() {
+		err := rows.Scan(&transactionType, &itemStatus, &paymentMethod, &shipmentProviderName)
+		if err != nil {
+			return fmt.Errorf("scan ledger_map_match keys: %w", err)
+		}
+		match, ok := ledgermaprow.Match(ledgerMapTable, transactionType, itemStatus, paymentMethod, shipmentProviderName)
+		if !ok {
+			continue
+		}
+		ledgerMapMatchTable = append(ledgerMapMatchTable, ledgermaprow.LedgerMapRow{
+			TransactionType:      transactionType,
+			ItemStatus:           itemStatus,
+			PaymentMethod:        paymentMethod,
+			ShipmentProviderName: shipmentProviderName,
+			Ledger:               match.Ledger,
+			Subledger:            match.Subledger,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read ledger_map_match keys: %w", err)
+	}
+	err = rows.Close()
+	if err != nil {
+		return fmt.Errorf("read ledger_map_match keys: %w", err)
+	}
+
+	// insert values into ledger_map_match table
+	failedRow, err := bulkload.Insert(db, `ledger_map_match`, []string{
+		`transaction_type`,
+		`item_status`,
+		`payment_method`,
+		`shipment_provider_name`,
+		`ledger`,
+		`subledger`,
+	}, len(ledgerMapMatchTable), func(i int) []interface{} {
+		// an empty subledger is booked as 0
+		subledger, _ := strconv.Atoi(ledgerMapMatchTable[i].Subledger)
+		return []interface{}{
+			ledgerMapMatchTable[i].TransactionType,
+			ledgerMapMatchTable[i].ItemStatus,
+			ledgerMapMatchTable[i].PaymentMethod,
+			ledgerMapMatchTable[i].ShipmentProviderName,
+			ledgerMapMatchTable[i].Ledger,
+			subledger,
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return bulkload.Err(`ledger_map_match`, failedRow)
+}
+
+// ledgerMapJoin returns the join of ledger_map_match lm to tableAlias on its transaction_type, item_status, payment_method
+// and shipment_provider_name: ledger_map_match holds the row of ledger_map applying to each of them, see createLedgerMapMatchTable
+func ledgerMapJoin(tableAlias string) string {
+	return `LEFT JOIN ledger_map_match lm 
+	ON lm.transaction_type = ` + tableAlias + `.transaction_type
+	AND lm.item_status = ` + tableAlias + `.item_status
+	AND lm.payment_method = ` + tableAlias + `.payment_method
+	AND lm.shipment_provider_name = ` + tableAlias + `.shipment_provider_name`
 }
 
 // CreateBeneficiaryCodeTable creates the SQLite table beneficiary_code_map from beneficiaryCodeTable
-func CreateBeneficiaryCodeTable(db *sql.DB, beneficiaryCodeTable []scomsrow.ScOmsRow) {
+func CreateBeneficiaryCodeTable(db *sql.DB, beneficiaryCodeTable []scomsrow.ScOmsRow) error {
 
 	// create beneficiary_code_map table
 	createBeneficiaryCodeTableStr := `CREATE TABLE beneficiary_code_map (
 	short_code TEXT
 	,beneficiary_code INTEGER)`
 	createBeneficiaryCodeTable, err := db.Prepare(createBeneficiaryCodeTableStr)
-	checkError(err)
-	createBeneficiaryCodeTable.Exec()
+	if err != nil {
+		return fmt.Errorf("create beneficiary_code_map table: %w", err)
+	}
+	defer createBeneficiaryCodeTable.Close()
+	_, err = createBeneficiaryCodeTable.Exec()
+	if err != nil {
+		return fmt.Errorf("create beneficiary_code_map table: %w", err)
+	}
 
 	// insert values into beneficiary_code_map table
-	insertBeneficiaryCodeTableStr := `INSERT INTO beneficiary_code_map (
-		short_code
-		,beneficiary_code) 
-	VALUES (?, ?)`
-	insertBeneficiaryCodeTable, err := db.Prepare(insertBeneficiaryCodeTableStr)
-	checkError(err)
-	for i := 0; i < len(beneficiaryCodeTable); i++ {
-
-		insertBeneficiaryCodeTable.Exec(
-			beneficiaryCodeTable[i].ShortCode,
-			beneficiaryCodeTable[i].BeneficiaryCode,
-		)
-		time.Sleep(1 * time.Millisecond)
+	failedRow, err := bulkload.InsertScOmsTable(db, `beneficiary_code_map`, []bulkload.ScOmsColumn{
+		{Name: `short_code`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.ShortCode }},
+		{Name: `beneficiary_code`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.BeneficiaryCode }},
+	}, beneficiaryCodeTable)
+	if err != nil {
+		return err
+	}
+	if len(failedRow) > 0 {
+		return fmt.Errorf("insert into beneficiary_code_map table: %d rows could not be inserted, e.g. short_code %s: %s", len(failedRow), failedRow[0].ShortCode, failedRow[0].Err)
 	}
 
+	return nil
 }
 
 // CreateIpcFinal adds ledger, subledger, beneficiary_code and voucher
 // to item_price_credit_valid table
-func CreateIpcFinal(db *sql.DB) {
+func CreateIpcFinal(db *sql.DB) error {
 
 	createIpcFinalViewStr := `
 	CREATE VIEW ipc_final AS
@@ -96,21 +236,27 @@ func CreateIpcFinal(db *sql.DB) {
 		,lm.subledger 
 		,bcm.beneficiary_code 
 	FROM item_price_credit_valid ipcv 
-	LEFT JOIN ledger_map lm 
-	USING(ledger_map_key)
+	` + ledgerMapJoin(`ipcv`) + `
 	LEFT JOIN beneficiary_code_map bcm
 	USING(short_code)
 	`
 
 	createIpcFinalView, err := db.Prepare(createIpcFinalViewStr)
-	checkError(err)
-	createIpcFinalView.Exec()
+	if err != nil {
+		return fmt.Errorf("create ipc_final view: %w", err)
+	}
+	defer createIpcFinalView.Close()
+	_, err = createIpcFinalView.Exec()
+	if err != nil {
+		return fmt.Errorf("create ipc_final view: %w", err)
+	}
 
+	return nil
 }
 
 // CreateIptFinal adds ledger, subledger, beneficiary_code and voucher
 // to item_price_valid table
-func CreateIptFinal(db *sql.DB) {
+func CreateIptFinal(db *sql.DB) error {
 
 	// iptv.transaction_value + iptv.paid_price 'voucher': + is correct
 	// iptv.paid_price * (-1): (-1) is correct
@@ -135,25 +281,96 @@ func CreateIptFinal(db *sql.DB) {
 		,lm.subledger 
 		,bcm.beneficiary_code
 	FROM item_price_valid iptv 
-	LEFT JOIN ledger_map lm 
-	USING(ledger_map_key)
+	` + ledgerMapJoin(`iptv`) + `
 	LEFT JOIN beneficiary_code_map bcm
 	USING(short_code)
 	`
 
 	createIptFinalView, err := db.Prepare(createIptFinalViewStr)
-	checkError(err)
-	createIptFinalView.Exec()
+	if err != nil {
+		return fmt.Errorf("create ipt_final view: %w", err)
+	}
+	defer createIptFinalView.Close()
+	_, err = createIptFinalView.Exec()
+	if err != nil {
+		return fmt.Errorf("create ipt_final view: %w", err)
+	}
 
+	return nil
+}
+
+// CreateVatRateTable creates the SQLite table vat_rate from vatRateTable, see bulkload.Insert,
+// and returns the rows of vatRateTable which could not be inserted, with their error
+// an empty ValidTo is stored as 9999-12-31 so that every VAT rate can be looked up with valid_from <= date < valid_to
+// and the VAT rate is also stored in hundredths of a percent as vat_rate_bp to compute VAT with integer arithmetic
+func CreateVatRateTable(db *sql.DB, vatRateTable []vatraterow.VatRateRow) (failedVatRateRow []vatraterow.VatRateRow, err error) {
+
+	// create vat_rate table
+	createVatRateTableStr := `CREATE TABLE vat_rate (
+	valid_from TEXT
+	,valid_to TEXT
+	,vat_rate TEXT
+	,vat_rate_bp INTEGER)`
+	createVatRateTable, err := db.Prepare(createVatRateTableStr)
+	if err != nil {
+		return nil, fmt.Errorf("create vat_rate table: %w", err)
+	}
+	defer createVatRateTable.Close()
+	_, err = createVatRateTable.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("create vat_rate table: %w", err)
+	}
+
+	vatRateBasisPoint := make([]int, len(vatRateTable))
+	for i := 0; i < len(vatRateTable); i++ {
+		vatRateBasisPoint[i], err = vatRateTable[i].BasisPoint()
+		if err != nil {
+			return nil, fmt.Errorf("insert into vat_rate table: %w", err)
+		}
+	}
+
+	// insert values into vat_rate table
+	failedRow, err := bulkload.Insert(db, `vat_rate`, []string{
+		`valid_from`,
+		`valid_to`,
+		`vat_rate`,
+		`vat_rate_bp`,
+	}, len(vatRateTable), func(i int) []interface{} {
+		validTo := vatRateTable[i].ValidTo
+		if validTo == `` {
+			validTo = `9999-12-31`
+		}
+		return []interface{}{
+			vatRateTable[i].ValidFrom,
+			validTo,
+			vatRateTable[i].VatRate,
+			vatRateBasisPoint[i],
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, oneFailedRow := range failedRow {
+		failedVatRateRow = append(failedVatRateRow, vatRateTable[oneFailedRow.Index])
+		failedVatRateRow[len(failedVatRateRow)-1].Err = oneFailedRow.Err
+	}
+	return failedVatRateRow, nil
 }
 
 // CreateCommissionFinal unions commission and commission_credit tables;
-// adds beneficiary_code, commission_revenue and commission_vat
-func CreateCommissionFinal(db *sql.DB) {
+// adds beneficiary_code, vat_rate valid at transaction_date, commission_revenue and commission_vat rounded to the Rial
+// and commission_rounding_difference so that revenue + VAT + rounding difference = commission
+func CreateCommissionFinal(db *sql.DB) error {
 
+	// commission_rounding_difference is the residual of rounding commission_revenue and commission_vat separately
 	createCommissionFinalViewStr := `
 	CREATE VIEW commission_final AS
 	SELECT 
+	cf.*
+		,(cf.transaction_value*-1) - cf.commission_revenue - cf.commission_vat 'commission_rounding_difference'
+	FROM (
+	SELECT 
 	commission.oms_id_sales_order_item
 		,commission.order_nr
 		,commission.id_supplier
@@ -161,13 +378,18 @@ func CreateCommissionFinal(db *sql.DB) {
 		,commission.supplier_name
 		,commission.transaction_type
 		,commission.transaction_value
-		,(commission.transaction_value*-1*100/109) 'commission_revenue'
-		,(commission.transaction_value*-1*100/109*0.09) 'commission_vat'
+		,commission.transaction_date
+		,vr.vat_rate
+		,` + money.RoundedDivisionSQL(`commission.transaction_value*-10000`, `10000+vr.vat_rate_bp`) + ` 'commission_revenue'
+		,` + money.RoundedDivisionSQL(`commission.transaction_value*-vr.vat_rate_bp`, `10000+vr.vat_rate_bp`) + ` 'commission_vat'
 		,commission.comment
 		,bcm.beneficiary_code
 	FROM commission 
 	LEFT JOIN beneficiary_code_map bcm
 	USING(short_code)
+	LEFT JOIN vat_rate vr
+	ON commission.transaction_date >= vr.valid_from
+	AND commission.transaction_date < vr.valid_to
 	UNION ALL
 	SELECT 
 	commission_credit.oms_id_sales_order_item
@@ -177,22 +399,241 @@ func CreateCommissionFinal(db *sql.DB) {
 		,commission_credit.supplier_name
 		,commission_credit.transaction_type
 		,commission_credit.transaction_value
-		,(commission_credit.transaction_value*-1*100/109) 'commission_revenue'
-		,(commission_credit.transaction_value*-1*100/109*0.09) 'commission_vat'
+		,commission_credit.transaction_date
+		,vr.vat_rate
+		,` + money.RoundedDivisionSQL(`commission_credit.transaction_value*-10000`, `10000+vr.vat_rate_bp`) + ` 'commission_revenue'
+		,` + money.RoundedDivisionSQL(`commission_credit.transaction_value*-vr.vat_rate_bp`, `10000+vr.vat_rate_bp`) + ` 'commission_vat'
 		,commission_credit.comment
 		,bcm.beneficiary_code
 	FROM commission_credit 
 	LEFT JOIN beneficiary_code_map bcm
 	USING(short_code)
+	LEFT JOIN vat_rate vr
+	ON commission_credit.transaction_date >= vr.valid_from
+	AND commission_credit.transaction_date < vr.valid_to
+	) cf
 	`
-	//(-1) * (100/109) * 0.09)
+	// (-1) * 10000/(10000+vat_rate_bp) and (-1) * vat_rate_bp/(10000+vat_rate_bp) are rounded to the Rial separately
 	createCommissionFinalView, err := db.Prepare(createCommissionFinalViewStr)
-	checkError(err)
-	createCommissionFinalView.Exec()
+	if err != nil {
+		return fmt.Errorf("create commission_final view: %w", err)
+	}
+	defer createCommissionFinalView.Close()
+	_, err = createCommissionFinalView.Exec()
+	if err != nil {
+		return fmt.Errorf("create commission_final view: %w", err)
+	}
 
+	return nil
 }
 
-func DownloadIpcIptToCsv(db *sql.DB, tableName string) {
+// CreateShippingFeeFinal unions shipping_fee and shipping_fee_credit tables;
+// adds beneficiary_code, vat_rate valid at transaction_date, shipping_fee_revenue and shipping_fee_vat rounded to the Rial
+// and shipping_fee_rounding_difference so that revenue + VAT + rounding difference = shipping fee
+func CreateShippingFeeFinal(db *sql.DB) error {
+
+	// shipping_fee = transaction_value * (-1) to follow the sign of commission_revenue
+	// shipping_fee_rounding_difference is the residual of rounding shipping_fee_revenue and shipping_fee_vat separately
+	createShippingFeeFinalViewStr := `
+	CREATE VIEW shipping_fee_final AS
+	SELECT 
+	sff.*
+		,sff.shipping_fee - sff.shipping_fee_revenue - sff.shipping_fee_vat 'shipping_fee_rounding_difference'
+	FROM (
+	SELECT 
+	shipping_fee.oms_id_sales_order_item
+		,shipping_fee.order_nr
+		,shipping_fee.id_supplier
+		,shipping_fee.short_code
+		,shipping_fee.supplier_name
+		,shipping_fee.transaction_type
+		,shipping_fee.transaction_value
+		,shipping_fee.transaction_date
+		,(shipping_fee.transaction_value*-1) 'shipping_fee'
+		,vr.vat_rate
+		,` + money.RoundedDivisionSQL(`shipping_fee.transaction_value*-10000`, `10000+vr.vat_rate_bp`) + ` 'shipping_fee_revenue'
+		,` + money.RoundedDivisionSQL(`shipping_fee.transaction_value*-vr.vat_rate_bp`, `10000+vr.vat_rate_bp`) + ` 'shipping_fee_vat'
+		,shipping_fee.comment
+		,bcm.beneficiary_code
+	FROM shipping_fee 
+	LEFT JOIN beneficiary_code_map bcm
+	USING(short_code)
+	LEFT JOIN vat_rate vr
+	ON shipping_fee.transaction_date >= vr.valid_from
+	AND shipping_fee.transaction_date < vr.valid_to
+	UNION ALL
+	SELECT 
+	shipping_fee_credit.oms_id_sales_order_item
+		,shipping_fee_credit.order_nr
+		,shipping_fee_credit.id_supplier
+		,shipping_fee_credit.short_code
+		,shipping_fee_credit.supplier_name
+		,shipping_fee_credit.transaction_type
+		,shipping_fee_credit.transaction_value
+		,shipping_fee_credit.transaction_date
+		,(shipping_fee_credit.transaction_value*-1) 'shipping_fee'
+		,vr.vat_rate
+		,` + money.RoundedDivisionSQL(`shipping_fee_credit.transaction_value*-10000`, `10000+vr.vat_rate_bp`) + ` 'shipping_fee_revenue'
+		,` + money.RoundedDivisionSQL(`shipping_fee_credit.transaction_value*-vr.vat_rate_bp`, `10000+vr.vat_rate_bp`) + ` 'shipping_fee_vat'
+		,shipping_fee_credit.comment
+		,bcm.beneficiary_code
+	FROM shipping_fee_credit 
+	LEFT JOIN beneficiary_code_map bcm
+	USING(short_code)
+	LEFT JOIN vat_rate vr
+	ON shipping_fee_credit.transaction_date >= vr.valid_from
+	AND shipping_fee_credit.transaction_date < vr.valid_to
+	) sff
+	`
+
+	createShippingFeeFinalView, err := db.Prepare(createShippingFeeFinalViewStr)
+	if err != nil {
+		return fmt.Errorf("create shipping_fee_final view: %w", err)
+	}
+	defer createShippingFeeFinalView.Close()
+	_, err = createShippingFeeFinalView.Exec()
+	if err != nil {
+		return fmt.Errorf("create shipping_fee_final view: %w", err)
+	}
+
+	return nil
+}
+
+// CreateCancelPenaltyFinal unions cancel_penalty_wi_24 and cancel_penalty_a_24 tables;
+// adds beneficiary_code, cancel_penalty_type, vat_rate valid at transaction_date, cancel_penalty_revenue and cancel_penalty_vat rounded to the Rial
+// and cancel_penalty_rounding_difference so that revenue + VAT + rounding difference = cancellation penalty
+func CreateCancelPenaltyFinal(db *sql.DB) error {
+
+	// cancel_penalty_type keeps track of the view the row comes from
+	// because penalties within and after 24h are booked on different Account Codes
+	// cancel_penalty_rounding_difference is the residual of rounding cancel_penalty_revenue and cancel_penalty_vat separately
+	createCancelPenaltyFinalViewStr := `
+	CREATE VIEW cancel_penalty_final AS
+	SELECT 
+	cpf.*
+		,(cpf.transaction_value*-1) - cpf.cancel_penalty_revenue - cpf.cancel_penalty_vat 'cancel_penalty_rounding_difference'
+	FROM (
+	SELECT 
+	cancel_penalty_wi_24.oms_id_sales_order_item
+		,cancel_penalty_wi_24.order_nr
+		,cancel_penalty_wi_24.id_supplier
+		,cancel_penalty_wi_24.short_code
+		,cancel_penalty_wi_24.supplier_name
+		,cancel_penalty_wi_24.transaction_type
+		,'cancel_penalty_wi_24' 'cancel_penalty_type'
+		,cancel_penalty_wi_24.transaction_value
+		,cancel_penalty_wi_24.transaction_date
+		,vr.vat_rate
+		,` + money.RoundedDivisionSQL(`cancel_penalty_wi_24.transaction_value*-10000`, `10000+vr.vat_rate_bp`) + ` 'cancel_penalty_revenue'
+		,` + money.RoundedDivisionSQL(`cancel_penalty_wi_24.transaction_value*-vr.vat_rate_bp`, `10000+vr.vat_rate_bp`) + ` 'cancel_penalty_vat'
+		,cancel_penalty_wi_24.comment
+		,bcm.beneficiary_code
+	FROM cancel_penalty_wi_24 
+	LEFT JOIN beneficiary_code_map bcm
+	USING(short_code)
+	LEFT JOIN vat_rate vr
+	ON cancel_penalty_wi_24.transaction_date >= vr.valid_from
+	AND cancel_penalty_wi_24.transaction_date < vr.valid_to
+	UNION ALL
+	SELECT 
+	cancel_penalty_a_24.oms_id_sales_order_item
+		,cancel_penalty_a_24.order_nr
+		,cancel_penalty_a_24.id_supplier
+		,cancel_penalty_a_24.short_code
+		,cancel_penalty_a_24.supplier_name
+		,cancel_penalty_a_24.transaction_type
+		,'cancel_penalty_a_24' 'cancel_penalty_type'
+		,cancel_penalty_a_24.transaction_value
+		,cancel_penalty_a_24.transaction_date
+		,vr.vat_rate
+		,` + money.RoundedDivisionSQL(`cancel_penalty_a_24.transaction_value*-10000`, `10000+vr.vat_rate_bp`) + ` 'cancel_penalty_revenue'
+		,` + money.RoundedDivisionSQL(`cancel_penalty_a_24.transaction_value*-vr.vat_rate_bp`, `10000+vr.vat_rate_bp`) + ` 'cancel_penalty_vat'
+		,cancel_penalty_a_24.comment
+		,bcm.beneficiary_code
+	FROM cancel_penalty_a_24 
+	LEFT JOIN beneficiary_code_map bcm
+	USING(short_code)
+	LEFT JOIN vat_rate vr
+	ON cancel_penalty_a_24.transaction_date >= vr.valid_from
+	AND cancel_penalty_a_24.transaction_date < vr.valid_to
+	) cpf
+	`
+
+	createCancelPenaltyFinalView, err := db.Prepare(createCancelPenaltyFinalViewStr)
+	if err != nil {
+		return fmt.Errorf("create cancel_penalty_final view: %w", err)
+	}
+	defer createCancelPenaltyFinalView.Close()
+	_, err = createCancelPenaltyFinalView.Exec()
+	if err != nil {
+		return fmt.Errorf("create cancel_penalty_final view: %w", err)
+	}
+
+	return nil
+}
+
+// CreateOtherTransactionFinal unions all the otherTransactionType tables:
+// transaction_type views of validate for fees charged to sellers and credits given to sellers;
+// adds beneficiary_code, other_transaction_type, other_transaction_amount, vat_rate valid at transaction_date,
+// other_transaction_revenue and other_transaction_vat rounded to the Rial
+// and other_transaction_rounding_difference so that revenue + VAT + rounding difference = other_transaction_amount
+// the posting rules book other_transaction_amount for transactions without VAT (e.g. credits)
+// and other_transaction_revenue, other_transaction_vat and other_transaction_rounding_difference for fees subject to VAT
+func CreateOtherTransactionFinal(db *sql.DB, otherTransactionType []string) error {
+
+	// other_transaction_amount = transaction_value * (-1) to follow the sign of commission_revenue
+	var selectOtherTransactionStr []string
+	for _, transactionType := range otherTransactionType {
+		selectOtherTransactionStr = append(selectOtherTransactionStr, `
+	SELECT 
+	`+transactionType+`.oms_id_sales_order_item
+		,`+transactionType+`.order_nr
+		,`+transactionType+`.id_supplier
+		,`+transactionType+`.short_code
+		,`+transactionType+`.supplier_name
+		,`+transactionType+`.transaction_type
+		,'`+transactionType+`' 'other_transaction_type'
+		,`+transactionType+`.transaction_value
+		,`+transactionType+`.transaction_date
+		,(`+transactionType+`.transaction_value*-1) 'other_transaction_amount'
+		,vr.vat_rate
+		,`+money.RoundedDivisionSQL(transactionType+`.transaction_value*-10000`, `10000+vr.vat_rate_bp`)+` 'other_transaction_revenue'
+		,`+money.RoundedDivisionSQL(transactionType+`.transaction_value*-vr.vat_rate_bp`, `10000+vr.vat_rate_bp`)+` 'other_transaction_vat'
+		,`+transactionType+`.comment
+		,bcm.beneficiary_code
+	FROM `+transactionType+` 
+	LEFT JOIN beneficiary_code_map bcm
+	USING(short_code)
+	LEFT JOIN vat_rate vr
+	ON `+transactionType+`.transaction_date >= vr.valid_from
+	AND `+transactionType+`.transaction_date < vr.valid_to
+	`)
+	}
+
+	// other_transaction_rounding_difference is the residual of rounding other_transaction_revenue and other_transaction_vat separately
+	createOtherTransactionFinalViewStr := `
+	CREATE VIEW other_transaction_final AS
+	SELECT 
+	otf.*
+		,otf.other_transaction_amount - otf.other_transaction_revenue - otf.other_transaction_vat 'other_transaction_rounding_difference'
+	FROM (` + strings.Join(selectOtherTransactionStr, `UNION ALL`) + `) otf
+	`
+
+	createOtherTransactionFinalView, err := db.Prepare(createOtherTransactionFinalViewStr)
+	if err != nil {
+		return fmt.Errorf("create other_transaction_final view: %w", err)
+	}
+	defer createOtherTransactionFinalView.Close()
+	_, err = createOtherTransactionFinalView.Exec()
+	if err != nil {
+		return fmt.Errorf("create other_transaction_final view: %w", err)
+	}
+
+	return nil
+}
+
+// DownloadIpcIptToCsv writes tableName (ipc_final or ipt_final) to a csv file stamped with the booking period and the ID of run, in the directory of run
+func DownloadIpcIptToCsv(db *sql.DB, tableName string, run *runstate.Run) error {
 
 	query := `SELECT ` +
 		tableName + `.oms_id_sales_order_item,` +
@@ -212,44 +653,24 @@ func DownloadIpcIptToCsv(db *sql.DB, tableName string) {
 		tableName + `.subledger,` +
 		tableName + `.beneficiary_code 
 	FROM ` + tableName
-	var orderNr, shortCode, supplierName, transactionType, comment, itemStatus, paymentMethod, shipmentProvidername string
-	var omsIDSalesOrderItem, iDSupplier, ledger, subledger, beneficiaryCode int
-	var transactionValue, paidPrice, voucher float32
-	var ngsTemplate []scomsrow.ScOmsRow
 
 	rows, err := db.Query(query)
-	checkError(err)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", tableName, err)
+	}
+	defer rows.Close()
 
-	for rows.Next() {
-		err := rows.Scan(&omsIDSalesOrderItem, &orderNr, &iDSupplier, &shortCode, &supplierName, &transactionType, &transactionValue, &comment, &itemStatus, &paymentMethod, &shipmentProvidername, &paidPrice, &voucher, &ledger, &subledger, &beneficiaryCode)
-		checkError(err)
-		ngsTemplate = append(ngsTemplate,
-			scomsrow.ScOmsRow{
-				OmsIDSalesOrderItem:  omsIDSalesOrderItem,
-				OrderNr:              orderNr,
-				IDSupplier:           iDSupplier,
-				ShortCode:            shortCode,
-				SupplierName:         supplierName,
-				TransactionType:      transactionType,
-				TransactionValue:     transactionValue,
-				Comment:              comment,
-				ItemStatus:           itemStatus,
-				PaymentMethod:        paymentMethod,
-				ShipmentProviderName: shipmentProvidername,
-				PaidPrice:            paidPrice,
-				Voucher:              voucher,
-				Ledger:               ledger,
-				Subledger:            subledger,
-				BeneficiaryCode:      beneficiaryCode,
-			})
-
-		err = sqltocsv.WriteFile(tableName+".csv", rows)
-		checkError(err)
+	// write all the rows at once: a row scanned before sqltocsv.WriteFile would be left out of the csv file
+	err = sqltocsv.WriteFile(run.FileName(tableName+".csv"), rows)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", tableName, err)
 	}
 
+	return nil
 }
 
-func DownloadCommissionToCsv(db *sql.DB, tableName string) {
+// DownloadCommissionToCsv writes tableName (commission_final) to a csv file stamped with the booking period and the ID of run, in the directory of run
+func DownloadCommissionToCsv(db *sql.DB, tableName string, run *runstate.Run) error {
 
 	query := `SELECT ` +
 		tableName + `.oms_id_sales_order_item,` +
@@ -261,44 +682,39 @@ func DownloadCommissionToCsv(db *sql.DB, tableName string) {
 		tableName + `.transaction_value,` +
 		tableName + `.commission_revenue,` +
 		tableName + `.commission_vat,` +
+		tableName + `.commission_rounding_difference,` +
 		tableName + `.comment,` +
 		tableName + `.beneficiary_code 
 	FROM ` + tableName
 
-	var orderNr, shortCode, supplierName, transactionType, comment string
-	var omsIDSalesOrderItem, iDSupplier, beneficiaryCode int
-	var transactionValue, commissionRevenue, commissionVat float32
-	var ngsTemplate []scomsrow.ScOmsRow
-
 	rows, err := db.Query(query)
-	checkError(err)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", tableName, err)
+	}
+	defer rows.Close()
 
-	for rows.Next() {
-		err := rows.Scan(&omsIDSalesOrderItem, &orderNr, &iDSupplier, &shortCode, &supplierName, &transactionType, &transactionValue, &commissionRevenue, &commissionVat, &comment, &beneficiaryCode)
-		checkError(err)
-		ngsTemplate = append(ngsTemplate,
-			scomsrow.ScOmsRow{
-				OmsIDSalesOrderItem: omsIDSalesOrderItem,
-				OrderNr:             orderNr,
-				IDSupplier:          iDSupplier,
-				ShortCode:           shortCode,
-				SupplierName:        supplierName,
-				TransactionType:     transactionType,
-				TransactionValue:    transactionValue,
-				CommissionRevenue:   commissionRevenue,
-				CommissionVat:       commissionVat,
-				Comment:             comment,
-				BeneficiaryCode:     beneficiaryCode,
-			})
-
-		err = sqltocsv.WriteFile(tableName+".csv", rows)
-		checkError(err)
+	// write all the rows at once: a row scanned before sqltocsv.WriteFile would be left out of the csv file
+	err = sqltocsv.WriteFile(run.FileName(tableName+".csv"), rows)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", tableName, err)
 	}
 
+	return nil
 }
 
-func checkError(err error) {
+// DownloadToCsv writes all the columns of tableName to a csv file stamped with the booking period and the ID of run, in the directory of run
+func DownloadToCsv(db *sql.DB, tableName string, run *runstate.Run) error {
+
+	rows, err := db.Query(`SELECT * FROM ` + tableName)
 	if err != nil {
-		log.Fatal(err.Error())
+		return fmt.Errorf("download %s: %w", tableName, err)
 	}
+	defer rows.Close()
+
+	err = sqltocsv.WriteFile(run.FileName(tableName+".csv"), rows)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", tableName, err)
+	}
+
+	return nil
 }
@@ -2,11 +2,17 @@ package validate
 
 import (
 	"database/sql"
-	"log"
-	"time"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/joho/sqltocsv"
+	"github.com/thomas-bamilo/financebooking/dbinteract/sqliteinteract/bulkload"
+	"github.com/thomas-bamilo/financebooking/money"
+	"github.com/thomas-bamilo/financebooking/row/quarantinerow"
 	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+	"github.com/thomas-bamilo/financebooking/row/transactiontyperow"
+	"github.com/thomas-bamilo/financebooking/runstate"
 )
 
 type transactionType struct {
@@ -41,61 +47,134 @@ var arrayOfTransactionType = []transactionType{{
 	transactionType: `storage_fee`,
 }}
 
-// NB: I think the whole app would be much more efficient if SQLite was not used in-memory!!!
+// IsTransactionType checks if transactionType is one of the transaction_type views of arrayOfTransactionType
+func IsTransactionType(transactionType string) bool {
+	for _, mappedTransactionType := range arrayOfTransactionType {
+		if mappedTransactionType.transactionType == transactionType {
+			return true
+		}
+	}
+	return false
+}
+
+// TransactionTypeOf returns the transaction_type view of arrayOfTransactionType of the rows of sc table with iDTransactionType
+// ok is false if iDTransactionType is not mapped to any transaction_type view
+func TransactionTypeOf(iDTransactionType int) (transactionTypeName string, ok bool) {
+	id := strconv.Itoa(iDTransactionType)
+	for _, mappedTransactionType := range arrayOfTransactionType {
+		for _, mappedID := range strings.Split(mappedTransactionType.idTransactionType, `,`) {
+			if mappedID == id {
+				return mappedTransactionType.transactionType, true
+			}
+		}
+	}
+	return ``, false
+}
+
+// AddTransactionType adds the transaction_type view transactionTypeName of the rows of sc table with id_transaction_type in iDTransactionType
+// (comma separated integers) to arrayOfTransactionType, e.g. a fee defined by the posting rules only
+func AddTransactionType(iDTransactionType, transactionTypeName string) error {
+	for _, id := range strings.Split(iDTransactionType, `,`) {
+		if _, err := strconv.Atoi(id); err != nil {
+			return fmt.Errorf("add transaction_type %s: id_transaction_type %q is not a comma separated list of integers", transactionTypeName, iDTransactionType)
+		}
+		for _, mappedTransactionType := range arrayOfTransactionType {
+			for _, mappedID := range strings.Split(mappedTransactionType.idTransactionType, `,`) {
+				if mappedID == id {
+					return fmt.Errorf("add transaction_type %s: id_transaction_type %s is already mapped to %s", transactionTypeName, id, mappedTransactionType.transactionType)
+				}
+			}
+		}
+	}
+	if IsTransactionType(transactionTypeName) {
+		return fmt.Errorf("add transaction_type %s: already in arrayOfTransactionType", transactionTypeName)
+	}
+	arrayOfTransactionType = append(arrayOfTransactionType, transactionType{
+		idTransactionType: iDTransactionType,
+		transactionType:   transactionTypeName,
+	})
+	return nil
+}
 
 // CreateScTable creates the SQLite table sc with the data from sellerCenterTable, an array of ScOmsRow
-func CreateScTable(db *sql.DB, sellerCenterTable []scomsrow.ScOmsRow) {
+// and returns the rows of sellerCenterTable which could not be inserted, see bulkload.InsertScOmsTable
+func CreateScTable(db *sql.DB, sellerCenterTable []scomsrow.ScOmsRow) (failedRow []scomsrow.ScOmsRow, err error) {
 
 	// create sc table
 	createScTableStr := `CREATE TABLE sc (
-	oms_id_sales_order_item INTEGER
+	id_transaction INTEGER
+	,oms_id_sales_order_item INTEGER
 	,order_nr INTEGER
 	,id_supplier INTEGER
 	,short_code TEXT
 	,supplier_name TEXT
 	,id_transaction_type INTEGER
 	,transaction_type TEXT
-	,transaction_value REAL
+	,transaction_value INTEGER
+	,transaction_date TEXT
 	,comment TEXT)`
 
 	createScTable, err := db.Prepare(createScTableStr)
-	checkError(err)
-	createScTable.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("create sc table: %w", err)
+	}
+	defer createScTable.Close()
+	_, err = createScTable.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("create sc table: %w", err)
+	}
 
 	// insert values into sc table
-	insertScTableStr := `INSERT INTO sc (
-		oms_id_sales_order_item
-		,order_nr
-		,id_supplier
-		,short_code
-		,supplier_name
-		,id_transaction_type
-		,transaction_type
-		,transaction_value
-		,comment)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	insertScTable, err := db.Prepare(insertScTableStr)
-	checkError(err)
-	for i := 0; i < len(sellerCenterTable); i++ {
-		insertScTable.Exec(
-			sellerCenterTable[i].OmsIDSalesOrderItem,
-			sellerCenterTable[i].OrderNr,
-			sellerCenterTable[i].IDSupplier,
-			sellerCenterTable[i].ShortCode,
-			sellerCenterTable[i].SupplierName,
-			sellerCenterTable[i].IDTransactionType,
-			sellerCenterTable[i].TransactionType,
-			sellerCenterTable[i].TransactionValue,
-			sellerCenterTable[i].Comment,
-		)
-		time.Sleep(1 * time.Millisecond)
+	return bulkload.InsertScOmsTable(db, `sc`, scColumn, sellerCenterTable)
+}
+
+// scColumn lists the columns of sc table
+var scColumn = []bulkload.ScOmsColumn{
+	{Name: `id_transaction`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.IDTransaction }},
+	{Name: `oms_id_sales_order_item`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.OmsIDSalesOrderItem }},
+	{Name: `order_nr`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.OrderNr }},
+	{Name: `id_supplier`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.IDSupplier }},
+	{Name: `short_code`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.ShortCode }},
+	{Name: `supplier_name`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.SupplierName }},
+	{Name: `id_transaction_type`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.IDTransactionType }},
+	{Name: `transaction_type`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.TransactionType }},
+	{Name: `transaction_value`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.TransactionValue }},
+	{Name: `transaction_date`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.TransactionDate }},
+	{Name: `comment`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.Comment }},
+}
+
+// DeleteScRow deletes the rows of scTable from sc table by id_transaction, e.g. the rows quarantined once sc table is created
+func DeleteScRow(db *sql.DB, scTable []scomsrow.ScOmsRow) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("delete from sc table: %w", err)
+	}
+	deleteScRow, err := tx.Prepare(`DELETE FROM sc WHERE id_transaction = ?`)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete from sc table: %w", err)
+	}
+	defer deleteScRow.Close()
+	for _, row := range scTable {
+		_, err = deleteScRow.Exec(row.IDTransaction)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("delete id_transaction %d from sc table: %w", row.IDTransaction, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("delete from sc table: %w", err)
 	}
 
+	return nil
 }
 
 // CreateOmsTableItemPrice creates the SQLite table oms with the data from omsTable, an array of ScOmsRow
 // this table is only used in Item Price and Item Price Credit processes
-func CreateOmsTableItemPrice(db *sql.DB, omsTable []scomsrow.ScOmsRow) {
+// it returns the rows of omsTable which could not be inserted, see bulkload.InsertScOmsTable
+func CreateOmsTableItemPrice(db *sql.DB, omsTable []scomsrow.ScOmsRow) (failedRow []scomsrow.ScOmsRow, err error) {
 
 	// create oms table
 	createOmsTableStr := `CREATE TABLE oms (
@@ -106,59 +185,134 @@ func CreateOmsTableItemPrice(db *sql.DB, omsTable []scomsrow.ScOmsRow) {
 		,paid_price INTEGER)`
 
 	createOmsTable, err := db.Prepare(createOmsTableStr)
-	checkError(err)
-	createOmsTable.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("create oms table: %w", err)
+	}
+	defer createOmsTable.Close()
+	_, err = createOmsTable.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("create oms table: %w", err)
+	}
 
 	// insert values into oms table
-	insertOmsTableStr := `INSERT INTO oms (
-		oms_id_sales_order_item
-		,item_status
-		,payment_method
-		,shipment_provider_name
-		,paid_price) 
-	VALUES (?, ?, ?, ?, ?)`
-	insertOmsTable, err := db.Prepare(insertOmsTableStr)
-	checkError(err)
-	for i := 0; i < len(omsTable); i++ {
-		insertOmsTable.Exec(
-			omsTable[i].OmsIDSalesOrderItem,
-			omsTable[i].ItemStatus,
-			omsTable[i].PaymentMethod,
-			omsTable[i].ShipmentProviderName,
-			omsTable[i].PaidPrice,
-		)
-		time.Sleep(1 * time.Millisecond)
-	}
+	return bulkload.InsertScOmsTable(db, `oms`, omsColumn, omsTable)
+}
 
+// omsColumn lists the columns of oms table
+var omsColumn = []bulkload.ScOmsColumn{
+	{Name: `oms_id_sales_order_item`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.OmsIDSalesOrderItem }},
+	{Name: `item_status`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.ItemStatus }},
+	{Name: `payment_method`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.PaymentMethod }},
+	{Name: `shipment_provider_name`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.ShipmentProviderName }},
+	{Name: `paid_price`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.PaidPrice }},
 }
 
 // CreateTransactionTypeTable splits sc table into transaction_type views in SQLite
 // - it also splits sc table between rows with comment vs. without comment
 // - it also joins oms table to item_price and item_price_credit views
-func CreateTransactionTypeTable(db *sql.DB) {
+func CreateTransactionTypeTable(db *sql.DB) error {
 	for _, transactionType := range arrayOfTransactionType {
-		createTransactionTypeView(db,
+		err := createTransactionTypeView(db,
 			transactionType.idTransactionType,
 			transactionType.transactionType)
-		createTransactionTypeCommentView(db,
+		if err != nil {
+			return err
+		}
+		err = createTransactionTypeCommentView(db,
 			transactionType.idTransactionType,
 			transactionType.transactionType)
+		if err != nil {
+			return err
+		}
 	}
 
 	// only joins oms to item_price and item_price_credit without comment
-	createItemPriceCreditOmsView(db)
-	createItemPriceOmsView(db)
+	err := createItemPriceCreditOmsView(db)
+	if err != nil {
+		return err
+	}
+	return createItemPriceOmsView(db)
+}
+
+// ReturnScTableTotal returns the row count and total transaction_value of sc table
+func ReturnScTableTotal(db *sql.DB) (rowCount int, transactionValue money.Rial, err error) {
+
+	query := `
+	SELECT 
+	COUNT(*) 'row_count'
+	,COALESCE(SUM(sc.transaction_value),0) 'transaction_value'
+	FROM sc
+	`
+
+	err = db.QueryRow(query).Scan(&rowCount, &transactionValue)
+	if err != nil {
+		return 0, 0, fmt.Errorf("return sc table total: %w", err)
+	}
+
+	return rowCount, transactionValue, nil
+}
+
+// ReturnUnmappedTransactionTypeTable returns the id_transaction_type of sc table not listed in arrayOfTransactionType
+// with their row count and total transaction_value:
+// these rows are not part of any transaction_type view and therefore are not booked
+func ReturnUnmappedTransactionTypeTable(db *sql.DB) ([]transactiontyperow.TransactionTypeRow, error) {
+
+	var mappedIDTransactionType []string
+	for _, transactionType := range arrayOfTransactionType {
+		mappedIDTransactionType = append(mappedIDTransactionType, transactionType.idTransactionType)
+	}
 
+	query := `
+	SELECT 
+	sc.id_transaction_type
+	,sc.transaction_type
+	,COUNT(*) 'row_count'
+	,SUM(sc.transaction_value) 'transaction_value'
+	FROM sc 
+	WHERE sc.id_transaction_type NOT IN(` + strings.Join(mappedIDTransactionType, `,`) + `)
+	GROUP BY sc.id_transaction_type, sc.transaction_type
+	`
+	var transactionType string
+	var iDTransactionType, rowCount int
+	var transactionValue money.Rial
+	var unmappedTransactionTypeTable []transactiontyperow.TransactionTypeRow
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("return unmapped transaction types: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := rows.Scan(&iDTransactionType, &transactionType, &rowCount, &transactionValue)
+		if err != nil {
+			return nil, fmt.Errorf("return unmapped transaction types: %w", err)
+		}
+		unmappedTransactionTypeTable = append(unmappedTransactionTypeTable,
+			transactiontyperow.TransactionTypeRow{
+				IDTransactionType: iDTransactionType,
+				TransactionType:   transactionType,
+				RowCount:          rowCount,
+				TransactionValue:  transactionValue,
+			})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("return unmapped transaction types: %w", err)
+	}
+
+	return unmappedTransactionTypeTable, nil
 }
 
 // ReturnItemPriceAndCreditTableForValidation unions the SQLite tables item_price_credit_oms & item_price_oms
 // and outputs them into an array of ScOmsRow: itemPriceAndCreditTableForValidation
 // which is used to check if (i) any ledger is missing in BAA database and (ii) all rows of item_price_credit_oms & item_price_oms are valid
-func ReturnItemPriceAndCreditTableForValidation(db *sql.DB) []scomsrow.ScOmsRow {
+func ReturnItemPriceAndCreditTableForValidation(db *sql.DB) ([]scomsrow.ScOmsRow, error) {
 
 	query := `
 	SELECT 
-	ipco.oms_id_sales_order_item
+	ipco.id_transaction
+	,ipco.oms_id_sales_order_item
 	,ipco.order_nr
 	,ipco.id_supplier
 	,ipco.short_code
@@ -166,16 +320,17 @@ func ReturnItemPriceAndCreditTableForValidation(db *sql.DB) []scomsrow.ScOmsRow
 	,ipco.id_transaction_type
 	,ipco.transaction_type
 	,ipco.transaction_value
+	,ipco.transaction_date
 	,ipco.comment
 	,ipco.item_status
 	,ipco.payment_method
 	,ipco.shipment_provider_name
 	,ipco.paid_price
-	,ipco.ledger_map_key
 	FROM item_price_credit_oms ipco
 	UNION ALL
 	SELECT 
-	ipto.oms_id_sales_order_item
+	ipto.id_transaction
+	,ipto.oms_id_sales_order_item
 	,ipto.order_nr
 	,ipto.id_supplier
 	,ipto.short_code
@@ -183,27 +338,33 @@ func ReturnItemPriceAndCreditTableForValidation(db *sql.DB) []scomsrow.ScOmsRow
 	,ipto.id_transaction_type
 	,ipto.transaction_type
 	,ipto.transaction_value
+	,ipto.transaction_date
 	,ipto.comment
 	,ipto.item_status
 	,ipto.payment_method
 	,ipto.shipment_provider_name
 	,ipto.paid_price
-	,ipto.ledger_map_key
 	FROM  item_price_oms ipto
 `
-	var orderNr, shortCode, supplierName, transactionType, comment, itemStatus, paymentMethod, shipmentProvidername, ledgerMapKey string
-	var omsIDSalesOrderItem, iDSupplier, iDTransactionType int
-	var transactionValue, paidPrice float32
+	var orderNr, shortCode, supplierName, transactionType, transactionDate, comment, itemStatus, paymentMethod, shipmentProvidername string
+	var iDTransaction, omsIDSalesOrderItem, iDSupplier, iDTransactionType int
+	var transactionValue, paidPrice money.Rial
 	var itemPriceAndCreditTableForValidation []scomsrow.ScOmsRow
 
 	rows, err := db.Query(query)
-	checkError(err)
+	if err != nil {
+		return nil, fmt.Errorf("return item price and credit table for validation: %w", err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
-		err := rows.Scan(&omsIDSalesOrderItem, &orderNr, &iDSupplier, &shortCode, &supplierName, &iDTransactionType, &transactionType, &transactionValue, &comment, &itemStatus, &paymentMethod, &shipmentProvidername, &paidPrice, &ledgerMapKey)
-		checkError(err)
+		err := rows.Scan(&iDTransaction, &omsIDSalesOrderItem, &orderNr, &iDSupplier, &shortCode, &supplierName, &iDTransactionType, &transactionType, &transactionValue, &transactionDate, &comment, &itemStatus, &paymentMethod, &shipmentProvidername, &paidPrice)
+		if err != nil {
+			return nil, fmt.Errorf("return item price and credit table for validation: %w", err)
+		}
 		itemPriceAndCreditTableForValidation = append(itemPriceAndCreditTableForValidation,
 			scomsrow.ScOmsRow{
+				IDTransaction:        iDTransaction,
 				OmsIDSalesOrderItem:  omsIDSalesOrderItem,
 				OrderNr:              orderNr,
 				IDSupplier:           iDSupplier,
@@ -212,23 +373,28 @@ func ReturnItemPriceAndCreditTableForValidation(db *sql.DB) []scomsrow.ScOmsRow
 				IDTransactionType:    iDTransactionType,
 				TransactionType:      transactionType,
 				TransactionValue:     transactionValue,
+				TransactionDate:      transactionDate,
 				Comment:              comment,
 				ItemStatus:           itemStatus,
 				PaymentMethod:        paymentMethod,
 				ShipmentProviderName: shipmentProvidername,
 				PaidPrice:            paidPrice,
-				LedgerMapKey:         ledgerMapKey,
 			})
 
 		//err = sqltocsv.WriteFile("itemPriceAndCreditTableForValidation.csv", rows)
 		//checkError(err)
 	}
 
-	return itemPriceAndCreditTableForValidation
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("return item price and credit table for validation: %w", err)
+	}
+
+	return itemPriceAndCreditTableForValidation, nil
 }
 
 // CreateItemPriceCreditValidTable creates item_price_credit_valid from itemPriceAndCreditTableValid
-func CreateItemPriceCreditValidTable(db *sql.DB, itemPriceAndCreditTableValid []scomsrow.ScOmsRow) {
+// and returns the rows which could not be inserted, see bulkload.InsertScOmsTable
+func CreateItemPriceCreditValidTable(db *sql.DB, itemPriceAndCreditTableValid []scomsrow.ScOmsRow) (failedRow []scomsrow.ScOmsRow, err error) {
 
 	// create item_price_credit_valid table
 	createItemPriceCreditValidTableStr := `CREATE TABLE item_price_credit_valid (
@@ -239,63 +405,36 @@ func CreateItemPriceCreditValidTable(db *sql.DB, itemPriceAndCreditTableValid []
 	,supplier_name TEXT
 	,id_transaction_type INTEGER
 	,transaction_type TEXT
-	,transaction_value REAL
+	,transaction_value INTEGER
 	,comment TEXT
 	,item_status TEXT
 	,payment_method TEXT
 	,shipment_provider_name TEXT
-	,paid_price REAL
-	,ledger_map_key TEXT)`
+	,paid_price INTEGER)`
 
 	createItemPriceCreditValidTable, err := db.Prepare(createItemPriceCreditValidTableStr)
-	checkError(err)
-	createItemPriceCreditValidTable.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("create item_price_credit_valid table: %w", err)
+	}
+	defer createItemPriceCreditValidTable.Close()
+	_, err = createItemPriceCreditValidTable.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("create item_price_credit_valid table: %w", err)
+	}
 
 	// insert values into item_price_credit_valid table
-	insertItemPriceCreditValidTableStr := `INSERT INTO item_price_credit_valid (
-		oms_id_sales_order_item
-		,order_nr
-		,id_supplier
-		,short_code
-		,supplier_name
-		,id_transaction_type
-		,transaction_type
-		,transaction_value
-		,comment
-		,item_status
-		,payment_method
-		,shipment_provider_name
-		,paid_price
-		,ledger_map_key) 
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	insertItemPriceCreditValidTable, err := db.Prepare(insertItemPriceCreditValidTableStr)
-	checkError(err)
-	for i := 0; i < len(itemPriceAndCreditTableValid); i++ {
-		if itemPriceAndCreditTableValid[i].IDTransactionType == 17 {
-			insertItemPriceCreditValidTable.Exec(
-				itemPriceAndCreditTableValid[i].OmsIDSalesOrderItem,
-				itemPriceAndCreditTableValid[i].OrderNr,
-				itemPriceAndCreditTableValid[i].IDSupplier,
-				itemPriceAndCreditTableValid[i].ShortCode,
-				itemPriceAndCreditTableValid[i].SupplierName,
-				itemPriceAndCreditTableValid[i].IDTransactionType,
-				itemPriceAndCreditTableValid[i].TransactionType,
-				itemPriceAndCreditTableValid[i].TransactionValue,
-				itemPriceAndCreditTableValid[i].Comment,
-				itemPriceAndCreditTableValid[i].ItemStatus,
-				itemPriceAndCreditTableValid[i].PaymentMethod,
-				itemPriceAndCreditTableValid[i].ShipmentProviderName,
-				itemPriceAndCreditTableValid[i].PaidPrice,
-				itemPriceAndCreditTableValid[i].LedgerMapKey,
-			)
-			time.Sleep(1 * time.Millisecond)
+	var itemPriceCreditValidTable []scomsrow.ScOmsRow
+	for _, row := range itemPriceAndCreditTableValid {
+		if row.IDTransactionType == 17 {
+			itemPriceCreditValidTable = append(itemPriceCreditValidTable, row)
 		}
 	}
-
+	return bulkload.InsertScOmsTable(db, `item_price_credit_valid`, itemPriceValidColumn, itemPriceCreditValidTable)
 }
 
 // CreateItemPriceValidTable creates item_price_valid from itemPriceAndCreditTableValid
-func CreateItemPriceValidTable(db *sql.DB, itemPriceAndCreditTableValid []scomsrow.ScOmsRow) {
+// and returns the rows which could not be inserted, see bulkload.InsertScOmsTable
+func CreateItemPriceValidTable(db *sql.DB, itemPriceAndCreditTableValid []scomsrow.ScOmsRow) (failedRow []scomsrow.ScOmsRow, err error) {
 
 	// create item_price_valid table
 	createItemPriceValidTableStr := `CREATE TABLE item_price_valid (
@@ -306,70 +445,60 @@ func CreateItemPriceValidTable(db *sql.DB, itemPriceAndCreditTableValid []scomsr
 	,supplier_name TEXT
 	,id_transaction_type INTEGER
 	,transaction_type TEXT
-	,transaction_value REAL
+	,transaction_value INTEGER
 	,comment TEXT
 	,item_status TEXT
 	,payment_method TEXT
 	,shipment_provider_name TEXT
-	,paid_price REAL
-	,ledger_map_key TEXT)`
+	,paid_price INTEGER)`
 
 	createItemPriceValidTable, err := db.Prepare(createItemPriceValidTableStr)
-	checkError(err)
-	createItemPriceValidTable.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("create item_price_valid table: %w", err)
+	}
+	defer createItemPriceValidTable.Close()
+	_, err = createItemPriceValidTable.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("create item_price_valid table: %w", err)
+	}
 
 	// insert values into item_price_valid table
-	insertItemPriceValidTableStr := `INSERT INTO item_price_valid (
-		oms_id_sales_order_item
-		,order_nr
-		,id_supplier
-		,short_code
-		,supplier_name
-		,id_transaction_type
-		,transaction_type
-		,transaction_value
-		,comment
-		,item_status
-		,payment_method
-		,shipment_provider_name
-		,paid_price
-		,ledger_map_key) 
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	insertItemPriceValidTable, err := db.Prepare(insertItemPriceValidTableStr)
-	checkError(err)
-	for i := 0; i < len(itemPriceAndCreditTableValid); i++ {
-		if itemPriceAndCreditTableValid[i].IDTransactionType == 18 {
-			insertItemPriceValidTable.Exec(
-				itemPriceAndCreditTableValid[i].OmsIDSalesOrderItem,
-				itemPriceAndCreditTableValid[i].OrderNr,
-				itemPriceAndCreditTableValid[i].IDSupplier,
-				itemPriceAndCreditTableValid[i].ShortCode,
-				itemPriceAndCreditTableValid[i].SupplierName,
-				itemPriceAndCreditTableValid[i].IDTransactionType,
-				itemPriceAndCreditTableValid[i].TransactionType,
-				itemPriceAndCreditTableValid[i].TransactionValue,
-				itemPriceAndCreditTableValid[i].Comment,
-				itemPriceAndCreditTableValid[i].ItemStatus,
-				itemPriceAndCreditTableValid[i].PaymentMethod,
-				itemPriceAndCreditTableValid[i].ShipmentProviderName,
-				itemPriceAndCreditTableValid[i].PaidPrice,
-				itemPriceAndCreditTableValid[i].LedgerMapKey,
-			)
-			time.Sleep(1 * time.Millisecond)
+	var itemPriceValidTable []scomsrow.ScOmsRow
+	for _, row := range itemPriceAndCreditTableValid {
+		if row.IDTransactionType == 18 {
+			itemPriceValidTable = append(itemPriceValidTable, row)
 		}
 	}
+	return bulkload.InsertScOmsTable(db, `item_price_valid`, itemPriceValidColumn, itemPriceValidTable)
+}
 
+// itemPriceValidColumn lists the columns of item_price_credit_valid and item_price_valid tables
+var itemPriceValidColumn = []bulkload.ScOmsColumn{
+	{Name: `oms_id_sales_order_item`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.OmsIDSalesOrderItem }},
+	{Name: `order_nr`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.OrderNr }},
+	{Name: `id_supplier`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.IDSupplier }},
+	{Name: `short_code`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.ShortCode }},
+	{Name: `supplier_name`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.SupplierName }},
+	{Name: `id_transaction_type`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.IDTransactionType }},
+	{Name: `transaction_type`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.TransactionType }},
+	{Name: `transaction_value`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.TransactionValue }},
+	{Name: `comment`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.Comment }},
+	{Name: `item_status`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.ItemStatus }},
+	{Name: `payment_method`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.PaymentMethod }},
+	{Name: `shipment_provider_name`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.ShipmentProviderName }},
+	{Name: `paid_price`, Value: func(row scomsrow.ScOmsRow) interface{} { return row.PaidPrice }},
 }
 
 // createTransactionTypeCommentView filters sc table
 // on sc.id_transaction_type = idTransactionType AND sc.comment IS NOT NULL
 // to create the view transactionType_c
-func createTransactionTypeCommentView(db *sql.DB, idTransactionType, transactionType string) {
+func createTransactionTypeCommentView(db *sql.DB, idTransactionType, transactionType string) error {
 
 	createTransactionTypeViewStr := `
 	CREATE VIEW ` + transactionType + `_c AS
 	SELECT 
-	sc.oms_id_sales_order_item
+	sc.id_transaction
+	,sc.oms_id_sales_order_item
 	,sc.order_nr
 	,sc.id_supplier
 	,sc.short_code
@@ -377,6 +506,7 @@ func createTransactionTypeCommentView(db *sql.DB, idTransactionType, transaction
 	,sc.id_transaction_type
 	,sc.transaction_type
 	,sc.transaction_value
+	,sc.transaction_date
 	,sc.comment
 	FROM sc 
 	WHERE sc.comment <> 'NULL'
@@ -384,20 +514,28 @@ func createTransactionTypeCommentView(db *sql.DB, idTransactionType, transaction
 	`
 
 	createTransactionTypeView, err := db.Prepare(createTransactionTypeViewStr)
-	checkError(err)
-	createTransactionTypeView.Exec()
+	if err != nil {
+		return fmt.Errorf("create view %s_c: %w", transactionType, err)
+	}
+	defer createTransactionTypeView.Close()
+	_, err = createTransactionTypeView.Exec()
+	if err != nil {
+		return fmt.Errorf("create view %s_c: %w", transactionType, err)
+	}
 
+	return nil
 }
 
 // createTransactionTypeView filters sc table
 // on sc.id_transaction_type = idTransactionType AND sc.comment IS NULL
 // to create the view transactionType
-func createTransactionTypeView(db *sql.DB, idTransactionType, transactionType string) {
+func createTransactionTypeView(db *sql.DB, idTransactionType, transactionType string) error {
 
 	createTransactionTypeViewStr := `
 	CREATE VIEW ` + transactionType + ` AS
 	SELECT 
-	sc.oms_id_sales_order_item
+	sc.id_transaction
+	,sc.oms_id_sales_order_item
 	,sc.order_nr
 	,sc.id_supplier
 	,sc.short_code
@@ -405,6 +543,7 @@ func createTransactionTypeView(db *sql.DB, idTransactionType, transactionType st
 	,sc.id_transaction_type
 	,sc.transaction_type
 	,sc.transaction_value
+	,sc.transaction_date
 	,sc.comment
 	FROM sc 
 	-- WHERE sc.comment = 'NULL'
@@ -412,21 +551,30 @@ func createTransactionTypeView(db *sql.DB, idTransactionType, transactionType st
 	`
 
 	createTransactionTypeView, err := db.Prepare(createTransactionTypeViewStr)
-	checkError(err)
-	createTransactionTypeView.Exec()
+	if err != nil {
+		return fmt.Errorf("create view %s: %w", transactionType, err)
+	}
+	defer createTransactionTypeView.Close()
+	_, err = createTransactionTypeView.Exec()
+	if err != nil {
+		return fmt.Errorf("create view %s: %w", transactionType, err)
+	}
 
+	return nil
 }
 
 // createItemPriceCreditOmsView creates the view item_price_credit_oms
 // by joining item_price_credit view
 // to oms table on oms_id_sales_order_item
-func createItemPriceCreditOmsView(db *sql.DB) {
+// FYI: the OMS columns of the rows not found in OMS are empty, these rows are invalid item price rows
+func createItemPriceCreditOmsView(db *sql.DB) error {
 
 	// store the query in a string
 	createItemPriceCreditOmsViewStr := `
 	CREATE VIEW item_price_credit_oms AS
 	SELECT 
-	ipc.oms_id_sales_order_item
+	ipc.id_transaction
+	,ipc.oms_id_sales_order_item
 	,ipc.order_nr
 	,ipc.id_supplier
 	,ipc.short_code
@@ -434,30 +582,40 @@ func createItemPriceCreditOmsView(db *sql.DB) {
 	,ipc.id_transaction_type
 	,ipc.transaction_type
 	,ipc.transaction_value
+	,ipc.transaction_date
 	,ipc.comment
-	,oms.item_status
-	,oms.payment_method
-	,oms.shipment_provider_name
-	,oms.paid_price
-	,ipc.transaction_type ||'-'|| oms.item_status ||'-'|| oms.payment_method ||'-'|| oms.shipment_provider_name 'ledger_map_key'
+	,COALESCE(oms.item_status,'') 'item_status'
+	,COALESCE(oms.payment_method,'') 'payment_method'
+	,COALESCE(oms.shipment_provider_name,'') 'shipment_provider_name'
+	,COALESCE(oms.paid_price,0) 'paid_price'
 	FROM item_price_credit ipc LEFT JOIN oms USING(oms_id_sales_order_item)
 	`
 
 	createItemPriceCreditOmsView, err := db.Prepare(createItemPriceCreditOmsViewStr)
-	checkError(err)
-	createItemPriceCreditOmsView.Exec()
+	if err != nil {
+		return fmt.Errorf("create item_price_credit_oms view: %w", err)
+	}
+	defer createItemPriceCreditOmsView.Close()
+	_, err = createItemPriceCreditOmsView.Exec()
+	if err != nil {
+		return fmt.Errorf("create item_price_credit_oms view: %w", err)
+	}
+
+	return nil
 }
 
 // createItemPriceOmsView creates the view item_price_oms
 // by joining item_price view
 // to oms table on oms_id_sales_order_item
-func createItemPriceOmsView(db *sql.DB) {
+// FYI: the OMS columns of the rows not found in OMS are empty, these rows are invalid item price rows
+func createItemPriceOmsView(db *sql.DB) error {
 
 	// store the query in a string
 	createItemPriceOmsViewStr := `
 	CREATE VIEW item_price_oms AS
 	SELECT 
-	ipt.oms_id_sales_order_item
+	ipt.id_transaction
+	,ipt.oms_id_sales_order_item
 	,ipt.order_nr
 	,ipt.id_supplier
 	,ipt.short_code
@@ -465,44 +623,151 @@ func createItemPriceOmsView(db *sql.DB) {
 	,ipt.id_transaction_type
 	,ipt.transaction_type
 	,ipt.transaction_value
+	,ipt.transaction_date
 	,ipt.comment
-	,oms.item_status
-	,oms.payment_method
-	,oms.shipment_provider_name
-	,oms.paid_price
-	,ipt.transaction_type ||'-'|| oms.item_status ||'-'|| oms.payment_method ||'-'|| oms.shipment_provider_name 'ledger_map_key'
+	,COALESCE(oms.item_status,'') 'item_status'
+	,COALESCE(oms.payment_method,'') 'payment_method'
+	,COALESCE(oms.shipment_provider_name,'') 'shipment_provider_name'
+	,COALESCE(oms.paid_price,0) 'paid_price'
 	FROM item_price ipt LEFT JOIN oms USING(oms_id_sales_order_item)
 	`
 
 	createItemPriceOmsView, err := db.Prepare(createItemPriceOmsViewStr)
-	checkError(err)
-	createItemPriceOmsView.Exec()
+	if err != nil {
+		return fmt.Errorf("create item_price_oms view: %w", err)
+	}
+	defer createItemPriceOmsView.Close()
+	_, err = createItemPriceOmsView.Exec()
+	if err != nil {
+		return fmt.Errorf("create item_price_oms view: %w", err)
+	}
+
+	return nil
 }
 
-func DownloadToCsvTest(db *sql.DB, tableName string) {
+// CreateQuarantineTable creates the SQLite table quarantine from quarantineTable:
+// the rows not booked because of missing master data
+func CreateQuarantineTable(db *sql.DB, quarantineTable []quarantinerow.QuarantineRow) error {
 
-	query := `SELECT ` + tableName + `.oms_id_sales_order_item FROM ` + tableName
-	var omsIDSalesOrderItem int
-	var ngsTemplate []scomsrow.ScOmsRow
+	// create quarantine table
+	createQuarantineTableStr := `CREATE TABLE quarantine (
+	reason TEXT
+	,id_transaction INTEGER
+	,oms_id_sales_order_item INTEGER
+	,order_nr INTEGER
+	,id_supplier INTEGER
+	,short_code TEXT
+	,supplier_name TEXT
+	,id_transaction_type INTEGER
+	,transaction_type TEXT
+	,transaction_value INTEGER
+	,transaction_date TEXT
+	,item_status TEXT
+	,payment_method TEXT
+	,shipment_provider_name TEXT)`
 
-	rows, err := db.Query(query)
-	checkError(err)
+	createQuarantineTable, err := db.Prepare(createQuarantineTableStr)
+	if err != nil {
+		return fmt.Errorf("create quarantine table: %w", err)
+	}
+	defer createQuarantineTable.Close()
+	_, err = createQuarantineTable.Exec()
+	if err != nil {
+		return fmt.Errorf("create quarantine table: %w", err)
+	}
 
-	for rows.Next() {
-		err := rows.Scan(&omsIDSalesOrderItem)
-		checkError(err)
-		ngsTemplate = append(ngsTemplate,
-			scomsrow.ScOmsRow{
-				OmsIDSalesOrderItem: omsIDSalesOrderItem,
-			})
-		err = sqltocsv.WriteFile(tableName+".csv", rows)
-		checkError(err)
+	// insert values into quarantine table
+	failedRow, err := bulkload.Insert(db, `quarantine`, []string{
+		`reason`,
+		`id_transaction`,
+		`oms_id_sales_order_item`,
+		`order_nr`,
+		`id_supplier`,
+		`short_code`,
+		`supplier_name`,
+		`id_transaction_type`,
+		`transaction_type`,
+		`transaction_value`,
+		`transaction_date`,
+		`item_status`,
+		`payment_method`,
+		`shipment_provider_name`,
+	}, len(quarantineTable), func(i int) []interface{} {
+		return []interface{}{
+			quarantineTable[i].Reason,
+			quarantineTable[i].IDTransaction,
+			quarantineTable[i].OmsIDSalesOrderItem,
+			quarantineTable[i].OrderNr,
+			quarantineTable[i].IDSupplier,
+			quarantineTable[i].ShortCode,
+			quarantineTable[i].SupplierName,
+			quarantineTable[i].IDTransactionType,
+			quarantineTable[i].TransactionType,
+			quarantineTable[i].TransactionValue,
+			quarantineTable[i].TransactionDate,
+			quarantineTable[i].ItemStatus,
+			quarantineTable[i].PaymentMethod,
+			quarantineTable[i].ShipmentProviderName,
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return bulkload.Err(`quarantine`, failedRow)
+}
+
+// DownloadQuarantineToCsv writes quarantine table to quarantine.csv, to be booked in a follow-up run,
+// and the row count and total transaction_value of each reason and transaction_type to quarantineTotal.csv,
+// both stamped with the booking period and the ID of run, in the directory of run
+func DownloadQuarantineToCsv(db *sql.DB, run *runstate.Run) error {
+
+	rows, err := db.Query(`SELECT * FROM quarantine`)
+	if err != nil {
+		return fmt.Errorf("download quarantine table: %w", err)
+	}
+	err = sqltocsv.WriteFile(run.FileName(`quarantine.csv`), rows)
+	if err != nil {
+		return fmt.Errorf("download quarantine table: %w", err)
+	}
+
+	totalQuery := `
+	SELECT 
+	q.reason
+	,q.transaction_type
+	,COUNT(*) 'row_count'
+	,SUM(q.transaction_value) 'transaction_value'
+	FROM quarantine q
+	GROUP BY q.reason, q.transaction_type
+	ORDER BY q.reason, q.transaction_type`
+	rows, err = db.Query(totalQuery)
+	if err != nil {
+		return fmt.Errorf("download quarantine table: %w", err)
+	}
+	err = sqltocsv.WriteFile(run.FileName(`quarantineTotal.csv`), rows)
+	if err != nil {
+		return fmt.Errorf("download quarantine table: %w", err)
 	}
 
+	return nil
 }
 
-func checkError(err error) {
+// DownloadToCsvTest writes tableName to a csv file stamped with the booking period and the ID of run, in the directory of run
+func DownloadToCsvTest(db *sql.DB, tableName string, run *runstate.Run) error {
+
+	query := `SELECT ` + tableName + `.oms_id_sales_order_item FROM ` + tableName
+
+	rows, err := db.Query(query)
 	if err != nil {
-		log.Fatal(err.Error())
+		return fmt.Errorf("download %s: %w", tableName, err)
 	}
+	defer rows.Close()
+
+	// write all the rows at once: a row scanned before sqltocsv.WriteFile would be left out of the csv file
+	err = sqltocsv.WriteFile(run.FileName(tableName+".csv"), rows)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", tableName, err)
+	}
+
+	return nil
 }
@@ -0,0 +1,219 @@
+package errorreport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gocarina/gocsv"
+	"github.com/thomas-bamilo/financebooking/notify"
+	"github.com/thomas-bamilo/financebooking/row/errorreportrow"
+)
+
+// Category of an issue: each category is a sheet of the xlsx report
+const (
+	InvalidSellerCenterRow  = `invalid_seller_center_row`
+	InvalidItemPriceRow     = `invalid_item_price_row`
+	UnmappedTransactionType = `unmapped_transaction_type`
+	MissingBeneficiaryCode  = `missing_beneficiary_code`
+	MissingLedgerMap        = `missing_ledger_map`
+	InvalidLedgerMap        = `invalid_ledger_map`
+	InvalidVatRate          = `invalid_vat_rate`
+	InvalidChartOfAccount   = `invalid_chart_of_account`
+	InvalidPostingRule      = `invalid_posting_rule`
+	FailedSQLiteLoad        = `failed_sqlite_load`
+	OmsNotFound             = `oms_not_found`
+)
+
+// Severity of an issue
+const (
+	// Error stops the booking process
+	Error = `error`
+	// Warning removes the rows of the issue from booking, the booking process goes on
+	Warning = `warning`
+)
+
+// Stage of the booking process where an issue is found
+const (
+	Configuration          = `configuration`
+	SellerCenterValidation = `seller_center_validation`
+	MasterDataValidation   = `master_data_validation`
+	OmsExtraction          = `oms_extraction`
+	SQLiteValidation       = `sqlite_validation`
+)
+
+// Report collects the issues of every stage of a booking run
+// and writes all of them at once to fileName (csv) and to the xlsx file of the same name, with a sheet per category
+// and notifies Finance of them with sender
+type Report struct {
+	fileName   string
+	sender     notify.Sender
+	issue      []errorreportrow.ErrorReportRow
+	attachment map[string][]string
+	sent       bool
+}
+
+// New returns an empty Report written to fileName and sent with sender,
+// e.g. FinanceBookingErrorLog.csv stamped with the booking period and the ID of the run, see runstate.Run.FileName
+func New(fileName string, sender notify.Sender) *Report {
+	return &Report{fileName: fileName, sender: sender, attachment: make(map[string][]string)}
+}
+
+// event returns the event Finance is notified of for the issues of category
+func event(category string) notify.Event {
+	switch category {
+	case MissingBeneficiaryCode, MissingLedgerMap:
+		return notify.MissingMasterData
+	}
+	return notify.InvalidRows
+}
+
+// State is the issues and attachments collected by a Report, saved with the state of a booking run to resume it
+type State struct {
+	Issue      []errorreportrow.ErrorReportRow `json:"issue"`
+	Attachment map[string][]string             `json:"attachment"`
+	Sent       bool                            `json:"sent"`
+}
+
+// State returns the issues and attachments collected by report so far
+func (report *Report) State() State {
+	return State{Issue: report.issue, Attachment: report.attachment, Sent: report.sent}
+}
+
+// Restore replaces the issues and attachments of report with state, e.g. the state of a resumed booking run
+func (report *Report) Restore(state State) {
+	report.issue = state.Issue
+	report.attachment = state.Attachment
+	if report.attachment == nil {
+		report.attachment = make(map[string][]string)
+	}
+	report.sent = state.Sent
+}
+
+// Add adds issue to report
+func (report *Report) Add(issue ...errorreportrow.ErrorReportRow) {
+	report.issue = append(report.issue, issue...)
+}
+
+// Attach adds fileName to the attachments of the notification of the issues of category,
+// e.g. the template to fill in for a missing master data
+func (report *Report) Attach(category, fileName string) {
+	report.attachment[category] = append(report.attachment[category], fileName)
+}
+
+// Len returns the number of issues of report
+func (report *Report) Len() int {
+	return len(report.issue)
+}
+
+// Write overwrites the csv and xlsx files of report with all its issues,
+// the files are written even without issue so that no issue of a previous run is left
+func (report *Report) Write() error {
+
+	csvIssueP := make([]*errorreportrow.ErrorReportRow, len(report.issue))
+	for i := range report.issue {
+		csvIssueP[i] = &report.issue[i]
+	}
+	file, err := os.Create(report.fileName)
+	if err != nil {
+		return fmt.Errorf("write error report: %w", err)
+	}
+	defer file.Close()
+	err = gocsv.MarshalFile(&csvIssueP, file)
+	if err != nil {
+		return fmt.Errorf("write error report: %w", err)
+	}
+
+	// one sheet per category, in alphabetical order
+	issueByCategory := make(map[string][]*errorreportrow.ErrorReportRow)
+	var category []string
+	for _, issue := range csvIssueP {
+		if _, ok := issueByCategory[issue.Category]; !ok {
+			category = append(category, issue.Category)
+		}
+		issueByCategory[issue.Category] = append(issueByCategory[issue.Category], issue)
+	}
+	sort.Strings(category)
+	if len(category) == 0 {
+		category = []string{`no_issue`}
+	}
+	var sheet []xlsxSheet
+	for _, sheetName := range category {
+		sheetIssueP := issueByCategory[sheetName]
+		csvBytes, err := gocsv.MarshalBytes(&sheetIssueP)
+		if err != nil {
+			return fmt.Errorf("write error report sheet %s: %w", sheetName, err)
+		}
+		sheetRow, err := csv.NewReader(bytes.NewReader(csvBytes)).ReadAll()
+		if err != nil {
+			return fmt.Errorf("write error report sheet %s: %w", sheetName, err)
+		}
+		sheet = append(sheet, xlsxSheet{name: sheetName, row: sheetRow})
+	}
+	err = writeXLSX(report.xlsxFileName(), sheet)
+	if err != nil {
+		return fmt.Errorf("write error report: %w", err)
+	}
+	return nil
+}
+
+func (report *Report) xlsxFileName() string {
+	return strings.TrimSuffix(report.fileName, filepath.Ext(report.fileName)) + `.xlsx`
+}
+
+// Send writes report and notifies Finance of its issues, if any: one notification per event
+// with the csv and xlsx files of report and the files attached to the categories of the event in attachment
+// a failed notification does not stop the booking process since report is written anyway
+// report is sent once per run: Send does nothing once report is sent, e.g. when a failed run sends what is left to send
+func (report *Report) Send() error {
+	if report.sent {
+		return nil
+	}
+	err := report.Write()
+	if err != nil {
+		return err
+	}
+	report.sent = true
+
+	issueCount := make(map[notify.Event]map[string]int)
+	for _, issue := range report.issue {
+		if issueCount[event(issue.Category)] == nil {
+			issueCount[event(issue.Category)] = make(map[string]int)
+		}
+		issueCount[event(issue.Category)][issue.Category]++
+	}
+	for _, oneEvent := range []notify.Event{notify.InvalidRows, notify.MissingMasterData} {
+		if issueCount[oneEvent] == nil {
+			continue
+		}
+		attachment := []string{report.fileName, report.xlsxFileName()}
+		var category []string
+		for oneCategory := range issueCount[oneEvent] {
+			category = append(category, oneCategory)
+		}
+		sort.Strings(category)
+		for _, oneCategory := range category {
+			attachment = append(attachment, report.attachment[oneCategory]...)
+		}
+		err := report.sender.Send(oneEvent, issueCount[oneEvent], attachment...)
+		if err != nil {
+			log.Println(`WARNING: could not notify ` + string(oneEvent) + `: ` + err.Error())
+		}
+	}
+	return nil
+}
+
+// Stop sends report and returns the error with message which STOPs the booking process
+func (report *Report) Stop(message string) error {
+	err := report.Send()
+	if err != nil {
+		return fmt.Errorf("%s (%v)", message, err)
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,129 @@
+package errorreport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxSheet is a sheet of an xlsx file: its name and its rows of cells, the first row being the header
+type xlsxSheet struct {
+	name string
+	row  [][]string
+}
+
+// writeXLSX overwrites fileName with a minimal xlsx workbook made of sheet
+// integers are written as numbers and everything else as inline strings, see worksheet
+func writeXLSX(fileName string, sheet []xlsxSheet) error {
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+
+	var contentType, workbook, workbookRel bytes.Buffer
+	contentType.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRel.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i, s := range sheet {
+		id := strconv.Itoa(i + 1)
+		contentType.WriteString(`<Override PartName="/xl/worksheets/sheet` + id + `.xml" ` +
+			`ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+		workbook.WriteString(`<sheet name="` + escape(sheetName(s.name)) + `" sheetId="` + id + `" r:id="rId` + id + `"/>`)
+		workbookRel.WriteString(`<Relationship Id="rId` + id + `" ` +
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet` + id + `.xml"/>`)
+		if err := writeZipFile(archive, `xl/worksheets/sheet`+id+`.xml`, worksheet(s.row)); err != nil {
+			return err
+		}
+	}
+	contentType.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	workbookRel.WriteString(`</Relationships>`)
+
+	rootRel := xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	for _, part := range []struct{ name, content string }{
+		{`[Content_Types].xml`, contentType.String()},
+		{`_rels/.rels`, rootRel},
+		{`xl/workbook.xml`, workbook.String()},
+		{`xl/_rels/workbook.xml.rels`, workbookRel.String()},
+	} {
+		if err := writeZipFile(archive, part.name, part.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// worksheet returns the xml of a worksheet made of row
+// the spaces of inline strings are preserved, otherwise Excel trims the leading and trailing spaces of a cell
+func worksheet(row [][]string) string {
+	var sheetXML bytes.Buffer
+	sheetXML.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, cell := range row {
+		rowNumber := strconv.Itoa(i + 1)
+		sheetXML.WriteString(`<row r="` + rowNumber + `">`)
+		for j, value := range cell {
+			reference := columnName(j) + rowNumber
+			// integers, except in the header and with leading zeros, are numbers
+			if number, err := strconv.ParseInt(value, 10, 64); err == nil && i > 0 && strconv.FormatInt(number, 10) == value {
+				sheetXML.WriteString(`<c r="` + reference + `"><v>` + value + `</v></c>`)
+				continue
+			}
+			sheetXML.WriteString(`<c r="` + reference + `" t="inlineStr"><is><t xml:space="preserve">` + escape(value) + `</t></is></c>`)
+		}
+		sheetXML.WriteString(`</row>`)
+	}
+	sheetXML.WriteString(`</sheetData></worksheet>`)
+	return sheetXML.String()
+}
+
+func writeZipFile(archive *zip.Writer, name, content string) error {
+	zipFile, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = zipFile.Write([]byte(content))
+	return err
+}
+
+// columnName returns the name of the column of index i (starting at 0): A, B, ..., Z, AA, AB...
+func columnName(i int) string {
+	name := ``
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// sheetName removes the characters forbidden in a sheet name and truncates it to the 31 characters allowed
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 31 {
+		name = name[:31]
+	}
+	return name
+}
+
+func escape(value string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
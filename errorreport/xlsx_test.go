@@ -0,0 +1,91 @@
+package errorreport
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorksheet(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     [][]string
+		want    []string
+		wantNot []string
+	}{
+		{
+			name: "inline strings preserve their spaces",
+			row:  [][]string{{`message`}, {` leading and trailing `}},
+			want: []string{`<c r="A2" t="inlineStr"><is><t xml:space="preserve"> leading and trailing </t></is></c>`},
+		},
+		{
+			name: "inline strings are escaped",
+			row:  [][]string{{`message`}, {`<a & b>`}},
+			want: []string{`<t xml:space="preserve">&lt;a &amp; b&gt;</t>`},
+		},
+		{
+			name:    "integers are numbers except in the header and with leading zeros",
+			row:     [][]string{{`12`}, {`34`, `056`}},
+			want:    []string{`<c r="A1" t="inlineStr"><is><t xml:space="preserve">12</t></is></c>`, `<c r="A2"><v>34</v></c>`, `<c r="B2" t="inlineStr"><is><t xml:space="preserve">056</t></is></c>`},
+			wantNot: []string{`<v>12</v>`, `<v>056</v>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := worksheet(tt.row)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("worksheet() = %s, want it to contain %s", got, want)
+				}
+			}
+			for _, wantNot := range tt.wantNot {
+				if strings.Contains(got, wantNot) {
+					t.Errorf("worksheet() = %s, want it not to contain %s", got, wantNot)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), `report.xlsx`)
+	err := writeXLSX(fileName, []xlsxSheet{
+		{name: `invalid_ledger_map`, row: [][]string{{`message`}, {` spaced `}}},
+		{name: `a/b:c`, row: [][]string{{`message`}}},
+	})
+	if err != nil {
+		t.Fatalf("writeXLSX() error = %v", err)
+	}
+
+	archive, err := zip.OpenReader(fileName)
+	if err != nil {
+		t.Fatalf("open %s: %v", fileName, err)
+	}
+	defer archive.Close()
+	part := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", file.Name, err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", file.Name, err)
+		}
+		part[file.Name] = string(content)
+	}
+	for _, name := range []string{`[Content_Types].xml`, `_rels/.rels`, `xl/workbook.xml`, `xl/_rels/workbook.xml.rels`, `xl/worksheets/sheet1.xml`, `xl/worksheets/sheet2.xml`} {
+		if _, ok := part[name]; !ok {
+			t.Errorf("writeXLSX() has no part %s", name)
+		}
+	}
+	if want := `<t xml:space="preserve"> spaced </t>`; !strings.Contains(part[`xl/worksheets/sheet1.xml`], want) {
+		t.Errorf("sheet1 = %s, want it to contain %s", part[`xl/worksheets/sheet1.xml`], want)
+	}
+	if want := `<sheet name="a_b_c" sheetId="2" r:id="rId2"/>`; !strings.Contains(part[`xl/workbook.xml`], want) {
+		t.Errorf("workbook = %s, want it to contain %s", part[`xl/workbook.xml`], want)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/thomas-bamilo/financebooking/dbinteract/baainteract"
+)
+
+// Table of BAA database fetched by the booking process
+const (
+	retailShortCodeSource = `retail_short_code`
+	chartOfAccountSource  = `chart_of_account`
+	accountSource         = `account`
+	beneficiaryCodeSource = `beneficiary_code_map`
+	vatRateSource         = `vat_rate`
+	ledgerMapSource       = `ledger_map`
+)
+
+// baaSource is a table of BAA database needed by the stage of the booking process
+type baaSource struct {
+	name  string
+	stage string
+	fetch func(dbBaa *sql.DB) (interface{}, error)
+}
+
+// baaSourceList lists the tables of BAA database fetched by the booking process
+var baaSourceList = []baaSource{
+	{name: retailShortCodeSource, stage: filterRetailStage, fetch: func(dbBaa *sql.DB) (interface{}, error) {
+		return baainteract.GetRetailShortCodeFromBaa(dbBaa)
+	}},
+	{name: chartOfAccountSource, stage: validateStage, fetch: func(dbBaa *sql.DB) (interface{}, error) {
+		return baainteract.GetChartOfAccountTable(dbBaa)
+	}},
+	{name: accountSource, stage: validateStage, fetch: func(dbBaa *sql.DB) (interface{}, error) {
+		return baainteract.GetAccountTable(dbBaa)
+	}},
+	{name: beneficiaryCodeSource, stage: validateStage, fetch: func(dbBaa *sql.DB) (interface{}, error) {
+		return baainteract.GetBeneficiaryCodeTable(dbBaa)
+	}},
+	{name: vatRateSource, stage: validateStage, fetch: func(dbBaa *sql.DB) (interface{}, error) {
+		return baainteract.GetVatRateTable(dbBaa)
+	}},
+	{name: ledgerMapSource, stage: loadSQLiteStage, fetch: func(dbBaa *sql.DB) (interface{}, error) {
+		return baainteract.GetLedgerMap(dbBaa)
+	}},
+}
+
+// baaFetch is a table of BAA database fetched in the background: table and err are set once done is closed
+type baaFetch struct {
+	done  chan struct{}
+	table interface{}
+	err   error
+}
+
+// fetchBaa starts fetching the tables of BAA database needed by the stages stageList[first] to stageList[last],
+// each in its own goroutine: they are fetched concurrently with each other and with Seller Center data
+// FYI: the tables are fetched again by every run so that a run resumed once the master data is fixed books the fixed master data
+func (booking *booking) fetchBaa(first, last int) {
+	booking.baaFetch = make(map[string]*baaFetch)
+	for _, source := range baaSourceList {
+		i, err := stageIndex(source.stage)
+		if err != nil || i < first || i > last {
+			continue
+		}
+		dbBaa := booking.baa()
+		fetch := &baaFetch{done: make(chan struct{})}
+		booking.baaFetch[source.name] = fetch
+		go func(source baaSource) {
+			defer close(fetch.done)
+			start := time.Now()
+			fetch.table, fetch.err = source.fetch(dbBaa)
+			if fetch.err == nil {
+				log.Println(`fetched ` + source.name + ` from BAA in ` + time.Since(start).Round(time.Millisecond).String())
+			}
+		}(source)
+	}
+}
+
+// waitBaa waits for the table name of BAA database started by fetchBaa and returns it
+func (booking *booking) waitBaa(name string) (interface{}, error) {
+	fetch, ok := booking.baaFetch[name]
+	if !ok {
+		return nil, fmt.Errorf("fetch %s from BAA: not started for this stage", name)
+	}
+	<-fetch.done
+	if fetch.err != nil {
+		return nil, fmt.Errorf("fetch %s from BAA: %w", name, fetch.err)
+	}
+	return fetch.table, nil
+}
+
+// waitAllBaa waits for all the tables of BAA database started by fetchBaa, e.g. before closing BAA database
+func (booking *booking) waitAllBaa() {
+	for _, fetch := range booking.baaFetch {
+		<-fetch.done
+	}
+}
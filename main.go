@@ -1,214 +1,371 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
-	"strconv"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/gocarina/gocsv"
+	"github.com/thomas-bamilo/financebooking/bookingperiod"
+	"github.com/thomas-bamilo/financebooking/chartofaccount"
+	"github.com/thomas-bamilo/financebooking/money"
+	"github.com/thomas-bamilo/financebooking/notify"
+	"github.com/thomas-bamilo/financebooking/postingrule"
+	"github.com/thomas-bamilo/financebooking/row/runstatusrow"
 	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+	"github.com/thomas-bamilo/financebooking/runstate"
+	"github.com/thomas-bamilo/financebooking/validation"
 
-	"github.com/thomas-bamilo/financebooking/dbinteract/baainteract"
 	"github.com/thomas-bamilo/financebooking/dbinteract/omsinteract"
-	"github.com/thomas-bamilo/financebooking/dbinteract/scinteract"
-	"github.com/thomas-bamilo/financebooking/dbinteract/sqliteinteract/output"
-	"github.com/thomas-bamilo/financebooking/dbinteract/sqliteinteract/transform"
 	"github.com/thomas-bamilo/financebooking/dbinteract/sqliteinteract/validate"
-	"github.com/thomas-bamilo/financebooking/validation"
-	"github.com/thomas-bamilo/sql/connectdb"
+	"github.com/thomas-bamilo/financebooking/errorreport"
 )
 
 func main() {
 
-	// get Seller Center data
-	dbSc := connectdb.ConnectToSc()
-	defer dbSc.Close()
-	sellerCenterTable := scinteract.GetSellerCenterData(dbSc)
-
-	log.Println(`sellerCenterTable`)
-	log.Println(`sellerCenterTable length: ` + strconv.Itoa(len(sellerCenterTable)))
-
-	// filter out retail suppliers
-	dbBaa := connectdb.ConnectToBaa()
-	defer dbBaa.Close()
-	retailShortCodeTable := baainteract.GetRetailShortCodeFromBaa(dbBaa)
-	sellerCenterTable = validation.FilterRetailShortCode(retailShortCodeTable, sellerCenterTable)
-	log.Println(`retail suppliers filtered out`)
-	log.Println(`sellerCenterTable length: ` + strconv.Itoa(len(sellerCenterTable)))
-
-	// check if sellerCenterTable has any invalid row
-	// if sellerCenterTable has any invalid row, send the invalid rows to Finance
-	// and continue the process only with valid rows
-	// FYI: this step DOES NOT remove any seller without ShortCode (e.g. Bamilo) --> you should make sure they are removed
-	sellerCenterTable, sellerCenterTableInvalidRow := scomsrow.FilterSellerCenterTable(sellerCenterTable)
-	log.Println(`checked seller center rows validity`)
-	log.Println(`sellerCenterTable length: ` + strconv.Itoa(len(sellerCenterTable)))
-	log.Println(`sellerCenterTableInvalidRow length: ` + strconv.Itoa(len(sellerCenterTableInvalidRow)))
-	scomsrow.IfInvalidSellerCenterRow(sellerCenterTableInvalidRow)
-	log.Println(`IfInvalidSellerCenterRow`)
-
-	// check benef_code_map is complete ------------------------------------------------
-	// get all the short_code from beneficiary_code_map table of BAA database to check against the ShortCode of sellerCenterTable
-	beneficiaryCodeTable := baainteract.GetBeneficiaryCodeTable(dbBaa)
-	log.Println(`beneficiaryCodeTable`)
-	log.Println(`beneficiaryCodeTable length: ` + strconv.Itoa(len(beneficiaryCodeTable)))
-	// check if any missing short_code in beneficairy_code_map table of BAA database
-	missingBeneficiaryCodeTable := validation.MissingBeneficiaryCode(beneficiaryCodeTable, sellerCenterTable)
-	log.Println(`missingBeneficiaryCodeTable`)
-	log.Println(`missingBeneficiaryCodeTable length: ` + strconv.Itoa(len(missingBeneficiaryCodeTable)))
-
-	// IfMissingBeneficiaryCode STOPs the booking process if any missing short_code in beneficairy_code_map table of BAA database
-	// (we can make it less blocking in the future)
-	validation.IfMissingBeneficiaryCode(missingBeneficiaryCodeTable)
-	log.Println(`IfMissingBeneficiaryCode`)
-
-	// get uniqueOmsIDSalesOrderItemList from Seller Center table
-	// uniqueOmsIDSalesOrderItemList represents in OMS the rows currently booked
-	uniqueOmsIDSalesOrderItemList := uniqueOmsIDSalesOrderItem(sellerCenterTable)
-	log.Println(`uniqueOmsIDSalesOrderItemList`)
-	//log.Println(uniqueOmsIDSalesOrderItemList)
-
-	// get OMS data
-	dbOMS := connectdb.ConnectToOms()
-	defer dbOMS.Close()
-	omsTable := omsinteract.GetOmsData(dbOMS, uniqueOmsIDSalesOrderItemList)
-	log.Println(`GotOmsData`)
-	log.Println(`omsTable length: ` + strconv.Itoa(len(omsTable)))
-
-	// split sellerCenterTable by IDTransaction in SQLite------------------------------------------
-	dbSqlite := connectdb.ConnectToSQLite()
-	defer dbSqlite.Close()
-	// create sc table in SQLite
-	validate.CreateScTable(dbSqlite, sellerCenterTable)
-	log.Println(`CreatedScTable`)
-	validate.DownloadToCsvTest(dbSqlite, `sc`)
-	// create oms table in SQLite
-	validate.CreateOmsTableItemPrice(dbSqlite, omsTable)
-	log.Println(`CreatedOmsTableItemPrice`)
-	validate.DownloadToCsvTest(dbSqlite, `oms`)
-	// CreateTransactionTypeTable splits sc table into transaction_type views in SQLite
-	// - it also splits sc table between rows with comment vs. without comment
-	// - it also joins oms table to item_price and item_price_credit views without comment
-	validate.CreateTransactionTypeTable(dbSqlite)
-	log.Println(`CreatedTransactionTypeTable`)
-	/*validate.DownloadToCsvTest(dbSqlite, `item_price_credit`)
-	validate.DownloadToCsvTest(dbSqlite, `item_price`)
-	validate.DownloadToCsvTest(dbSqlite, `commission`)
-	validate.DownloadToCsvTest(dbSqlite, `commission_credit`)
-	validate.DownloadToCsvTest(dbSqlite, `shipping_fee`)
-	validate.DownloadToCsvTest(dbSqlite, `shipping_fee_credit`)
-	validate.DownloadToCsvTest(dbSqlite, `cancel_penalty_wi_24`)
-	validate.DownloadToCsvTest(dbSqlite, `cancel_penalty_a_24`)
-	validate.DownloadToCsvTest(dbSqlite, `consign_handling_fee`)
-	validate.DownloadToCsvTest(dbSqlite, `down_payment_credit`)
-	validate.DownloadToCsvTest(dbSqlite, `lost_damaged_credit`)
-	validate.DownloadToCsvTest(dbSqlite, `storage_fee`)*/
-
-	// check if item_price_oms and item_price_credit_oms have invalid rows-----------------------------------------------------------------
-	// mostly, rows should not have missing values for fields involved in ledger mapping
-	// return itemPriceAndCreditTableForValidation to check if any invalid row
-	itemPriceAndCreditTableForValidation := validate.ReturnItemPriceAndCreditTableForValidation(dbSqlite)
-	log.Println(`ReturnedItemPriceAndCreditTableForValidation`)
-	log.Println(`itemPriceAndCreditTableForValidation length: ` + strconv.Itoa(len(itemPriceAndCreditTableForValidation)))
-
-	// check if itemPriceAndCreditTableForValidation has any invalid row
-	// if itemPriceAndCreditTableForValidation has any invalid row, send the invalid rows to Finance
-	// and continue the process only with valid rows
-	// FYI: itemPriceAndCreditTableForValidation is the union of item_price_oms and item_price_credit_oms SQLite views
-	itemPriceAndCreditTableForValidation, itemPriceAndCreditTableForValidationInvalidRow := scomsrow.FilterScOmsTable(itemPriceAndCreditTableForValidation)
-	log.Println(`FilteredScOmsTable`)
-	log.Println(`itemPriceAndCreditTableForValidation length: ` + strconv.Itoa(len(itemPriceAndCreditTableForValidation)))
-	log.Println(`itemPriceAndCreditTableForValidationInvalidRow length: ` + strconv.Itoa(len(itemPriceAndCreditTableForValidationInvalidRow)))
-	scomsrow.IfInvalidScOmsRow(itemPriceAndCreditTableForValidationInvalidRow)
-	log.Println(`IfInvalidScOmsRow`)
-
-	// check ledger_map is complete -----------------------------------------------------------------------------------------------------
-	// get the LedgerMapKey from ledger_map table of BAA database to check against itemPriceAndCreditTableForValidation
-	ledgerMapTable := baainteract.GetLedgerMap(dbBaa)
-	log.Println(`GotLedgerMap`)
-	log.Println(`ledgerMapTable length: ` + strconv.Itoa(len(ledgerMapTable)))
-
-	// check if any missing ledger_map in ledger_map table of BAA database compared to itemPriceAndCreditTableForValidation
-	missingLedgerMapKeyTable := validation.MissingLedgerMapKey(ledgerMapTable, itemPriceAndCreditTableForValidation)
-	log.Println(`missingLedgerMapKeyTable`)
-	log.Println(`missingLedgerMapKeyTable length: ` + strconv.Itoa(len(missingLedgerMapKeyTable)))
-
-	// IfMissingLedgerMap STOPs the booking process if any missing ledger_map in ledger_map table of BAA database compared to itemPriceAndCreditTableForValidation
-	// (we can make it less blocking in the future)
-	validation.IfMissingLedgerMap(missingLedgerMapKeyTable)
-	log.Println(`IfMissingLedgerMap`)
-
-	// Create item_price_credit_valid and item_price_valid SQLite tables
-	validate.CreateItemPriceCreditValidTable(dbSqlite, itemPriceAndCreditTableForValidation)
-	log.Println(`CreateItemPriceCreditValidTable`)
-	validate.DownloadToCsvTest(dbSqlite, `item_price_credit_valid`)
-	validate.CreateItemPriceValidTable(dbSqlite, itemPriceAndCreditTableForValidation)
-	log.Println(`CreateItemPriceValidTable`)
-	validate.DownloadToCsvTest(dbSqlite, `item_price_valid`)
-
-	// transform valid ipc, ipt and commission data ---------------------------------------------------------------------------------------------------
-
-	// Create ledger_map SQLite table
-	transform.CreateLedgerMapTable(dbSqlite, ledgerMapTable)
-	log.Println(`CreateLedgerMapTable`)
-	// Create beneficiary_code_map SQLite table
-	transform.CreateBeneficiaryCodeTable(dbSqlite, beneficiaryCodeTable)
-	log.Println(`CreateBeneficiaryCodeTable`)
-
-	// ipc_ipt_c process ---------------------------------------------------------------------------------------------------------------
-	// add all necessary data by joining tables and adding calculated fields
-	transform.CreateIpcFinal(dbSqlite)
-	log.Println(`CreateIpcFinal`)
-	transform.DownloadIpcIptToCsv(dbSqlite, `ipc_final`)
-	transform.CreateIptFinal(dbSqlite)
-	log.Println(`CreateIptFinal`)
-	transform.DownloadIpcIptToCsv(dbSqlite, `ipt_final`)
-	transform.CreateCommissionFinal(dbSqlite)
-	log.Println(`CreateCommissionFinal`)
-	transform.DownloadCommissionToCsv(dbSqlite, `commission_final`)
-
-	// create all the "ngs-friendly" data tables
-	output.CreateVoucherLedgerAmountView(dbSqlite)
-	log.Println(`CreateVoucherLedgerAmountView`)
-	output.DownloadToCsvTest(dbSqlite, `voucher_ledger_amount`)
-	output.CreateIpcPaidPriceLedgerAmountView(dbSqlite)
-	log.Println(`CreateIpcPaidPriceLedgerAmountView`)
-	output.DownloadToCsvTest(dbSqlite, `ipc_paid_price_ledger_amount`)
-	output.CreateIptPaidPriceLedgerAmountView(dbSqlite)
-	log.Println(`CreateIptPaidPriceLedgerAmountView`)
-	output.DownloadToCsvTest(dbSqlite, `ipt_paid_price_ledger_amount`)
-	output.CreateCommissionVatLedgerAmountView(dbSqlite)
-	log.Println(`CreateCommissionVatLedgerAmountView`)
-	output.DownloadToCsvTest(dbSqlite, `commission_vat_ledger_amount`)
-	output.CreateCommissionRevenueLedgerAmountView(dbSqlite)
-	log.Println(`CreateCommissionRevenueLedgerAmountView`)
-	output.DownloadToCsvTest(dbSqlite, `commission_revenue_ledger_amount`)
-	output.CreateTotalLedgerAmountView(dbSqlite)
-	log.Println(`CreateTotalLedgerAmountView`)
-	output.DownloadToCsvTest(dbSqlite, `total_ledger_amount`)
-
-	validate.DownloadToCsvTest(dbSqlite, `item_price_oms`)
-	validate.DownloadToCsvTest(dbSqlite, `item_price_credit_oms`)
-
-	// output ngsIpcIptC template
-	output.ReturnNgsIpcIptC(dbSqlite)
-	log.Println(`ReturnNgsIpcIptC`)
+	// define the booking period from the command line, by default the previous month is booked
+	// e.g. -month=4 -year=2018 or -from=2018-04-01 -to=2018-04-15
+	month := flag.Int("month", 0, "month to book (1-12), used with -year")
+	year := flag.Int("year", 0, "year to book, used with -month")
+	from := flag.String("from", "", "first date to book (YYYY-MM-DD), used with -to")
+	to := flag.String("to", "", "last date to book, included (YYYY-MM-DD), used with -from")
+	reconciliationTolerance := flag.Int64("reconciliation-tolerance", 0, "maximum difference (in Rial) accepted by the reconciliation from Seller Center to NGS template")
+	ngsBalanceTolerance := flag.Int64("ngs-balance-tolerance", 0, "maximum net amount (in Rial) accepted for the NGS template to balance")
+	allowUnbalancedDraft := flag.Bool("allow-unbalanced-draft", false, "write an unbalanced NGS template as a draft instead of stopping the booking")
+	stopOnUnmappedTransactionType := flag.Bool("stop-on-unmapped-transaction-type", false, "stop the booking if any Seller Center transaction type is not mapped")
+	quarantineMissingMasterData := flag.Bool("quarantine-missing-master-data", false, "quarantine the rows with missing ledger_map or beneficiary_code and book all other rows instead of stopping the booking")
+	bookQuarantineFileName := flag.String("book-quarantine", "", "quarantine csv file of a previous run (in its run directory): only its rows are booked, once the master data is fixed")
+	omsChunkSize := flag.Int("oms-chunk-size", omsinteract.DefaultChunkSize, "number of oms_id_sales_order_item looked up in OMS per query")
+	omsWorkerCount := flag.Int("oms-workers", omsinteract.DefaultWorkerCount, "number of queries run concurrently on OMS")
+	// override the Account Codes of chart_of_account table of BAA database from the command line
+	accountCodeFlag := map[string]*string{
+		chartofaccount.CancelPenaltyRevenueWithin24h: flag.String("cancel-penalty-wi-24-account", "", "Account Code of cancellation penalty revenue (within 24h), overrides chart_of_account"),
+		chartofaccount.CancelPenaltyRevenueAfter24h:  flag.String("cancel-penalty-a-24-account", "", "Account Code of cancellation penalty revenue (after 24h), overrides chart_of_account"),
+		chartofaccount.CancelPenaltyVat:              flag.String("cancel-penalty-vat-account", "", "Account Code of cancellation penalty VAT, overrides chart_of_account"),
+		chartofaccount.RoundingDifference:            flag.String("rounding-difference-account", "", "Account Code of the residual of rounding revenue and VAT separately, overrides chart_of_account"),
+	}
+	postingRuleFileName := flag.String("posting-rules", "", "csv file of the posting rules of the NGS template, see postingrule.PostingRule (default postingrule.Default), copied into the run directory")
+	// Finance is notified of the issues and of the success of the booking by the notifier
+	// FYI: the SMTP password is read from FINANCE_BOOKING_SMTP_PASSWORD to keep it out of the command line
+	notifierName := flag.String("notifier", "goemail", "notifier of Finance: goemail, smtp, dir (offline) or webhook")
+	notifierConfig := notify.Config{SMTPPassword: os.Getenv(`FINANCE_BOOKING_SMTP_PASSWORD`)}
+	flag.StringVar(&notifierConfig.SMTPAddr, "smtp-addr", "", "SMTP server (host:port) of the smtp notifier")
+	flag.StringVar(&notifierConfig.SMTPFrom, "smtp-from", "", "sender email address of the smtp notifier")
+	flag.StringVar(&notifierConfig.SMTPUsername, "smtp-username", "", "SMTP username of the smtp notifier, no authentication if empty")
+	flag.StringVar(&notifierConfig.Dir, "notification-dir", "notification", "directory where the dir notifier writes the notifications")
+	flag.StringVar(&notifierConfig.WebhookURL, "webhook-url", "", "URL the webhook notifier posts the notifications to")
+	recipientFileName := flag.String("notification-recipients", "", "csv file of the recipients of each category of notification, see notify.RecipientRow")
+	templateDir := flag.String("notification-templates", "", "directory of the notification templates <event>.txt overriding notify.DefaultTemplate")
+	// the state of each stage of a run is saved under its run ID to resume the run without redoing the previous stages
+	// e.g. -run-id=2018-04_20180502-093000 resumes the run from its failed stage, -run-id=... -stage=transform re-executes one stage
+	runDir := flag.String("run-dir", "run", "directory where the state of each stage, the SQLite database and the output files of the runs are saved")
+	runID := flag.String("run-id", "", "ID of the run to resume from its failed stage with the booking options saved by the run, a new run ID is generated if empty")
+	fromStage := flag.String("from-stage", "", "stage to resume the run from, the stages are "+strings.Join(stageName(), ", "))
+	onlyStage := flag.String("stage", "", "single stage of the run to re-execute")
+	flag.Parse()
+	bookingPeriod, err := bookingperiod.Parse(*month, *year, *from, *to, time.Now())
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if *omsChunkSize <= 0 {
+		log.Fatal(`-oms-chunk-size should be positive`)
+	}
+	if *omsWorkerCount <= 0 {
+		log.Fatal(`-oms-workers should be positive`)
+	}
+
+	// resume the run -run-id if it exists, with its booking period, otherwise create a new run
+	var run *runstate.Run
+	if *runID != `` && runstate.Exists(*runDir, *runID) {
+		run, err = runstate.Open(*runDir, *runID)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		bookingPeriod = run.BookingPeriod
+		err = resumeOption(run)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	} else {
+		if *fromStage != `` || *onlyStage != `` {
+			log.Fatal(`-from-stage and -stage require the -run-id of an existing run in ` + *runDir)
+		}
+		if *runID == `` {
+			*runID = runstate.NewID(bookingPeriod, time.Now())
+		}
+		run, err = runstate.Create(*runDir, *runID, bookingPeriod)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		// the posting rules are copied into the run so that every stage of the run books with the same rules
+		if *postingRuleFileName != `` {
+			runPostingRuleFileName := run.FileName(`posting_rules.csv`)
+			err = copyFile(*postingRuleFileName, runPostingRuleFileName)
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			*postingRuleFileName = runPostingRuleFileName
+		}
+		err = saveOption(run)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	// the run goes from firstStage to lastStage: by default from its failed stage, or its first stage, to its last stage
+	firstStage := run.ResumeStage(stageName())
+	lastStage := stageList[len(stageList)-1].name
+	switch {
+	case *onlyStage != ``:
+		firstStage, lastStage = *onlyStage, *onlyStage
+	case *fromStage != ``:
+		firstStage = *fromStage
+	case firstStage == ``:
+		log.Fatal(`all the stages of run ` + run.ID + ` are completed, use -from-stage or -stage to execute them again`)
+	}
+	for _, stage := range []string{firstStage, lastStage} {
+		_, err = stageIndex(stage)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	// stamp the booking period into every log line, the output files are stamped by run
+	log.SetPrefix(`[` + bookingPeriod.Label() + `] `)
+	log.Println(`booking period: from ` + bookingPeriod.FromDate() + ` (included) to ` + bookingPeriod.ToDate() + ` (excluded)`)
+	log.Println(`run ` + run.ID + `: from stage ` + firstStage + ` to stage ` + lastStage + `, saved in ` + run.Dir())
+
+	notifier, err := notify.New(*notifierName, notifierConfig)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	sender := notify.Sender{Notifier: notifier, Template: notify.DefaultTemplate, Label: bookingPeriod.Label()}
+	if *templateDir != `` {
+		sender.Template, err = notify.ReadTemplateDir(*templateDir)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	if *recipientFileName != `` {
+		sender.Recipient, err = notify.ReadRecipientCSV(*recipientFileName)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	err = sender.Validate()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	option := bookingOption{
+		reconciliationTolerance:       money.Rial(*reconciliationTolerance),
+		ngsBalanceTolerance:           money.Rial(*ngsBalanceTolerance),
+		allowUnbalancedDraft:          *allowUnbalancedDraft,
+		stopOnUnmappedTransactionType: *stopOnUnmappedTransactionType,
+		quarantineMissingMasterData:   *quarantineMissingMasterData,
+		bookQuarantineFileName:        *bookQuarantineFileName,
+		omsChunkSize:                  *omsChunkSize,
+		omsWorkerCount:                *omsWorkerCount,
+		accountCode:                   make(map[string]string),
+	}
+	for accountRole, accountCode := range accountCodeFlag {
+		if *accountCode != `` {
+			option.accountCode[accountRole] = *accountCode
+		}
+	}
+
+	// errorReport collects the issues of every validation and is sent to Finance once all the validations are done
+	errorReportFileName := run.FileName(`FinanceBookingErrorLog.csv`)
+	errorReport := errorreport.New(errorReportFileName, sender)
+	runStatus := runstatusrow.RunStatusRow{RunID: run.ID, StartedAt: time.Now().Format(time.RFC3339)}
+	booking := &booking{bookingPeriod: bookingPeriod, option: option, errorReport: errorReport,
+		run: run, sqliteFileName: run.FileName(`FinanceBooking.sqlite`)}
+	// the posting rules define how the final views are booked into the NGS template
+	// invalid posting rules are sent to Finance in errorReport and STOP the booking process before any stage
+	booking.postingRule, err = readPostingRule(errorReport, *postingRuleFileName)
+	if err == nil {
+		err = runStages(booking, run, firstStage, lastStage)
+	}
+	booking.close()
+	ngsTemplateFileName := booking.state.NgsTemplateFileName
+	reconciliationFileName := booking.state.ReconciliationFileName
+	runStatus.FinishedAt = time.Now().Format(time.RFC3339)
+	runStatus.IssueCount = errorReport.Len()
+	runStatus.OmsNotFoundCount = booking.state.OmsNotFoundCount
+	runStatus.NgsTemplate = ngsTemplateFileName
+	runStatus.Reconciliation = reconciliationFileName
+	if _, statErr := os.Stat(booking.sqliteFileName); statErr == nil {
+		runStatus.SQLite = booking.sqliteFileName
+	}
+	runStatus.Status = runstatusrow.Succeeded
+	if err != nil {
+		runStatus.Status = runstatusrow.Failed
+		runStatus.FailedStage = run.FailedStage
+		runStatus.Err = err.Error()
+		log.Println(`FAILURE: ` + err.Error())
+		if run.FailedStage != `` {
+			log.Println(`the run can be resumed from stage ` + run.FailedStage + ` with -run-id=` + run.ID)
+		}
+		// the issues found before the failure are sent to Finance, unless they already are
+		sendErr := errorReport.Send()
+		if sendErr != nil {
+			log.Println(`WARNING: could not send ` + errorReportFileName + `: ` + sendErr.Error())
+		}
+	}
+
+	// always emit the final status of the run, whether the booking succeeded or not
+	runStatusFileName := run.FileName(`FinanceBookingRunStatus.csv`)
+	writeErr := writeRunStatus(runStatusFileName, runStatus)
+	if writeErr != nil {
+		log.Println(`WARNING: could not write ` + runStatusFileName + `: ` + writeErr.Error())
+	}
+	log.Println(`run status: ` + runStatus.Status + `, please see ` + runStatusFileName)
+
+	if err != nil {
+		// notify Finance of the failure of the booking with the run status and the error report
+		notifyErr := sender.SendFailure(err, runStatusFileName, errorReportFileName)
+		if notifyErr != nil {
+			log.Println(`WARNING: could not notify ` + string(notify.RunFailed) + `: ` + notifyErr.Error())
+		}
+		os.Exit(1)
+	}
+
+	// notify Finance of the success of the booking with the NGS template and the reconciliation
+	err = sender.Send(notify.RunSucceeded, nil, ngsTemplateFileName, reconciliationFileName)
+	if err != nil {
+		log.Println(`WARNING: could not notify ` + string(notify.RunSucceeded) + `: ` + err.Error())
+	}
 
 }
 
-func uniqueOmsIDSalesOrderItem(sellerCenterTable []scomsrow.ScOmsRow) (uniqueOmsIDSalesOrderItemList string) {
+// bookingOptionFlag are the command line options which shape the booking:
+// they are saved with a new run and reused when the run is resumed, see saveOption and resumeOption
+var bookingOptionFlag = []string{
+	`reconciliation-tolerance`,
+	`ngs-balance-tolerance`,
+	`allow-unbalanced-draft`,
+	`stop-on-unmapped-transaction-type`,
+	`quarantine-missing-master-data`,
+	`book-quarantine`,
+	`posting-rules`,
+	`cancel-penalty-wi-24-account`,
+	`cancel-penalty-a-24-account`,
+	`cancel-penalty-vat-account`,
+	`rounding-difference-account`,
+}
+
+// saveOption saves the bookingOptionFlag of the command line with the new run
+func saveOption(run *runstate.Run) error {
+	option := make(map[string]string)
+	for _, name := range bookingOptionFlag {
+		option[name] = flag.Lookup(name).Value.String()
+	}
+	return run.SaveOption(option)
+}
+
+// resumeOption sets the bookingOptionFlag to the options saved with the resumed run
+// and refuses an option of the command line which differs from the saved one,
+// otherwise the stages of the same run could book with different options
+func resumeOption(run *runstate.Run) error {
+	isSet := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		isSet[f.Name] = true
+	})
+	for _, name := range bookingOptionFlag {
+		savedValue, ok := run.Option[name]
+		if !ok {
+			continue
+		}
+		if value := flag.Lookup(name).Value.String(); isSet[name] && value != savedValue {
+			return fmt.Errorf("-%s=%s differs from -%s=%s of run %s, please resume the run without -%s or start a new run", name, value, name, savedValue, run.ID, name)
+		}
+		err := flag.Set(name, savedValue)
+		if err != nil {
+			return fmt.Errorf("resume option -%s of run %s: %w", name, run.ID, err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies the file fromFileName to toFileName
+func copyFile(fromFileName, toFileName string) error {
+	content, err := ioutil.ReadFile(fromFileName)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(toFileName, content, os.ModePerm)
+}
+
+// readPostingRule returns the posting rules of postingRuleFileName, postingrule.Default if empty,
+// and adds the transaction_type views they define to arrayOfTransactionType
+// IfInvalidPostingRule STOPs the booking process if the posting rules are invalid
+func readPostingRule(errorReport *errorreport.Report, postingRuleFileName string) ([]postingrule.PostingRule, error) {
+	postingRule := postingrule.Default
+	if postingRuleFileName != `` {
+		var err error
+		postingRule, err = postingrule.ReadCSV(postingRuleFileName)
+		if err != nil {
+			return nil, validation.IfInvalidPostingRule(errorReport, []string{err.Error()})
+		}
+	}
+	invalid := postingrule.Invalid(postingRule)
+	if len(invalid) == 0 {
+		// a transaction_type which is not in arrayOfTransactionType is created from the id_transaction_type of its posting rules
+		iDTransactionType := postingrule.IDTransactionType(postingRule)
+		for _, otherTransactionType := range postingrule.OtherTransactionType(postingRule) {
+			id, ok := iDTransactionType[otherTransactionType]
+			switch {
+			case ok:
+				err := validate.AddTransactionType(id, otherTransactionType)
+				if err != nil {
+					invalid = append(invalid, err.Error())
+				}
+			case !validate.IsTransactionType(otherTransactionType):
+				invalid = append(invalid, `transaction_type `+otherTransactionType+` is not in arrayOfTransactionType, please define its id_transaction_type`)
+			}
+		}
+	}
+	return postingRule, validation.IfInvalidPostingRule(errorReport, invalid)
+}
+
+// bookingOption gathers the command line options of the booking process
+type bookingOption struct {
+	reconciliationTolerance       money.Rial
+	ngsBalanceTolerance           money.Rial
+	allowUnbalancedDraft          bool
+	stopOnUnmappedTransactionType bool
+	quarantineMissingMasterData   bool
+	bookQuarantineFileName        string
+	omsChunkSize                  int
+	omsWorkerCount                int
+	// accountCode overrides the Account Codes of chart_of_account table of BAA database
+	accountCode map[string]string
+}
+
+// writeRunStatus writes runStatus to runStatusFileName, overwriting the status of a previous execution of the same run
+func writeRunStatus(runStatusFileName string, runStatus runstatusrow.RunStatusRow) error {
+	file, err := os.Create(runStatusFileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return gocsv.MarshalFile(&[]*runstatusrow.RunStatusRow{&runStatus}, file)
+}
+
+// uniqueOmsIDSalesOrderItem returns the oms_id_sales_order_item of sellerCenterTable, each once, in order
+func uniqueOmsIDSalesOrderItem(sellerCenterTable []scomsrow.ScOmsRow) (uniqueOmsIDSalesOrderItemList []int) {
 
-	// initialize uniqueOmsIDSalesOrderItemMap with the first omsIDSalesOrderItem of sellerCenterTable
-	uniqueOmsIDSalesOrderItemMap := make(map[int]bool)
-	uniqueOmsIDSalesOrderItemMap[sellerCenterTable[0].OmsIDSalesOrderItem] = true
-	// initialize uniqueOmsIDSalesOrderItemList with the first omsIDSalesOrderItem of sellerCenterTable
-	uniqueOmsIDSalesOrderItemList = strconv.Itoa(sellerCenterTable[0].OmsIDSalesOrderItem)
 	// for each sellerCenterRow in sellerCenterTable
 	// check if there is already sellerCenterRow.omsIDSalesOrderItem in uniqueOmsIDSalesOrderItemMap
 	// if yes, then do nothing
 	// if no then add the omsIDSalesOrderItem to uniqueOmsIDSalesOrderItemMap and to uniqueOmsIDSalesOrderItemList
+	uniqueOmsIDSalesOrderItemMap := make(map[int]bool)
 	for _, sellerCenterRow := range sellerCenterTable {
 		if _, ok := uniqueOmsIDSalesOrderItemMap[sellerCenterRow.OmsIDSalesOrderItem]; !ok {
 			uniqueOmsIDSalesOrderItemMap[sellerCenterRow.OmsIDSalesOrderItem] = true
-			uniqueOmsIDSalesOrderItemList += `,` + strconv.Itoa(sellerCenterRow.OmsIDSalesOrderItem)
+			uniqueOmsIDSalesOrderItemList = append(uniqueOmsIDSalesOrderItemList, sellerCenterRow.OmsIDSalesOrderItem)
 		}
 
 	}
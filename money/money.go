@@ -0,0 +1,114 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Rial represents an exact amount of Iranian Rial
+// every monetary value of the booking process is stored in Rial as an integer:
+// - from Seller Center and OMS to SQLite, values are rounded half away from zero to the Rial by Scan
+// - in SQLite, divisions are rounded half away from zero to the Rial by RoundedDivisionSQL
+// - sums of Rial are exact
+type Rial int64
+
+// ParseRial parses a decimal string (e.g. 1234, -1234.50) exactly
+// and rounds it half away from zero to the Rial
+func ParseRial(decimal string) (Rial, error) {
+
+	decimal = strings.TrimSpace(decimal)
+	negative := strings.HasPrefix(decimal, `-`)
+	unsigned := strings.TrimPrefix(strings.TrimPrefix(decimal, `-`), `+`)
+	if unsigned == `` || unsigned == `.` {
+		return 0, fmt.Errorf("invalid amount %q: not a decimal number", decimal)
+	}
+	integerPart, fractionalPart := unsigned, ``
+	if i := strings.Index(unsigned, `.`); i >= 0 {
+		integerPart, fractionalPart = unsigned[:i], unsigned[i+1:]
+	}
+	if integerPart == `` {
+		integerPart = `0`
+	}
+	for _, digit := range integerPart + fractionalPart {
+		if digit < '0' || digit > '9' {
+			return 0, fmt.Errorf("invalid amount %q: not a decimal number", decimal)
+		}
+	}
+
+	rial, err := strconv.ParseInt(integerPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %v", decimal, err)
+	}
+	// the fractional part is at least half a Rial if its first digit is at least 5
+	if fractionalPart != `` && fractionalPart[0] >= '5' {
+		rial++
+	}
+	if negative {
+		rial = -rial
+	}
+	return Rial(rial), nil
+}
+
+// FromFloat rounds value half away from zero to the Rial
+// FYI: only use it for values which are already exact in float64 (e.g. SQLite REAL of integers)
+func FromFloat(value float64) Rial {
+	return Rial(math.Round(value))
+}
+
+// Abs returns the absolute value of rial
+func (rial Rial) Abs() Rial {
+	if rial < 0 {
+		return -rial
+	}
+	return rial
+}
+
+// String formats rial as an integer
+func (rial Rial) String() string {
+	return strconv.FormatInt(int64(rial), 10)
+}
+
+// Scan implements sql.Scanner so that Rial can be scanned from Seller Center, OMS and SQLite:
+// NULL is scanned as 0 to be caught by validation
+func (rial *Rial) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*rial = 0
+	case int64:
+		*rial = Rial(v)
+	case float64:
+		*rial = FromFloat(v)
+	case []byte:
+		parsed, err := ParseRial(string(v))
+		if err != nil {
+			return err
+		}
+		*rial = parsed
+	case string:
+		parsed, err := ParseRial(v)
+		if err != nil {
+			return err
+		}
+		*rial = parsed
+	default:
+		return fmt.Errorf("cannot scan %T into money.Rial", value)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer so that Rial is stored as INTEGER in SQLite
+func (rial Rial) Value() (driver.Value, error) {
+	return int64(rial), nil
+}
+
+// RoundedDivisionSQL returns the SQLite expression of numerator / denominator
+// rounded half away from zero to the Rial with integer arithmetic only
+// numerator and denominator should be INTEGER SQLite expressions and denominator should be positive
+func RoundedDivisionSQL(numerator, denominator string) string {
+	return `(CASE WHEN (` + numerator + `) >= 0 
+		THEN ((` + numerator + `)*2 + (` + denominator + `)) / (2*(` + denominator + `)) 
+		ELSE -(((` + numerator + `)*-2 + (` + denominator + `)) / (2*(` + denominator + `))) END)`
+}
@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thomas-bamilo/email/goemail"
+)
+
+// GoEmailNotifier sends FinanceBookingErrorLog.csv of the working directory with goemail.GoEmail() to its fixed recipients:
+// goemail cannot take recipients, subject, body or attachments, see Sender.Validate
+// the error report attached to a message, if any, is copied to FinanceBookingErrorLog.csv before sending it,
+// a message without error report is not sent, and the error report is sent once per run
+// since the error report is attached to both the issues and the failure of a run
+type GoEmailNotifier struct {
+	sent bool
+}
+
+// goEmailFileName is the file goemail.GoEmail() attaches by name
+const goEmailFileName = `FinanceBookingErrorLog.csv`
+
+// Notify copies the error report attached to message to FinanceBookingErrorLog.csv and sends it with goemail.GoEmail()
+func (notifier *GoEmailNotifier) Notify(message Message) error {
+
+	if notifier.sent {
+		return nil
+	}
+	errorReportFileName := ``
+	for _, fileName := range message.Attachment {
+		if strings.HasPrefix(filepath.Base(fileName), strings.TrimSuffix(goEmailFileName, `.csv`)) && filepath.Ext(fileName) == `.csv` {
+			errorReportFileName = fileName
+		}
+	}
+	if errorReportFileName == `` {
+		return nil
+	}
+	content, err := ioutil.ReadFile(errorReportFileName)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(goEmailFileName, content, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	goemail.GoEmail()
+	notifier.sent = true
+	return nil
+}
+
+// SMTPNotifier sends a message by email from From through the SMTP server at Addr (host:port),
+// authenticated with Username and Password if Username is not empty
+type SMTPNotifier struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Notify sends message by email with its attachments
+func (notifier SMTPNotifier) Notify(message Message) error {
+
+	if len(message.Recipient) == 0 {
+		return fmt.Errorf("no recipient for event %s", message.Event)
+	}
+
+	var email bytes.Buffer
+	emailPart := multipart.NewWriter(&email)
+	fmt.Fprintf(&email, "From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n",
+		notifier.From, strings.Join(message.Recipient, `, `), mime.QEncoding.Encode(`utf-8`, message.Subject), emailPart.Boundary())
+
+	bodyPart, err := emailPart.CreatePart(textproto.MIMEHeader{`Content-Type`: {`text/plain; charset=utf-8`}})
+	if err != nil {
+		return err
+	}
+	_, err = bodyPart.Write([]byte(strings.Replace(message.Body, "\n", "\r\n", -1)))
+	if err != nil {
+		return err
+	}
+
+	for _, fileName := range message.Attachment {
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		attachmentPart, err := emailPart.CreatePart(textproto.MIMEHeader{
+			`Content-Type`:              {mime.FormatMediaType(`application/octet-stream`, map[string]string{`name`: filepath.Base(fileName)})},
+			`Content-Disposition`:       {mime.FormatMediaType(`attachment`, map[string]string{`filename`: filepath.Base(fileName)})},
+			`Content-Transfer-Encoding`: {`base64`},
+		})
+		if err != nil {
+			return err
+		}
+		// base64 lines of an email are at most 76 characters
+		encoded := base64.StdEncoding.EncodeToString(content)
+		for len(encoded) > 0 {
+			line := encoded
+			if len(line) > 76 {
+				line = line[:76]
+			}
+			_, err = attachmentPart.Write([]byte(line + "\r\n"))
+			if err != nil {
+				return err
+			}
+			encoded = encoded[len(line):]
+		}
+	}
+	err = emailPart.Close()
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if notifier.Username != `` {
+		auth = smtp.PlainAuth(``, notifier.Username, notifier.Password, strings.Split(notifier.Addr, `:`)[0])
+	}
+	return smtp.SendMail(notifier.Addr, auth, notifier.From, message.Recipient, email.Bytes())
+}
+
+// DirNotifier writes a message into a new directory of Dir instead of sending it, e.g. to run the booking offline:
+// message.txt holds its recipients, subject and body, next to a copy of its attachments
+type DirNotifier struct {
+	Dir string
+}
+
+// Notify writes message into Dir/<time>_<event>
+func (notifier DirNotifier) Notify(message Message) error {
+
+	messageDir := filepath.Join(notifier.Dir, time.Now().Format(`20060102-150405.000000`)+`_`+string(message.Event))
+	err := os.MkdirAll(messageDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	text := `To: ` + strings.Join(message.Recipient, `, `) + "\nSubject: " + message.Subject + "\n\n" + message.Body
+	err = ioutil.WriteFile(filepath.Join(messageDir, `message.txt`), []byte(text), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	for _, fileName := range message.Attachment {
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(messageDir, filepath.Base(fileName)), content, os.ModePerm)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WebhookNotifier posts a message as json to URL with its attachments encoded in base64
+type WebhookNotifier struct {
+	URL string
+	// Client posts the message, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// webhookAttachment is an attachment of the json posted by WebhookNotifier
+type webhookAttachment struct {
+	FileName string `json:"file_name"`
+	Content  []byte `json:"content"`
+}
+
+// Notify posts message to URL and fails unless URL answers with a 2xx status
+func (notifier WebhookNotifier) Notify(message Message) error {
+
+	payload := struct {
+		Message
+		Attachment []webhookAttachment `json:"attachment"`
+	}{Message: message}
+	for _, fileName := range message.Attachment {
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		payload.Attachment = append(payload.Attachment, webhookAttachment{FileName: filepath.Base(fileName), Content: content})
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := notifier.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Post(notifier.URL, `application/json`, bytes.NewReader(payloadJSON))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook %s answered %s", notifier.URL, response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/gocarina/gocsv"
+)
+
+// Event of the booking process Finance is notified of
+type Event string
+
+// Event of the booking process
+const (
+	InvalidRows       Event = `invalid_rows`
+	MissingMasterData Event = `missing_master_data`
+	RunSucceeded      Event = `run_succeeded`
+	RunFailed         Event = `run_failed`
+)
+
+// Any is the category of RecipientRow notified of every event
+const Any = `*`
+
+// Message is a notification sent by a Notifier
+type Message struct {
+	Event      Event    `json:"event"`
+	Recipient  []string `json:"recipient"`
+	Subject    string   `json:"subject"`
+	Body       string   `json:"body"`
+	Attachment []string `json:"-"`
+}
+
+// Notifier sends a Message, e.g. by email, see SMTPNotifier, DirNotifier and WebhookNotifier
+type Notifier interface {
+	Notify(message Message) error
+}
+
+// Template is the text/template of the subject and body of the messages of an event, executed with Data
+type Template struct {
+	Subject string
+	Body    string
+}
+
+// DefaultTemplate is the Template of each Event
+var DefaultTemplate = map[Event]Template{
+	InvalidRows: {
+		Subject: `[{{.Label}}] Finance booking: {{.IssueCount}} issues`,
+		Body: `Hello,
+
+the finance booking of {{.Label}} found the following issues:
+{{range .Category}}- {{.Category}}: {{.IssueCount}}
+{{end}}
+Please see the attached files for more details.
+`,
+	},
+	MissingMasterData: {
+		Subject: `[{{.Label}}] Finance booking: missing master data`,
+		Body: `Hello,
+
+the finance booking of {{.Label}} found the following issues:
+{{range .Category}}- {{.Category}}: {{.IssueCount}}
+{{end}}
+Please fill in the attached templates, save them as benef_code_map.csv or ledger_map.csv and upload them with userinteract.
+`,
+	},
+	RunSucceeded: {
+		Subject: `[{{.Label}}] Finance booking succeeded`,
+		Body: `Hello,
+
+the finance booking of {{.Label}} succeeded, please find attached:
+{{range .Attachment}}- {{.}}
+{{end}}`,
+	},
+	RunFailed: {
+		Subject: `[{{.Label}}] Finance booking FAILED`,
+		Body: `Hello,
+
+the finance booking of {{.Label}} failed:
+{{.Err}}
+{{if .Attachment}}
+Please see the attached files for more details:
+{{range .Attachment}}- {{.}}
+{{end}}{{end}}`,
+	},
+}
+
+// Data is the data of a Template
+type Data struct {
+	Label      string
+	Event      Event
+	IssueCount int
+	Category   []CategoryIssueCount
+	Attachment []string
+	// Err is the error which stopped the booking process, see RunFailed
+	Err string
+}
+
+// CategoryIssueCount is the number of issues of a category
+type CategoryIssueCount struct {
+	Category   string
+	IssueCount int
+}
+
+// ReadTemplateDir overrides the templates of DefaultTemplate with the files <event>.txt of dir, if any:
+// the first line of the file is the subject template and the other lines are the body template
+func ReadTemplateDir(dir string) (eventTemplate map[Event]Template, err error) {
+
+	eventTemplate = make(map[Event]Template)
+	for event, defaultTemplate := range DefaultTemplate {
+		eventTemplate[event] = defaultTemplate
+		content, err := ioutil.ReadFile(filepath.Join(dir, string(event)+`.txt`))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		subjectBody := strings.SplitN(string(content), "\n", 2)
+		if len(subjectBody) < 2 {
+			return nil, fmt.Errorf("invalid notification template %s.txt: no body after the subject line", event)
+		}
+		eventTemplate[event] = Template{Subject: strings.TrimSpace(subjectBody[0]), Body: subjectBody[1]}
+	}
+	return eventTemplate, nil
+}
+
+// RecipientRow represents a row of the notification recipient csv file:
+// Recipient is notified of the issues of Category, of Event if Category is an Event, or of every event if Category is Any
+type RecipientRow struct {
+	Category  string `csv:"category"`
+	Recipient string `csv:"recipient"`
+}
+
+// ReadRecipientCSV reads the recipients of fileName, a csv file with the csv columns of RecipientRow
+func ReadRecipientCSV(fileName string) (recipientTable []RecipientRow, err error) {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	err = gocsv.UnmarshalFile(file, &recipientTable)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification recipients %s: %v", fileName, err)
+	}
+	return recipientTable, nil
+}
+
+// Recipient returns the recipients of recipientTable notified of any of category, without duplicate
+func Recipient(recipientTable []RecipientRow, category ...string) (recipient []string) {
+	isRecipient := make(map[string]bool)
+	for _, row := range recipientTable {
+		for _, oneCategory := range append(category, Any) {
+			if row.Category == oneCategory && !isRecipient[row.Recipient] {
+				isRecipient[row.Recipient] = true
+				recipient = append(recipient, row.Recipient)
+			}
+		}
+	}
+	return recipient
+}
+
+// Sender renders the messages of each event with Template and sends them with Notifier to the recipients of their categories
+type Sender struct {
+	Notifier  Notifier
+	Template  map[Event]Template
+	Recipient []RecipientRow
+	// Label identifies the booking run in the messages, e.g. the label of the booking period
+	Label string
+}
+
+// Validate checks that every message of sender can be sent as configured:
+// GoEmailNotifier cannot send to Recipient nor render Template, and SMTPNotifier needs a recipient for every event
+func (sender Sender) Validate() error {
+	switch sender.Notifier.(type) {
+	case *GoEmailNotifier:
+		if len(sender.Recipient) > 0 || !reflect.DeepEqual(sender.Template, DefaultTemplate) {
+			return fmt.Errorf("goemail notifier sends to fixed recipients without template, please use the smtp notifier for notification recipients and templates")
+		}
+	case SMTPNotifier:
+		for _, event := range []Event{InvalidRows, MissingMasterData, RunSucceeded, RunFailed} {
+			if len(Recipient(sender.Recipient, string(event))) == 0 {
+				return fmt.Errorf("smtp notifier has no recipient for event %s, please add a recipient of category %s or %s to the notification recipients", event, event, Any)
+			}
+		}
+	}
+	return nil
+}
+
+// Send notifies event with the number of issues of each category of issueCount and attachment
+func (sender Sender) Send(event Event, issueCount map[string]int, attachment ...string) error {
+	return sender.send(Data{Label: sender.Label, Event: event}, issueCount, attachment)
+}
+
+// SendFailure notifies RunFailed with runErr, the error which stopped the booking process, and attachment
+func (sender Sender) SendFailure(runErr error, attachment ...string) error {
+	return sender.send(Data{Label: sender.Label, Event: RunFailed, Err: runErr.Error()}, nil, attachment)
+}
+
+func (sender Sender) send(data Data, issueCount map[string]int, attachment []string) error {
+
+	event := data.Event
+	category := []string{string(event)}
+	for oneCategory, count := range issueCount {
+		data.Category = append(data.Category, CategoryIssueCount{Category: oneCategory, IssueCount: count})
+		data.IssueCount += count
+		category = append(category, oneCategory)
+	}
+	sort.Slice(data.Category, func(i, j int) bool { return data.Category[i].Category < data.Category[j].Category })
+	for _, fileName := range attachment {
+		data.Attachment = append(data.Attachment, filepath.Base(fileName))
+	}
+
+	eventTemplate, ok := sender.Template[event]
+	if !ok {
+		eventTemplate, ok = DefaultTemplate[event]
+	}
+	if !ok {
+		return fmt.Errorf("no notification template for event %s", event)
+	}
+	subject, err := execute(`subject`, eventTemplate.Subject, data)
+	if err != nil {
+		return err
+	}
+	body, err := execute(`body`, eventTemplate.Body, data)
+	if err != nil {
+		return err
+	}
+
+	return sender.Notifier.Notify(Message{
+		Event:      event,
+		Recipient:  Recipient(sender.Recipient, category...),
+		Subject:    subject,
+		Body:       body,
+		Attachment: attachment,
+	})
+}
+
+func execute(name, text string, data Data) (string, error) {
+	textTemplate, err := template.New(name).Parse(text)
+	if err != nil {
+		return ``, fmt.Errorf("invalid notification template of %s %s: %v", data.Event, name, err)
+	}
+	var executed bytes.Buffer
+	err = textTemplate.Execute(&executed, data)
+	if err != nil {
+		return ``, fmt.Errorf("invalid notification template of %s %s: %v", data.Event, name, err)
+	}
+	return executed.String(), nil
+}
+
+// Config configures the Notifier returned by New
+type Config struct {
+	SMTPAddr     string
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string
+	WebhookURL   string
+}
+
+// New returns the Notifier named name: goemail, smtp, dir or webhook
+func New(name string, config Config) (Notifier, error) {
+	switch name {
+	case `goemail`:
+		return &GoEmailNotifier{}, nil
+	case `smtp`:
+		if config.SMTPAddr == `` || config.SMTPFrom == `` {
+			return nil, fmt.Errorf("smtp notifier requires an SMTP address and a sender")
+		}
+		return SMTPNotifier{Addr: config.SMTPAddr, From: config.SMTPFrom, Username: config.SMTPUsername, Password: config.SMTPPassword}, nil
+	case `dir`:
+		if config.Dir == `` {
+			return nil, fmt.Errorf("dir notifier requires a directory")
+		}
+		return DirNotifier{Dir: config.Dir}, nil
+	case `webhook`:
+		if config.WebhookURL == `` {
+			return nil, fmt.Errorf("webhook notifier requires a URL")
+		}
+		return WebhookNotifier{URL: config.WebhookURL}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier %s: expected goemail, smtp, dir or webhook", name)
+}
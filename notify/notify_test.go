@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// recordNotifier records the messages it is asked to send
+type recordNotifier struct {
+	message []Message
+}
+
+func (notifier *recordNotifier) Notify(message Message) error {
+	notifier.message = append(notifier.message, message)
+	return nil
+}
+
+func TestRecipient(t *testing.T) {
+	recipientTable := []RecipientRow{
+		{Category: `missing_ledger_map`, Recipient: `ledger@finance`},
+		{Category: string(MissingMasterData), Recipient: `master@finance`},
+		{Category: `missing_beneficiary_code`, Recipient: `master@finance`},
+		{Category: Any, Recipient: `all@finance`},
+		{Category: string(RunFailed), Recipient: `ops@finance`},
+	}
+	tests := []struct {
+		name     string
+		category []string
+		want     []string
+	}{
+		{
+			name:     "event and categories without duplicate, in the order of the recipients",
+			category: []string{string(MissingMasterData), `missing_ledger_map`, `missing_beneficiary_code`},
+			want:     []string{`ledger@finance`, `master@finance`, `all@finance`},
+		},
+		{
+			name:     "only the recipients of the event and of every event",
+			category: []string{string(RunFailed)},
+			want:     []string{`all@finance`, `ops@finance`},
+		},
+		{
+			name:     "recipients of every event for an unknown category",
+			category: []string{`invalid_vat_rate`},
+			want:     []string{`all@finance`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Recipient(recipientTable, tt.category...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Recipient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := Recipient(nil, string(RunFailed)); got != nil {
+		t.Errorf("Recipient() without recipient table = %v, want nil", got)
+	}
+}
+
+func TestSenderSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		send        func(sender Sender) error
+		wantMessage Message
+	}{
+		{
+			name: "issues by category in alphabetical order",
+			send: func(sender Sender) error {
+				return sender.Send(InvalidRows, map[string]int{`invalid_vat_rate`: 1, `failed_sqlite_load`: 2}, `run/FinanceBookingErrorLog_2018-04_x.csv`)
+			},
+			wantMessage: Message{
+				Event:      InvalidRows,
+				Recipient:  []string{`rows@finance`, `sqlite@finance`},
+				Subject:    `[2018-04] 3 issues`,
+				Body:       "failed_sqlite_load: 2\ninvalid_vat_rate: 1\nFinanceBookingErrorLog_2018-04_x.csv\n",
+				Attachment: []string{`run/FinanceBookingErrorLog_2018-04_x.csv`},
+			},
+		},
+		{
+			name: "failure with the error which stopped the booking",
+			send: func(sender Sender) error {
+				return sender.SendFailure(errors.New(`invalid posting rules`), `run/status.csv`)
+			},
+			wantMessage: Message{
+				Event:      RunFailed,
+				Subject:    `[2018-04] failed`,
+				Body:       "invalid posting rules\nstatus.csv\n",
+				Attachment: []string{`run/status.csv`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &recordNotifier{}
+			sender := Sender{
+				Notifier: notifier,
+				Template: map[Event]Template{
+					InvalidRows: {
+						Subject: `[{{.Label}}] {{.IssueCount}} issues`,
+						Body:    "{{range .Category}}{{.Category}}: {{.IssueCount}}\n{{end}}{{range .Attachment}}{{.}}\n{{end}}",
+					},
+					RunFailed: {
+						Subject: `[{{.Label}}] failed`,
+						Body:    "{{.Err}}\n{{range .Attachment}}{{.}}\n{{end}}",
+					},
+				},
+				Recipient: []RecipientRow{
+					{Category: string(InvalidRows), Recipient: `rows@finance`},
+					{Category: `failed_sqlite_load`, Recipient: `sqlite@finance`},
+				},
+				Label: `2018-04`,
+			}
+			err := tt.send(sender)
+			if err != nil {
+				t.Fatalf("send error = %v", err)
+			}
+			if len(notifier.message) != 1 {
+				t.Fatalf("send notified %d messages, want 1", len(notifier.message))
+			}
+			if got := notifier.message[0]; !reflect.DeepEqual(got, tt.wantMessage) {
+				t.Errorf("send notified %+v, want %+v", got, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestSenderSendTemplate(t *testing.T) {
+	notifier := &recordNotifier{}
+	sender := Sender{Notifier: notifier, Template: map[Event]Template{InvalidRows: {Subject: `{{.Unknown}}`}}}
+	if err := sender.Send(InvalidRows, nil); err == nil {
+		t.Errorf("Send() with an invalid template error = nil, want an error")
+	}
+	// an event without template of sender is rendered with DefaultTemplate
+	err := sender.Send(RunSucceeded, nil, `ngs.csv`)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(notifier.message) != 1 || notifier.message[0].Subject != `[] Finance booking succeeded` {
+		t.Errorf("Send() notified %+v, want the subject of DefaultTemplate", notifier.message)
+	}
+}
+
+func TestReadTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, string(RunSucceeded)+`.txt`), []byte("Booked {{.Label}}\nDone.\n"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventTemplate, err := ReadTemplateDir(dir)
+	if err != nil {
+		t.Fatalf("ReadTemplateDir() error = %v", err)
+	}
+	if want := (Template{Subject: `Booked {{.Label}}`, Body: "Done.\n"}); eventTemplate[RunSucceeded] != want {
+		t.Errorf("ReadTemplateDir() %s = %+v, want %+v", RunSucceeded, eventTemplate[RunSucceeded], want)
+	}
+	if eventTemplate[RunFailed] != DefaultTemplate[RunFailed] {
+		t.Errorf("ReadTemplateDir() %s = %+v, want DefaultTemplate", RunFailed, eventTemplate[RunFailed])
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, string(RunFailed)+`.txt`), []byte(`subject only`), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadTemplateDir(dir); err == nil {
+		t.Errorf("ReadTemplateDir() with a template without body error = nil, want an error")
+	}
+}
+
+func TestSenderValidate(t *testing.T) {
+	everyEvent := []RecipientRow{{Category: Any, Recipient: `all@finance`}}
+	tests := []struct {
+		name    string
+		sender  Sender
+		wantErr bool
+	}{
+		{name: "goemail with default templates", sender: Sender{Notifier: &GoEmailNotifier{}, Template: DefaultTemplate}},
+		{name: "goemail with recipients", sender: Sender{Notifier: &GoEmailNotifier{}, Template: DefaultTemplate, Recipient: everyEvent}, wantErr: true},
+		{name: "goemail with templates", sender: Sender{Notifier: &GoEmailNotifier{}, Template: map[Event]Template{}}, wantErr: true},
+		{name: "smtp with a recipient of every event", sender: Sender{Notifier: SMTPNotifier{}, Recipient: everyEvent}},
+		{name: "smtp without recipient", sender: Sender{Notifier: SMTPNotifier{}}, wantErr: true},
+		{name: "smtp without recipient of run_failed", sender: Sender{Notifier: SMTPNotifier{}, Recipient: []RecipientRow{
+			{Category: string(InvalidRows), Recipient: `a@finance`},
+			{Category: string(MissingMasterData), Recipient: `a@finance`},
+			{Category: string(RunSucceeded), Recipient: `a@finance`},
+		}}, wantErr: true},
+		{name: "dir without recipient", sender: Sender{Notifier: DirNotifier{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sender.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDirNotifier(t *testing.T) {
+	dir := t.TempDir()
+	attachment := filepath.Join(dir, `report.csv`)
+	err := ioutil.WriteFile(attachment, []byte(`a,b`), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := DirNotifier{Dir: filepath.Join(dir, `notification`)}
+	err = notifier.Notify(Message{Event: RunFailed, Recipient: []string{`a@finance`, `b@finance`}, Subject: `subject`, Body: `body`, Attachment: []string{attachment}})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	messageDir, err := filepath.Glob(filepath.Join(notifier.Dir, `*_`+string(RunFailed)))
+	if err != nil || len(messageDir) != 1 {
+		t.Fatalf("Notify() wrote %v, want one message directory", messageDir)
+	}
+	text, err := ioutil.ReadFile(filepath.Join(messageDir[0], `message.txt`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "To: a@finance, b@finance\nSubject: subject\n\nbody"; string(text) != want {
+		t.Errorf("message.txt = %q, want %q", text, want)
+	}
+	if _, err := os.Stat(filepath.Join(messageDir[0], `report.csv`)); err != nil {
+		t.Errorf("Notify() did not copy the attachment: %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+package postingrule
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gocarina/gocsv"
+	"github.com/thomas-bamilo/financebooking/chartofaccount"
+)
+
+// Account Free of a PostingRule, any other Account Free must be an integer booked as is
+const (
+	// NoAccountFree books NULL as Account Free
+	NoAccountFree = ``
+	// Subledger books the subledger column of SourceView if AccountColumn is booked at subledger level, NULL otherwise
+	Subledger = `subledger`
+	// BeneficiaryCode books the beneficiary_code column of SourceView
+	BeneficiaryCode = `beneficiary_code`
+)
+
+// Operator of the filter of a PostingRule
+const (
+	// Equal books the rows whose FilterColumn equals FilterValue
+	Equal = `=`
+	// NotEqual books the rows whose FilterColumn differs from FilterValue
+	NotEqual = `<>`
+)
+
+// OtherTransactionFinal is the final view of transform booking fees charged to sellers and credits given to sellers
+const OtherTransactionFinal = `other_transaction_final`
+
+// ledgerBookedAtSubledgerLevel lists the ledgers booked with their subledger as Account Free
+const ledgerBookedAtSubledgerLevel = `'13004','33001','31006','33002','84006','32021','94001'`
+
+// PostingRule books the Amount of the rows of SourceView on an Account Code and an Account Free into LedgerAmountView
+// and their counterpart on chartofaccount.SellerPayable with beneficiary_code as Account Free
+type PostingRule struct {
+	// LedgerAmountView is the SQLite view created from the rule, several rules can be booked into the same LedgerAmountView
+	LedgerAmountView string `csv:"ledger_amount_view"`
+	// SourceView is the final view of transform booked by the rule, e.g. commission_final
+	SourceView string `csv:"source_view"`
+	// TransactionType is only used with OtherTransactionFinal: the transaction_type view of validate booked by the rule
+	// e.g. storage_fee - adding a fee or credit only requires its posting rules
+	TransactionType string `csv:"transaction_type"`
+	// IDTransactionType is the comma separated id_transaction_type of Seller Center of a TransactionType
+	// which is not in arrayOfTransactionType of validate, e.g. 13,14
+	IDTransactionType string `csv:"id_transaction_type"`
+	// FilterColumn, FilterOperator (Equal or NotEqual) and FilterValue filter the rows of SourceView booked by the rule
+	// e.g. cancel_penalty_type = cancel_penalty_wi_24 - FilterValue is compared as an integer if it is one, as a string otherwise
+	FilterColumn   string `csv:"filter_column"`
+	FilterOperator string `csv:"filter_operator"`
+	FilterValue    string `csv:"filter_value"`
+	// AccountRole is the chartofaccount.Role of Account Code
+	AccountRole string `csv:"account_role"`
+	// AccountColumn is the column of SourceView booked as Account Code instead of AccountRole, e.g. ledger
+	AccountColumn string `csv:"account_column"`
+	// AccountFree is NoAccountFree, Subledger, BeneficiaryCode or an integer booked as is
+	AccountFree string `csv:"account_free"`
+	// Amount is the column of SourceView booked as Amount, multiplied by Sign (1 or -1)
+	Amount string `csv:"amount"`
+	Sign   int    `csv:"sign"`
+}
+
+// Default lists the posting rules of the NGS template, in the order of the NGS template
+var Default = []PostingRule{
+	{LedgerAmountView: `voucher_ledger_amount`, SourceView: `ipc_final`, AccountRole: chartofaccount.Voucher, AccountFree: NoAccountFree, Amount: `voucher`, Sign: 1},
+	{LedgerAmountView: `voucher_ledger_amount`, SourceView: `ipt_final`, AccountRole: chartofaccount.Voucher, AccountFree: NoAccountFree, Amount: `voucher`, Sign: 1},
+	// ledgers not booked at subledger level are rolled up at ledger level
+	// so that every paid_price booked on chartofaccount.SellerPayable is also booked on its ledger
+	{LedgerAmountView: `ipc_paid_price_ledger_amount`, SourceView: `ipc_final`, AccountColumn: `ledger`, AccountFree: Subledger, Amount: `paid_price`, Sign: 1},
+	{LedgerAmountView: `ipt_paid_price_ledger_amount`, SourceView: `ipt_final`, AccountColumn: `ledger`, AccountFree: Subledger, Amount: `paid_price`, Sign: 1},
+	{LedgerAmountView: `commission_vat_ledger_amount`, SourceView: `commission_final`, AccountRole: chartofaccount.CommissionVat, AccountFree: NoAccountFree, Amount: `commission_vat`, Sign: 1},
+	{LedgerAmountView: `commission_revenue_ledger_amount`, SourceView: `commission_final`, AccountRole: chartofaccount.CommissionRevenue, AccountFree: BeneficiaryCode, Amount: `commission_revenue`, Sign: 1},
+	{LedgerAmountView: `shipping_fee_vat_ledger_amount`, SourceView: `shipping_fee_final`, AccountRole: chartofaccount.ShippingFeeVat, AccountFree: NoAccountFree, Amount: `shipping_fee_vat`, Sign: 1},
+	{LedgerAmountView: `shipping_fee_ledger_amount`, SourceView: `shipping_fee_final`, AccountRole: chartofaccount.ShippingFee, AccountFree: BeneficiaryCode, Amount: `shipping_fee_revenue`, Sign: 1},
+	{LedgerAmountView: `cancel_penalty_vat_ledger_amount`, SourceView: `cancel_penalty_final`, AccountRole: chartofaccount.CancelPenaltyVat, AccountFree: NoAccountFree, Amount: `cancel_penalty_vat`, Sign: 1},
+	// penalties within and after 24h are booked on different Account Codes
+	{LedgerAmountView: `cancel_penalty_revenue_ledger_amount`, SourceView: `cancel_penalty_final`, FilterColumn: `cancel_penalty_type`, FilterOperator: Equal, FilterValue: `cancel_penalty_wi_24`, AccountRole: chartofaccount.CancelPenaltyRevenueWithin24h, AccountFree: BeneficiaryCode, Amount: `cancel_penalty_revenue`, Sign: 1},
+	{LedgerAmountView: `cancel_penalty_revenue_ledger_amount`, SourceView: `cancel_penalty_final`, FilterColumn: `cancel_penalty_type`, FilterOperator: Equal, FilterValue: `cancel_penalty_a_24`, AccountRole: chartofaccount.CancelPenaltyRevenueAfter24h, AccountFree: BeneficiaryCode, Amount: `cancel_penalty_revenue`, Sign: 1},
+	// fees charged to sellers are booked net of VAT, credits given to sellers are booked without VAT
+	{LedgerAmountView: `other_transaction_vat_ledger_amount`, SourceView: OtherTransactionFinal, TransactionType: `consign_handling_fee`, AccountRole: chartofaccount.OtherTransactionVat, AccountFree: NoAccountFree, Amount: `other_transaction_vat`, Sign: 1},
+	{LedgerAmountView: `other_transaction_vat_ledger_amount`, SourceView: OtherTransactionFinal, TransactionType: `storage_fee`, AccountRole: chartofaccount.OtherTransactionVat, AccountFree: NoAccountFree, Amount: `other_transaction_vat`, Sign: 1},
+	{LedgerAmountView: `other_transaction_ledger_amount`, SourceView: OtherTransactionFinal, TransactionType: `consign_handling_fee`, AccountRole: chartofaccount.ConsignHandlingFee, AccountFree: BeneficiaryCode, Amount: `other_transaction_revenue`, Sign: 1},
+	{LedgerAmountView: `other_transaction_ledger_amount`, SourceView: OtherTransactionFinal, TransactionType: `storage_fee`, AccountRole: chartofaccount.StorageFee, AccountFree: BeneficiaryCode, Amount: `other_transaction_revenue`, Sign: 1},
+	{LedgerAmountView: `other_transaction_ledger_amount`, SourceView: OtherTransactionFinal, TransactionType: `down_payment_credit`, AccountRole: chartofaccount.DownPaymentCredit, AccountFree: BeneficiaryCode, Amount: `other_transaction_amount`, Sign: 1},
+	{LedgerAmountView: `other_transaction_ledger_amount`, SourceView: OtherTransactionFinal, TransactionType: `lost_damaged_credit`, AccountRole: chartofaccount.LostDamagedCredit, AccountFree: BeneficiaryCode, Amount: `other_transaction_amount`, Sign: 1},
+	// rows without rounding difference are left out so that nothing is booked when revenue + VAT already ties
+	{LedgerAmountView: `rounding_difference_ledger_amount`, SourceView: `commission_final`, FilterColumn: `commission_rounding_difference`, FilterOperator: NotEqual, FilterValue: `0`, AccountRole: chartofaccount.RoundingDifference, AccountFree: NoAccountFree, Amount: `commission_rounding_difference`, Sign: 1},
+	{LedgerAmountView: `rounding_difference_ledger_amount`, SourceView: `cancel_penalty_final`, FilterColumn: `cancel_penalty_rounding_difference`, FilterOperator: NotEqual, FilterValue: `0`, AccountRole: chartofaccount.RoundingDifference, AccountFree: NoAccountFree, Amount: `cancel_penalty_rounding_difference`, Sign: 1},
+	{LedgerAmountView: `rounding_difference_ledger_amount`, SourceView: `shipping_fee_final`, FilterColumn: `shipping_fee_rounding_difference`, FilterOperator: NotEqual, FilterValue: `0`, AccountRole: chartofaccount.RoundingDifference, AccountFree: NoAccountFree, Amount: `shipping_fee_rounding_difference`, Sign: 1},
+	{LedgerAmountView: `rounding_difference_ledger_amount`, SourceView: OtherTransactionFinal, TransactionType: `consign_handling_fee`, FilterColumn: `other_transaction_rounding_difference`, FilterOperator: NotEqual, FilterValue: `0`, AccountRole: chartofaccount.RoundingDifference, AccountFree: NoAccountFree, Amount: `other_transaction_rounding_difference`, Sign: 1},
+	{LedgerAmountView: `rounding_difference_ledger_amount`, SourceView: OtherTransactionFinal, TransactionType: `storage_fee`, FilterColumn: `other_transaction_rounding_difference`, FilterOperator: NotEqual, FilterValue: `0`, AccountRole: chartofaccount.RoundingDifference, AccountFree: NoAccountFree, Amount: `other_transaction_rounding_difference`, Sign: 1},
+}
+
+// ReadCSV reads the posting rules of fileName, a csv file with the csv columns of PostingRule
+func ReadCSV(fileName string) (postingRule []PostingRule, err error) {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	err = gocsv.UnmarshalFile(file, &postingRule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid posting rules %s: %v", fileName, err)
+	}
+	return postingRule, nil
+}
+
+// sqlName matches the names of SQLite views and columns which can be written as is into SQL
+var sqlName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Validate checks that every posting rule can be compiled into SQL
+func Validate(postingRule []PostingRule) error {
+	invalid := Invalid(postingRule)
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid posting rules: %s", strings.Join(invalid, `; `))
+	}
+	return nil
+}
+
+// Invalid returns why postingRule cannot be compiled into SQL, one reason per invalid rule, see Validate
+func Invalid(postingRule []PostingRule) (invalid []string) {
+
+	if len(postingRule) == 0 {
+		return []string{`no posting rule`}
+	}
+	for i, rule := range postingRule {
+		var ruleInvalid []string
+		for name, value := range map[string]string{
+			`ledger_amount_view`: rule.LedgerAmountView,
+			`source_view`:        rule.SourceView,
+			`amount`:             rule.Amount,
+		} {
+			if !sqlName.MatchString(value) {
+				ruleInvalid = append(ruleInvalid, fmt.Sprintf("%s %q is not a SQLite name", name, value))
+			}
+		}
+		if rule.LedgerAmountView == `total_ledger_amount` || rule.LedgerAmountView == `total_ledger_amount_source` {
+			ruleInvalid = append(ruleInvalid, fmt.Sprintf("ledger_amount_view %q is reserved", rule.LedgerAmountView))
+		}
+		if (rule.AccountRole == ``) == (rule.AccountColumn == ``) {
+			ruleInvalid = append(ruleInvalid, `exactly one of account_role and account_column should be defined`)
+		}
+		if rule.AccountColumn != `` && !sqlName.MatchString(rule.AccountColumn) {
+			ruleInvalid = append(ruleInvalid, fmt.Sprintf("account_column %q is not a SQLite name", rule.AccountColumn))
+		}
+		switch rule.AccountFree {
+		case NoAccountFree, BeneficiaryCode:
+		case Subledger:
+			if rule.AccountColumn == `` {
+				ruleInvalid = append(ruleInvalid, `account_free subledger requires account_column`)
+			}
+		default:
+			if _, err := strconv.Atoi(rule.AccountFree); err != nil {
+				ruleInvalid = append(ruleInvalid, fmt.Sprintf("account_free %q is not %q, %q, %q or an integer", rule.AccountFree, NoAccountFree, Subledger, BeneficiaryCode))
+			}
+		}
+		if rule.Sign != 1 && rule.Sign != -1 {
+			ruleInvalid = append(ruleInvalid, fmt.Sprintf("sign %d is not 1 or -1", rule.Sign))
+		}
+		switch {
+		case rule.FilterColumn == `` && (rule.FilterOperator != `` || rule.FilterValue != ``):
+			ruleInvalid = append(ruleInvalid, `filter_operator and filter_value require filter_column`)
+		case rule.FilterColumn != `` && !sqlName.MatchString(rule.FilterColumn):
+			ruleInvalid = append(ruleInvalid, fmt.Sprintf("filter_column %q is not a SQLite name", rule.FilterColumn))
+		case rule.FilterColumn != `` && rule.FilterOperator != Equal && rule.FilterOperator != NotEqual:
+			ruleInvalid = append(ruleInvalid, fmt.Sprintf("filter_operator %q is not %q or %q", rule.FilterOperator, Equal, NotEqual))
+		}
+		for _, id := range strings.Split(rule.IDTransactionType, `,`) {
+			if _, err := strconv.Atoi(id); rule.IDTransactionType != `` && err != nil {
+				ruleInvalid = append(ruleInvalid, fmt.Sprintf("id_transaction_type %q is not a comma separated list of integers", rule.IDTransactionType))
+				break
+			}
+		}
+		switch {
+		case rule.IDTransactionType != `` && rule.TransactionType == ``:
+			ruleInvalid = append(ruleInvalid, `id_transaction_type requires transaction_type`)
+		case rule.TransactionType != `` && rule.SourceView != OtherTransactionFinal:
+			ruleInvalid = append(ruleInvalid, fmt.Sprintf("transaction_type %q requires source_view %s", rule.TransactionType, OtherTransactionFinal))
+		case rule.TransactionType != `` && !sqlName.MatchString(rule.TransactionType):
+			ruleInvalid = append(ruleInvalid, fmt.Sprintf("transaction_type %q is not a SQLite name", rule.TransactionType))
+		}
+		if len(ruleInvalid) > 0 {
+			invalid = append(invalid, fmt.Sprintf("rule %d (%s from %s): %s", i+1, rule.LedgerAmountView, rule.SourceView, strings.Join(ruleInvalid, `, `)))
+		}
+	}
+
+	// a transaction_type view must be created from the same id_transaction_type by every rule
+	iDTransactionType := make(map[string]string)
+	for _, rule := range postingRule {
+		if rule.IDTransactionType == `` {
+			continue
+		}
+		if id, ok := iDTransactionType[rule.TransactionType]; ok && id != rule.IDTransactionType {
+			invalid = append(invalid, fmt.Sprintf("transaction_type %s has id_transaction_type %s and %s", rule.TransactionType, id, rule.IDTransactionType))
+		}
+		iDTransactionType[rule.TransactionType] = rule.IDTransactionType
+	}
+	return invalid
+}
+
+// LedgerAmountView returns the distinct LedgerAmountView of postingRule, in order
+func LedgerAmountView(postingRule []PostingRule) (ledgerAmountView []string) {
+	return distinct(postingRule, func(rule PostingRule) string { return rule.LedgerAmountView })
+}
+
+// SourceView returns the distinct SourceView of postingRule, in order
+func SourceView(postingRule []PostingRule) (sourceView []string) {
+	return distinct(postingRule, func(rule PostingRule) string { return rule.SourceView })
+}
+
+// OtherTransactionType returns the distinct TransactionType booked from OtherTransactionFinal by postingRule, in order
+func OtherTransactionType(postingRule []PostingRule) (otherTransactionType []string) {
+	return distinct(postingRule, func(rule PostingRule) string { return rule.TransactionType })
+}
+
+// IDTransactionType returns the id_transaction_type of Seller Center of each TransactionType of postingRule which defines it
+func IDTransactionType(postingRule []PostingRule) (iDTransactionType map[string]string) {
+	iDTransactionType = make(map[string]string)
+	for _, rule := range postingRule {
+		if rule.IDTransactionType != `` {
+			iDTransactionType[rule.TransactionType] = rule.IDTransactionType
+		}
+	}
+	return iDTransactionType
+}
+
+// AccountRole returns the distinct chartofaccount.Role referenced by postingRule, including chartofaccount.SellerPayable
+func AccountRole(postingRule []PostingRule) (accountRole []string) {
+	return append([]string{chartofaccount.SellerPayable},
+		distinct(postingRule, func(rule PostingRule) string { return rule.AccountRole })...)
+}
+
+// distinct returns the distinct non empty values of field of postingRule, in order
+func distinct(postingRule []PostingRule, field func(PostingRule) string) (value []string) {
+	seen := make(map[string]bool)
+	for _, rule := range postingRule {
+		if v := field(rule); v != `` && !seen[v] {
+			seen[v] = true
+			value = append(value, v)
+		}
+	}
+	return value
+}
+
+// LedgerAmountViewSQL compiles the posting rules of ledgerAmountView
+// into the SQL creating ledgerAmountView: Account Code, Account Free and the sum of Amount
+func LedgerAmountViewSQL(ledgerAmountView string, postingRule []PostingRule, chartOfAccount chartofaccount.ChartOfAccount) string {
+
+	var selectRuleStr []string
+	for _, rule := range postingRule {
+		if rule.LedgerAmountView != ledgerAmountView {
+			continue
+		}
+		selectRuleStr = append(selectRuleStr, `
+	SELECT
+		`+rule.accountCodeSQL(chartOfAccount)+` 'Account Code'
+		,`+rule.accountFreeSQL()+` 'Account Free'
+		,`+rule.amountSQL()+` 'Amount'
+	FROM `+rule.SourceView+rule.whereSQL())
+	}
+
+	return `
+	CREATE VIEW ` + ledgerAmountView + ` AS
+	SELECT
+	la.'Account Code'
+	,la.'Account Free'
+	,SUM(la.'Amount') 'Amount'
+	FROM (` + strings.Join(selectRuleStr, `
+	UNION ALL`) + `) la
+	GROUP BY la.'Account Code', la.'Account Free'
+	`
+}
+
+// SellerPayableSourceSQL compiles postingRule into the SQL creating sellerPayableSourceView:
+// the counterpart of every posting on chartofaccount.SellerPayable by beneficiary_code, with its LedgerAmountView as Source View,
+// the transaction_type of its row and its Transaction Value: the counterpart with the sign of transaction_value, see transactionValueSQL
+func SellerPayableSourceSQL(sellerPayableSourceView string, postingRule []PostingRule, chartOfAccount chartofaccount.ChartOfAccount) string {
+
+	var selectRuleStr []string
+	for _, rule := range postingRule {
+		selectRuleStr = append(selectRuleStr, `
+	-- `+rule.LedgerAmountView+` of `+rule.SourceView+`
+	SELECT
+		`+chartOfAccount[chartofaccount.SellerPayable]+` 'Account Code'
+		,`+rule.SourceView+`.beneficiary_code 'Account Free'
+		,`+rule.amountSQL()+` 'Amount'
+		,'`+rule.LedgerAmountView+`' 'Source View'
+		,`+rule.SourceView+`.transaction_type 'Transaction Type'
+		,`+rule.transactionValueSQL()+` 'Transaction Value'
+	FROM `+rule.SourceView+rule.whereSQL())
+	}
+
+	return `
+	CREATE VIEW ` + sellerPayableSourceView + ` AS` + strings.Join(selectRuleStr, `
+
+	UNION ALL
+	`)
+}
+
+// accountCodeSQL returns the SQL of the Account Code of rule
+func (rule PostingRule) accountCodeSQL(chartOfAccount chartofaccount.ChartOfAccount) string {
+	if rule.AccountColumn != `` {
+		return rule.SourceView + `.` + rule.AccountColumn
+	}
+	return chartOfAccount[rule.AccountRole]
+}
+
+// accountFreeSQL returns the SQL of the Account Free of rule
+func (rule PostingRule) accountFreeSQL() string {
+	switch rule.AccountFree {
+	case NoAccountFree:
+		return `NULL`
+	case BeneficiaryCode:
+		return rule.SourceView + `.beneficiary_code`
+	case Subledger:
+		return `CASE WHEN ` + rule.SourceView + `.` + rule.AccountColumn + ` IN(` + ledgerBookedAtSubledgerLevel + `)
+		THEN ` + rule.SourceView + `.subledger
+		ELSE NULL END`
+	default:
+		return rule.AccountFree
+	}
+}
+
+// amountSQL returns the SQL of the Amount of rule
+func (rule PostingRule) amountSQL() string {
+	if rule.Sign == -1 {
+		return `(` + rule.SourceView + `.` + rule.Amount + `*-1)`
+	}
+	return rule.SourceView + `.` + rule.Amount
+}
+
+// transactionValueSQL returns the SQL of the Amount of rule with the sign of transaction_value:
+// the amounts of item prices follow the sign of transaction_value (paid_price + voucher = transaction_value)
+// while the amounts of the other final views follow the sign of commission_revenue (transaction_value * -1)
+func (rule PostingRule) transactionValueSQL() string {
+	if rule.SourceView == `ipc_final` || rule.SourceView == `ipt_final` {
+		return rule.amountSQL()
+	}
+	return `(` + rule.amountSQL() + `*-1)`
+}
+
+// whereSQL returns the SQL filtering the rows of SourceView booked by rule
+func (rule PostingRule) whereSQL() string {
+	condition := rule.conditionSQL()
+	if condition == `` {
+		return ``
+	}
+	return `
+	WHERE ` + condition
+}
+
+// conditionSQL returns the SQL condition of the rows of SourceView booked by rule, empty if rule books every row
+func (rule PostingRule) conditionSQL() string {
+	var condition []string
+	if rule.TransactionType != `` {
+		condition = append(condition, rule.SourceView+`.other_transaction_type = `+literalSQL(rule.TransactionType))
+	}
+	if rule.FilterColumn != `` {
+		condition = append(condition, rule.SourceView+`.`+rule.FilterColumn+` `+rule.FilterOperator+` `+literalSQL(rule.FilterValue))
+	}
+	return strings.Join(condition, ` AND `)
+}
+
+// literalSQL returns value as a SQL literal: an integer as is, so that it compares with the INTEGER columns of the views,
+// any other value as a quoted string
+func literalSQL(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return value
+	}
+	return `'` + strings.Replace(value, `'`, `''`, -1) + `'`
+}
+
+// BookedSourceViewSQL returns, for each SourceView of postingRule, the SQL selecting the transaction_type and transaction_value
+// of the rows booked by at least one rule, see ReturnBookedTransactionValue of output
+func BookedSourceViewSQL(postingRule []PostingRule) (bookedSourceViewSQL []string) {
+	for _, sourceView := range SourceView(postingRule) {
+		var condition []string
+		seen := make(map[string]bool)
+		everyRow := false
+		for _, rule := range postingRule {
+			if rule.SourceView != sourceView {
+				continue
+			}
+			ruleCondition := rule.conditionSQL()
+			if ruleCondition == `` {
+				everyRow = true
+				break
+			}
+			if !seen[ruleCondition] {
+				seen[ruleCondition] = true
+				condition = append(condition, `(`+ruleCondition+`)`)
+			}
+		}
+		whereStr := ``
+		if !everyRow {
+			whereStr = `
+	WHERE ` + strings.Join(condition, ` OR `)
+		}
+		bookedSourceViewSQL = append(bookedSourceViewSQL, `
+	SELECT `+sourceView+`.transaction_type, `+sourceView+`.transaction_value FROM `+sourceView+whereStr)
+	}
+	return bookedSourceViewSQL
+}
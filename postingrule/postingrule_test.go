@@ -0,0 +1,125 @@
+package postingrule
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thomas-bamilo/financebooking/chartofaccount"
+)
+
+// validRule returns a valid rule changed by change
+func validRule(change func(rule *PostingRule)) PostingRule {
+	rule := PostingRule{LedgerAmountView: `fee_ledger_amount`, SourceView: OtherTransactionFinal, TransactionType: `storage_fee`,
+		AccountRole: chartofaccount.StorageFee, AccountFree: NoAccountFree, Amount: `other_transaction_revenue`, Sign: 1}
+	if change != nil {
+		change(&rule)
+	}
+	return rule
+}
+
+func TestInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		postingRule []PostingRule
+		// wantInvalid is part of the reason why postingRule is invalid, empty if postingRule is valid
+		wantInvalid string
+	}{
+		{name: "default rules", postingRule: Default},
+		{name: "valid rule", postingRule: []PostingRule{validRule(nil)}},
+		{name: "no rule", wantInvalid: `no posting rule`},
+		{name: "view name with SQL", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.SourceView = `x; DROP TABLE sc` })}, wantInvalid: `is not a SQLite name`},
+		{name: "reserved view", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.LedgerAmountView = `total_ledger_amount` })}, wantInvalid: `is reserved`},
+		{name: "account role and column", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.AccountColumn = `ledger` })}, wantInvalid: `exactly one of account_role and account_column`},
+		{name: "subledger without account column", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.AccountFree = Subledger })}, wantInvalid: `account_free subledger requires account_column`},
+		{name: "invalid account free", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.AccountFree = `abc` })}, wantInvalid: `account_free "abc"`},
+		{name: "invalid sign", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.Sign = 2 })}, wantInvalid: `sign 2`},
+		{name: "filter without column", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.FilterValue = `1` })}, wantInvalid: `require filter_column`},
+		{name: "filter with SQL", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.FilterColumn, rule.FilterOperator = `1=1 OR x`, Equal })}, wantInvalid: `filter_column "1=1 OR x"`},
+		{name: "filter with unknown operator", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.FilterColumn, rule.FilterOperator = `ledger`, `LIKE` })}, wantInvalid: `filter_operator "LIKE"`},
+		{name: "filter with quote", postingRule: []PostingRule{validRule(func(rule *PostingRule) {
+			rule.FilterColumn, rule.FilterOperator, rule.FilterValue = `ledger`, NotEqual, `a'b`
+		})}},
+		{name: "invalid id_transaction_type", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.IDTransactionType = `13;14` })}, wantInvalid: `comma separated list of integers`},
+		{name: "id_transaction_type without transaction type", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.TransactionType, rule.IDTransactionType = ``, `13` })}, wantInvalid: `requires transaction_type`},
+		{name: "transaction type of another source view", postingRule: []PostingRule{validRule(func(rule *PostingRule) { rule.SourceView = `commission_final` })}, wantInvalid: `requires source_view`},
+		{name: "two id_transaction_type of a transaction type", postingRule: []PostingRule{
+			validRule(func(rule *PostingRule) { rule.IDTransactionType = `13` }),
+			validRule(func(rule *PostingRule) { rule.IDTransactionType = `14` }),
+		}, wantInvalid: `has id_transaction_type 13 and 14`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalid := strings.Join(Invalid(tt.postingRule), `; `)
+			if (tt.wantInvalid == `` && invalid != ``) || !strings.Contains(invalid, tt.wantInvalid) {
+				t.Errorf("Invalid() = %q, want %q", invalid, tt.wantInvalid)
+			}
+			if err := Validate(tt.postingRule); (err != nil) != (tt.wantInvalid != ``) {
+				t.Errorf("Validate() error = %v, want an error %v", err, tt.wantInvalid != ``)
+			}
+		})
+	}
+}
+
+func TestConditionSQL(t *testing.T) {
+	tests := []struct {
+		name string
+		rule PostingRule
+		want string
+	}{
+		{name: "every row", rule: PostingRule{SourceView: `commission_final`}, want: ``},
+		{name: "transaction type", rule: validRule(nil), want: `other_transaction_final.other_transaction_type = 'storage_fee'`},
+		{name: "integer filter", rule: PostingRule{SourceView: `ipc_final`, FilterColumn: `ledger`, FilterOperator: NotEqual, FilterValue: `13004`}, want: `ipc_final.ledger <> 13004`},
+		{name: "string filter with quote", rule: PostingRule{SourceView: `ipc_final`, FilterColumn: `item_status`, FilterOperator: Equal, FilterValue: `it's`}, want: `ipc_final.item_status = 'it''s'`},
+		{name: "transaction type and filter", rule: validRule(func(rule *PostingRule) {
+			rule.FilterColumn, rule.FilterOperator, rule.FilterValue = `ledger`, Equal, `1`
+		}),
+			want: `other_transaction_final.other_transaction_type = 'storage_fee' AND other_transaction_final.ledger = 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.conditionSQL(); got != tt.want {
+				t.Errorf("conditionSQL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBookedSourceViewSQL(t *testing.T) {
+	postingRule := []PostingRule{
+		validRule(nil),
+		validRule(func(rule *PostingRule) { rule.LedgerAmountView = `fee_vat_ledger_amount` }),
+		validRule(func(rule *PostingRule) { rule.TransactionType = `consign_handling_fee` }),
+		{LedgerAmountView: `commission_ledger_amount`, SourceView: `commission_final`, FilterColumn: `ledger`, FilterOperator: Equal, FilterValue: `1`},
+		{LedgerAmountView: `commission_ledger_amount`, SourceView: `commission_final`},
+	}
+	got := BookedSourceViewSQL(postingRule)
+	if len(got) != 2 {
+		t.Fatalf("BookedSourceViewSQL() = %q, want one SQL per source view", got)
+	}
+	if want := `WHERE (other_transaction_final.other_transaction_type = 'storage_fee') OR (other_transaction_final.other_transaction_type = 'consign_handling_fee')`; !strings.Contains(got[0], want) {
+		t.Errorf("BookedSourceViewSQL() = %q, want the distinct conditions %q", got[0], want)
+	}
+	if strings.Contains(got[1], `WHERE`) {
+		t.Errorf("BookedSourceViewSQL() = %q, want every row of commission_final", got[1])
+	}
+}
+
+func TestTransactionValueSQL(t *testing.T) {
+	tests := []struct {
+		name string
+		rule PostingRule
+		want string
+	}{
+		{name: "item price", rule: PostingRule{SourceView: `ipc_final`, Amount: `paid_price`, Sign: 1}, want: `ipc_final.paid_price`},
+		{name: "item price with sign", rule: PostingRule{SourceView: `ipt_final`, Amount: `voucher`, Sign: -1}, want: `(ipt_final.voucher*-1)`},
+		{name: "fee", rule: validRule(nil), want: `(other_transaction_final.other_transaction_revenue*-1)`},
+		{name: "fee with sign", rule: PostingRule{SourceView: `commission_final`, Amount: `commission_vat`, Sign: -1}, want: `((commission_final.commission_vat*-1)*-1)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.transactionValueSQL(); got != tt.want {
+				t.Errorf("transactionValueSQL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
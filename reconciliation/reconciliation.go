@@ -0,0 +1,221 @@
+package reconciliation
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/gocarina/gocsv"
+	"github.com/thomas-bamilo/financebooking/money"
+	"github.com/thomas-bamilo/financebooking/row/reconciliationrow"
+	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+	"github.com/thomas-bamilo/financebooking/row/transactiontyperow"
+)
+
+// flag of a check whose difference is above tolerance
+const unexplainedDifference = `UNEXPLAINED DIFFERENCE`
+
+// Checkpoint returns the reconciliationrow.ReconciliationRow of a total at a given step
+func Checkpoint(step, comment string, rowCount int, amount money.Rial) reconciliationrow.ReconciliationRow {
+	return reconciliationrow.ReconciliationRow{
+		Step:     step,
+		RowCount: rowCount,
+		Amount:   amount,
+		Comment:  comment,
+	}
+}
+
+// ScOmsTableCheckpoint returns the row count and total transaction_value of scOmsTable at a given step
+func ScOmsTableCheckpoint(step, comment string, scOmsTable []scomsrow.ScOmsRow) reconciliationrow.ReconciliationRow {
+	var transactionValue money.Rial
+	for _, scOmsRow := range scOmsTable {
+		transactionValue += scOmsRow.TransactionValue
+	}
+	return Checkpoint(step, comment, len(scOmsTable), transactionValue)
+}
+
+// Exclusion returns the exclusion bucket going from the checkpoint before to the checkpoint after:
+// the value removed from booking on purpose is negative
+func Exclusion(step, comment string, before, after reconciliationrow.ReconciliationRow) reconciliationrow.ReconciliationRow {
+	return reconciliationrow.ReconciliationRow{
+		Step:     step,
+		RowCount: after.RowCount - before.RowCount,
+		Amount:   after.Amount - before.Amount,
+		Comment:  comment,
+	}
+}
+
+// ScOmsTableExclusion returns the exclusion bucket of the rows of scOmsTable removed from booking
+func ScOmsTableExclusion(step, comment string, scOmsTable []scomsrow.ScOmsRow) reconciliationrow.ReconciliationRow {
+	excluded := ScOmsTableCheckpoint(step, comment, scOmsTable)
+	excluded.RowCount = -excluded.RowCount
+	excluded.Amount = -excluded.Amount
+	return excluded
+}
+
+// TransactionTypeTableExclusion returns the exclusion bucket of the transaction types of transactionTypeTable removed from booking
+func TransactionTypeTableExclusion(step, comment string, transactionTypeTable []transactiontyperow.TransactionTypeRow) reconciliationrow.ReconciliationRow {
+	excluded := reconciliationrow.ReconciliationRow{
+		Step:    step,
+		Comment: comment,
+	}
+	for _, transactionTypeRow := range transactionTypeTable {
+		excluded.RowCount -= transactionTypeRow.RowCount
+		excluded.Amount -= transactionTypeRow.TransactionValue
+	}
+	return excluded
+}
+
+// TransactionTypeTableCheckpoint returns the row count and total transaction value of transactionTypeTable at a given step
+func TransactionTypeTableCheckpoint(step, comment string, transactionTypeTable []transactiontyperow.TransactionTypeRow) reconciliationrow.ReconciliationRow {
+	checkpoint := Checkpoint(step, comment, 0, 0)
+	for _, transactionTypeRow := range transactionTypeTable {
+		checkpoint.RowCount += transactionTypeRow.RowCount
+		checkpoint.Amount += transactionTypeRow.TransactionValue
+	}
+	return checkpoint
+}
+
+// Remainder returns the checkpoint left from start after all the exclusion buckets
+func Remainder(step, comment string, start reconciliationrow.ReconciliationRow, exclusionTable ...reconciliationrow.ReconciliationRow) reconciliationrow.ReconciliationRow {
+	remainder := Checkpoint(step, comment, start.RowCount, start.Amount)
+	for _, exclusion := range exclusionTable {
+		remainder.RowCount += exclusion.RowCount
+		remainder.Amount += exclusion.Amount
+	}
+	return remainder
+}
+
+// Check returns the amount difference between actual and expected checkpoints
+// and flags it as unexplained if its absolute amount is above tolerance
+// FYI: row counts are not compared since checkpoints do not always count the same kind of rows (e.g. NGS lines)
+func Check(step, comment string, expected, actual reconciliationrow.ReconciliationRow, tolerance money.Rial) reconciliationrow.ReconciliationRow {
+	check := reconciliationrow.ReconciliationRow{
+		Step:    step,
+		Amount:  actual.Amount - expected.Amount,
+		Flag:    `OK`,
+		Comment: comment,
+	}
+	if check.Amount.Abs() > tolerance {
+		check.Flag = unexplainedDifference
+	}
+	return check
+}
+
+// TransactionTypeCheck returns, for each transaction type of expected or actual, in order,
+// its checkpoints expectedStep_<transaction type> and actualStep_<transaction type> and their check step_<transaction type>, see Check
+func TransactionTypeCheck(step, comment, expectedStep, actualStep string, expected, actual []transactiontyperow.TransactionTypeRow, tolerance money.Rial) (reconciliationTable []reconciliationrow.ReconciliationRow) {
+
+	expectedByTransactionType := make(map[string]transactiontyperow.TransactionTypeRow)
+	actualByTransactionType := make(map[string]transactiontyperow.TransactionTypeRow)
+	var transactionType []string
+	for _, transactionTypeRow := range expected {
+		expectedByTransactionType[transactionTypeRow.TransactionType] = transactionTypeRow
+		transactionType = append(transactionType, transactionTypeRow.TransactionType)
+	}
+	for _, transactionTypeRow := range actual {
+		actualByTransactionType[transactionTypeRow.TransactionType] = transactionTypeRow
+		if _, ok := expectedByTransactionType[transactionTypeRow.TransactionType]; !ok {
+			transactionType = append(transactionType, transactionTypeRow.TransactionType)
+		}
+	}
+	sort.Strings(transactionType)
+
+	for _, oneTransactionType := range transactionType {
+		expectedCheckpoint := TransactionTypeTableCheckpoint(expectedStep+`_`+oneTransactionType, ``, []transactiontyperow.TransactionTypeRow{expectedByTransactionType[oneTransactionType]})
+		actualCheckpoint := TransactionTypeTableCheckpoint(actualStep+`_`+oneTransactionType, ``, []transactiontyperow.TransactionTypeRow{actualByTransactionType[oneTransactionType]})
+		reconciliationTable = append(reconciliationTable,
+			expectedCheckpoint,
+			actualCheckpoint,
+			Check(step+`_`+oneTransactionType, comment, expectedCheckpoint, actualCheckpoint, tolerance))
+	}
+	return reconciliationTable
+}
+
+// NgsTemplateCheckpoint reads the NGS template ngsTemplateFileName
+// and returns the number of its lines booked on accountCode and the sum of their Amount
+func NgsTemplateCheckpoint(step, comment, ngsTemplateFileName, accountCode string) (reconciliationrow.ReconciliationRow, error) {
+
+	ngsTemplateFile, err := os.Open(ngsTemplateFileName)
+	if err != nil {
+		return reconciliationrow.ReconciliationRow{}, fmt.Errorf("read %s: %w", ngsTemplateFileName, err)
+	}
+	defer ngsTemplateFile.Close()
+
+	ngsTemplateReader := csv.NewReader(ngsTemplateFile)
+	header, err := ngsTemplateReader.Read()
+	if err != nil {
+		return reconciliationrow.ReconciliationRow{}, fmt.Errorf("read %s: %w", ngsTemplateFileName, err)
+	}
+	accountCodeIndex, amountIndex := -1, -1
+	for i, column := range header {
+		switch column {
+		case `Account Code`:
+			accountCodeIndex = i
+		case `Amount`:
+			amountIndex = i
+		}
+	}
+	if accountCodeIndex < 0 || amountIndex < 0 {
+		return reconciliationrow.ReconciliationRow{}, errors.New("no Account Code or Amount column in " + ngsTemplateFileName)
+	}
+
+	var rowCount int
+	var amount money.Rial
+	// line 1 is the header
+	for line := 2; ; line++ {
+		ngsRow, err := ngsTemplateReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return reconciliationrow.ReconciliationRow{}, fmt.Errorf("read %s: %w", ngsTemplateFileName, err)
+		}
+		if ngsRow[accountCodeIndex] != accountCode {
+			continue
+		}
+		rowCount++
+		// an empty Amount is booked as 0
+		if ngsRow[amountIndex] == `` {
+			continue
+		}
+		lineAmount, err := money.ParseRial(ngsRow[amountIndex])
+		if err != nil {
+			return reconciliationrow.ReconciliationRow{}, fmt.Errorf("read %s line %d: %w", ngsTemplateFileName, line, err)
+		}
+		amount += lineAmount
+	}
+
+	return Checkpoint(step, comment, rowCount, amount), nil
+}
+
+// IfUnexplainedDifference writes reconciliationTable to reconciliationFileName
+// and warns Finance if any check of reconciliationTable is flagged as unexplained difference
+func IfUnexplainedDifference(reconciliationTable []reconciliationrow.ReconciliationRow, reconciliationFileName string) error {
+
+	var reconciliationTableP []*reconciliationrow.ReconciliationRow
+	for i := 0; i < len(reconciliationTable); i++ {
+		reconciliationTableP = append(reconciliationTableP, &reconciliationTable[i])
+	}
+	file, err := os.Create(reconciliationFileName)
+	if err != nil {
+		return fmt.Errorf("write %s: %w", reconciliationFileName, err)
+	}
+	defer file.Close()
+	err = gocsv.MarshalFile(&reconciliationTableP, file)
+	if err != nil {
+		return fmt.Errorf("write %s: %w", reconciliationFileName, err)
+	}
+
+	for _, reconciliationRow := range reconciliationTable {
+		if reconciliationRow.Flag == unexplainedDifference {
+			log.Println("WARNING: " + reconciliationRow.Step + " has an unexplained difference of " +
+				reconciliationRow.Amount.String() + ", please see " + reconciliationFileName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package reconciliation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thomas-bamilo/financebooking/row/reconciliationrow"
+	"github.com/thomas-bamilo/financebooking/row/transactiontyperow"
+)
+
+func TestTransactionTypeCheck(t *testing.T) {
+	booked := []transactiontyperow.TransactionTypeRow{
+		{TransactionType: `Commission`, RowCount: 2, TransactionValue: -2000},
+		{TransactionType: `Item Price`, RowCount: 1, TransactionValue: 10000},
+	}
+	sellerPayable := []transactiontyperow.TransactionTypeRow{
+		{TransactionType: `Item Price`, RowCount: 2, TransactionValue: 9000},
+		{TransactionType: `Commission`, RowCount: 4, TransactionValue: -2001},
+		{TransactionType: `Storage Fee`, RowCount: 2, TransactionValue: -300},
+	}
+	want := []reconciliationrow.ReconciliationRow{
+		{Step: `booked_Commission`, RowCount: 2, Amount: -2000},
+		{Step: `ngs_Commission`, RowCount: 4, Amount: -2001},
+		{Step: `check_Commission`, Amount: -1, Flag: `OK`, Comment: `lost`},
+		{Step: `booked_Item Price`, RowCount: 1, Amount: 10000},
+		{Step: `ngs_Item Price`, RowCount: 2, Amount: 9000},
+		{Step: `check_Item Price`, Amount: -1000, Flag: unexplainedDifference, Comment: `lost`},
+		{Step: `booked_Storage Fee`},
+		{Step: `ngs_Storage Fee`, RowCount: 2, Amount: -300},
+		{Step: `check_Storage Fee`, Amount: -300, Flag: unexplainedDifference, Comment: `lost`},
+	}
+	got := TransactionTypeCheck(`check`, `lost`, `booked`, `ngs`, booked, sellerPayable, 1)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TransactionTypeCheck() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNgsTemplateCheckpoint(t *testing.T) {
+	ngsTemplateFileName := filepath.Join(t.TempDir(), `ngsTemplateIpcIptC.csv`)
+	err := os.WriteFile(ngsTemplateFileName, []byte("Account Code,Account Free,Amount\n"+
+		"62002,,950000\n"+
+		"31002,3000000001,-770701\n"+
+		"32021,,19000\n"+
+		"31002,3000000002,\n"+
+		"31002,3000000003,1000\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NgsTemplateCheckpoint(`ngs_template_seller_payable`, ``, ngsTemplateFileName, `31002`)
+	if err != nil {
+		t.Fatalf("NgsTemplateCheckpoint() error = %v", err)
+	}
+	if want := Checkpoint(`ngs_template_seller_payable`, ``, 3, -769701); got != want {
+		t.Errorf("NgsTemplateCheckpoint() = %+v, want %+v", got, want)
+	}
+
+	err = os.WriteFile(ngsTemplateFileName, []byte("Account Code,Amount\n31002,abc\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NgsTemplateCheckpoint(`ngs_template_seller_payable`, ``, ngsTemplateFileName, `31002`); err == nil {
+		t.Error("NgsTemplateCheckpoint() error = nil, want an error for an invalid Amount")
+	}
+}
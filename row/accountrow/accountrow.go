@@ -0,0 +1,93 @@
+package accountrow
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
+// AccountRow represents a row of the table AccountTable:
+// an Account Code of the account master of NGS, the only Account Codes which can be booked in the NGS template
+type AccountRow struct {
+	Err         string `csv:"error"`
+	AccountCode string `csv:"account_code"`
+	AccountName string `csv:"account_name"`
+}
+
+// define validation for each field of AccountRow
+func (row AccountRow) validateRowFormat() error {
+	return validation.ValidateStruct(&row,
+		validation.Field(&row.AccountCode, validation.Required, is.Int),
+		validation.Field(&row.AccountName, validation.Required),
+	)
+}
+
+// FilterAccountTable splits AccountTable into AccountTableValidRow and AccountTableInvalidRow
+// rows of an Account Code defined several times are invalid: an Account Code must have exactly one name
+func FilterAccountTable(accountTable []AccountRow) (AccountTableValidRow, AccountTableInvalidRow []AccountRow) {
+
+	AccountTableValidRow = filterPointer(accountTable, isValidRowFormat)
+	AccountTableInvalidRow = filterPointer(accountTable, isInvalidRowFormat)
+
+	// add error message to AccountTableInvalidRow
+	for i := 0; i < len(AccountTableInvalidRow); i++ {
+		AccountTableInvalidRow[i].Err = AccountTableInvalidRow[i].validateRowFormat().Error()
+	}
+
+	// count the rows of each Account Code to find the Account Codes defined several times
+	accountCodeCount := make(map[string]int)
+	for _, row := range AccountTableValidRow {
+		accountCodeCount[row.AccountCode]++
+	}
+	var uniqueRow []AccountRow
+	for _, row := range AccountTableValidRow {
+		if accountCodeCount[row.AccountCode] > 1 {
+			row.Err = `account_code defined several times`
+			AccountTableInvalidRow = append(AccountTableInvalidRow, row)
+			continue
+		}
+		uniqueRow = append(uniqueRow, row)
+	}
+
+	return uniqueRow, AccountTableInvalidRow
+
+}
+
+// AccountCode returns the Account Codes of accountTable
+func AccountCode(accountTable []AccountRow) (accountCode []string) {
+	for _, row := range accountTable {
+		accountCode = append(accountCode, row.AccountCode)
+	}
+	return accountCode
+}
+
+// filter an array of AccountRow with pointer
+func filterPointer(unfilteredTable []AccountRow, test func(*AccountRow) bool) (filteredTable []AccountRow) {
+	for _, row := range unfilteredTable {
+		if test(&row) {
+			filteredTable = append(filteredTable, row)
+		}
+	}
+	return
+}
+
+// check if AccountRow has valid format
+func isValidRowFormat(row *AccountRow) bool {
+
+	err := row.validateRowFormat()
+	if err != nil {
+		return false
+	}
+	return true
+
+}
+
+// check if AccountRow has invalid format
+func isInvalidRowFormat(row *AccountRow) bool {
+
+	err := row.validateRowFormat()
+	if err != nil {
+		return true
+	}
+	return false
+
+}
@@ -3,6 +3,8 @@ package beneficiarycoderow
 import (
 	"regexp"
 
+	"github.com/thomas-bamilo/financebooking/money"
+
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 )
@@ -14,6 +16,17 @@ type BeneficiaryCodeRow struct {
 	BeneficiaryCode string `csv:"beneficiary_code"`
 }
 
+// BeneficiaryCodeTemplateRow represents a row of the beneficiary_code template, uploaded as benef_code_map.csv once filled in, pre-filled for a missing short_code:
+// Finance fills in BeneficiaryCode and uploads the file with userinteract, which ignores the other columns
+type BeneficiaryCodeTemplateRow struct {
+	ShortCode        string     `csv:"short_code"`
+	BeneficiaryCode  string     `csv:"beneficiary_code"`
+	SupplierName     string     `csv:"supplier_name"`
+	IDSupplier       int        `csv:"id_supplier"`
+	RowCount         int        `csv:"row_count"`
+	TransactionValue money.Rial `csv:"transaction_value"`
+}
+
 // define validation for each field of BeneficiaryCodeRow
 func (row BeneficiaryCodeRow) validateRowFormat() error {
 	return validation.ValidateStruct(&row,
@@ -0,0 +1,88 @@
+package chartofaccountrow
+
+import (
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
+// ChartOfAccountRow represents a row of the table ChartOfAccountTable:
+// the Account Code booked for an account role of the posting rules of the NGS template, see chartofaccount.Role
+type ChartOfAccountRow struct {
+	Err         string `csv:"error"`
+	AccountRole string `csv:"account_role"`
+	AccountCode string `csv:"account_code"`
+}
+
+// define validation for each field of ChartOfAccountRow
+// FYI: the account role is checked against the posting rules by chartofaccount.ChartOfAccount.Validate
+func (row ChartOfAccountRow) validateRowFormat() error {
+	return validation.ValidateStruct(&row,
+		validation.Field(&row.AccountRole, validation.Required, validation.Match(regexp.MustCompile(`^[a-z][a-z0-9_]*$`))),
+		validation.Field(&row.AccountCode, validation.Required, is.Int),
+	)
+}
+
+// FilterChartOfAccountTable splits ChartOfAccountTable into ChartOfAccountTableValidRow and ChartOfAccountTableInvalidRow
+// rows of an account role defined several times are invalid: an account role must have exactly one Account Code
+func FilterChartOfAccountTable(chartOfAccountTable []ChartOfAccountRow) (ChartOfAccountTableValidRow, ChartOfAccountTableInvalidRow []ChartOfAccountRow) {
+
+	ChartOfAccountTableValidRow = filterPointer(chartOfAccountTable, isValidRowFormat)
+	ChartOfAccountTableInvalidRow = filterPointer(chartOfAccountTable, isInvalidRowFormat)
+
+	// add error message to ChartOfAccountTableInvalidRow
+	for i := 0; i < len(ChartOfAccountTableInvalidRow); i++ {
+		ChartOfAccountTableInvalidRow[i].Err = ChartOfAccountTableInvalidRow[i].validateRowFormat().Error()
+	}
+
+	// count the rows of each account role to find the account roles defined several times
+	accountRoleCount := make(map[string]int)
+	for _, row := range ChartOfAccountTableValidRow {
+		accountRoleCount[row.AccountRole]++
+	}
+	var uniqueRow []ChartOfAccountRow
+	for _, row := range ChartOfAccountTableValidRow {
+		if accountRoleCount[row.AccountRole] > 1 {
+			row.Err = `account_role defined several times`
+			ChartOfAccountTableInvalidRow = append(ChartOfAccountTableInvalidRow, row)
+			continue
+		}
+		uniqueRow = append(uniqueRow, row)
+	}
+
+	return uniqueRow, ChartOfAccountTableInvalidRow
+
+}
+
+// filter an array of ChartOfAccountRow with pointer
+func filterPointer(unfilteredTable []ChartOfAccountRow, test func(*ChartOfAccountRow) bool) (filteredTable []ChartOfAccountRow) {
+	for _, row := range unfilteredTable {
+		if test(&row) {
+			filteredTable = append(filteredTable, row)
+		}
+	}
+	return
+}
+
+// check if ChartOfAccountRow has valid format
+func isValidRowFormat(row *ChartOfAccountRow) bool {
+
+	err := row.validateRowFormat()
+	if err != nil {
+		return false
+	}
+	return true
+
+}
+
+// check if ChartOfAccountRow has invalid format
+func isInvalidRowFormat(row *ChartOfAccountRow) bool {
+
+	err := row.validateRowFormat()
+	if err != nil {
+		return true
+	}
+	return false
+
+}
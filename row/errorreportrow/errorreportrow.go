@@ -0,0 +1,18 @@
+package errorreportrow
+
+import "github.com/thomas-bamilo/financebooking/money"
+
+// ErrorReportRow represents an issue found during a booking run, see errorreport.Report:
+// the category, severity and stage of the issue, the identifiers of its source and its value at stake
+type ErrorReportRow struct {
+	Category            string     `csv:"category"`
+	Severity            string     `csv:"severity"`
+	Stage               string     `csv:"stage"`
+	IDTransaction       int        `csv:"id_transaction"`
+	OmsIDSalesOrderItem int        `csv:"oms_id_sales_order_item"`
+	ShortCode           string     `csv:"short_code"`
+	SourceKey           string     `csv:"source_key"`
+	RowCount            int        `csv:"row_count"`
+	TransactionValue    money.Rial `csv:"transaction_value"`
+	Message             string     `csv:"message"`
+}
@@ -1,11 +1,22 @@
 package ledgermaprow
 
 import (
+	"strconv"
+	"strings"
+
+	"github.com/thomas-bamilo/financebooking/money"
+
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 )
 
-// LedgerMapRow represents a row of the table LedgerMapTable
+// Any matches every value of a dimension of LedgerMapRow
+const Any = `*`
+
+// LedgerMapRow represents a row of the table LedgerMapTable:
+// the ledger and subledger of the item price and item price credit transactions
+// matching TransactionType, ItemStatus, PaymentMethod and ShipmentProviderName, each of them can be Any
+// if several rows match a transaction, the row with the fewest Any wins, then the row with the highest Priority
 type LedgerMapRow struct {
 	Err                  string `csv:"error"`
 	TransactionType      string `csv:"transaction_type"`
@@ -14,12 +25,32 @@ type LedgerMapRow struct {
 	ShipmentProviderName string `csv:"shipment_provider_name"`
 	Ledger               string `csv:"ledger"`
 	Subledger            string `csv:"subledger"`
+	Priority             string `csv:"priority"`
+}
+
+// LedgerMapTemplateRow represents a row of the ledger_map template, uploaded as ledger_map.csv once filled in, pre-filled for a missing ledger_map:
+// Finance fills in Ledger (and Subledger if any) and uploads the file with userinteract, which ignores the other columns
+// the suggestion of Suggest is accepted by copying SuggestedLedger and SuggestedSubledger into Ledger and Subledger,
+// or for every row with an empty Ledger at once by accepting the suggestions when uploading with userinteract, see AcceptSuggestion
+type LedgerMapTemplateRow struct {
+	TransactionType      string     `csv:"transaction_type"`
+	ItemStatus           string     `csv:"item_status"`
+	PaymentMethod        string     `csv:"payment_method"`
+	ShipmentProviderName string     `csv:"shipment_provider_name"`
+	Ledger               string     `csv:"ledger"`
+	Subledger            string     `csv:"subledger"`
+	Priority             string     `csv:"priority"`
+	SuggestedLedger      string     `csv:"suggested_ledger"`
+	SuggestedSubledger   string     `csv:"suggested_subledger"`
+	SuggestionReason     string     `csv:"suggestion_reason"`
+	RowCount             int        `csv:"row_count"`
+	TransactionValue     money.Rial `csv:"transaction_value"`
 }
 
 // define validation for each field of LedgerMapRow
 func (row LedgerMapRow) validateRowFormat() error {
 	return validation.ValidateStruct(&row,
-		validation.Field(&row.TransactionType, validation.Required, validation.In(`Item Price`, `Item Price Credit`)),
+		validation.Field(&row.TransactionType, validation.Required, validation.In(`Item Price`, `Item Price Credit`, Any)),
 		validation.Field(&row.ItemStatus, validation.Required, validation.In(
 			`delivered`,
 			`closed`,
@@ -37,6 +68,7 @@ func (row LedgerMapRow) validateRowFormat() error {
 			`refund_pending`,
 			`ready_for_refund`,
 			`replacement_pending`,
+			Any,
 		)),
 		validation.Field(&row.PaymentMethod, validation.Required, validation.In(
 			`CashOnDelivery`,
@@ -46,6 +78,7 @@ func (row LedgerMapRow) validateRowFormat() error {
 			`Jiring`,
 			`AsanPardakht`,
 			`Irankish`,
+			Any,
 		)),
 		validation.Field(&row.ShipmentProviderName, validation.Required, validation.In(
 			`Tipax`,
@@ -61,6 +94,7 @@ func (row LedgerMapRow) validateRowFormat() error {
 			`TPG`,
 			`Tehran Orders`,
 			`Tpx`,
+			Any,
 		)),
 		validation.Field(&row.Ledger, validation.Required, is.Int, validation.In(
 			`13004`,
@@ -80,10 +114,172 @@ func (row LedgerMapRow) validateRowFormat() error {
 			`4000000001`,
 			`4000000006`,
 		)),
+		validation.Field(&row.Priority, is.Int),
 	)
 }
 
+// Specificity returns the number of dimensions of LedgerMapRow which are not Any
+func (row LedgerMapRow) Specificity() (specificity int) {
+	for _, dimension := range []string{row.TransactionType, row.ItemStatus, row.PaymentMethod, row.ShipmentProviderName} {
+		if dimension != Any {
+			specificity++
+		}
+	}
+	return specificity
+}
+
+// PriorityLevel returns Priority as an integer, 0 if Priority is empty
+func (row LedgerMapRow) PriorityLevel() int {
+	priority, _ := strconv.Atoi(row.Priority)
+	return priority
+}
+
+// Matches checks if LedgerMapRow applies to a transaction of transactionType with itemStatus, paymentMethod and shipmentProviderName
+func (row LedgerMapRow) Matches(transactionType, itemStatus, paymentMethod, shipmentProviderName string) bool {
+	return matchesDimension(row.TransactionType, transactionType) &&
+		matchesDimension(row.ItemStatus, itemStatus) &&
+		matchesDimension(row.PaymentMethod, paymentMethod) &&
+		matchesDimension(row.ShipmentProviderName, shipmentProviderName)
+}
+
+// Match returns the row of ledgerMapTable applying to a transaction of transactionType with itemStatus, paymentMethod and shipmentProviderName:
+// the most specific matching row, then the matching row with the highest priority
+// ok is false if no row of ledgerMapTable matches
+func Match(ledgerMapTable []LedgerMapRow, transactionType, itemStatus, paymentMethod, shipmentProviderName string) (match LedgerMapRow, ok bool) {
+	for _, row := range ledgerMapTable {
+		if !row.Matches(transactionType, itemStatus, paymentMethod, shipmentProviderName) {
+			continue
+		}
+		if !ok || row.Specificity() > match.Specificity() ||
+			(row.Specificity() == match.Specificity() && row.PriorityLevel() > match.PriorityLevel()) {
+			match, ok = row, true
+		}
+	}
+	return match, ok
+}
+
+// Suggest returns the ledger and subledger of the rows of ledgerMapTable closest to a transaction of transactionType
+// with itemStatus, paymentMethod and shipmentProviderName matching no row of ledgerMapTable, and the reason for the suggestion:
+// the closest rows have the same transactionType and the most similar dimensions, the item status weighing the most
+// and the shipment provider the least, and the ledger and subledger shared by most of the closest rows is suggested
+func Suggest(ledgerMapTable []LedgerMapRow, transactionType, itemStatus, paymentMethod, shipmentProviderName string) (suggestion LedgerMapRow, reason string) {
+
+	bestScore := -1
+	var closestRow []LedgerMapRow
+	for _, row := range ledgerMapTable {
+		if !matchesDimension(row.TransactionType, transactionType) {
+			continue
+		}
+		score := 0
+		if matchesDimension(row.ItemStatus, itemStatus) {
+			score += 4
+		}
+		if matchesDimension(row.PaymentMethod, paymentMethod) {
+			score += 2
+		}
+		if matchesDimension(row.ShipmentProviderName, shipmentProviderName) {
+			score++
+		}
+		switch {
+		case score > bestScore:
+			bestScore, closestRow = score, []LedgerMapRow{row}
+		case score == bestScore:
+			closestRow = append(closestRow, row)
+		}
+	}
+	if len(closestRow) == 0 {
+		return LedgerMapRow{}, `no ledger_map with transaction_type ` + transactionType
+	}
+
+	// suggest the ledger and subledger shared by most of closestRow, the first one in case of a tie
+	voteCount := make(map[[2]string]int)
+	for _, row := range closestRow {
+		ledgerSubledger := [2]string{row.Ledger, row.Subledger}
+		voteCount[ledgerSubledger]++
+		if voteCount[ledgerSubledger] > voteCount[[2]string{suggestion.Ledger, suggestion.Subledger}] || suggestion.Ledger == `` {
+			suggestion = row
+		}
+	}
+
+	sameDimension := []string{`transaction_type`}
+	for i, dimension := range []string{`item_status`, `payment_method`, `shipment_provider_name`} {
+		if bestScore&(4>>uint(i)) != 0 {
+			sameDimension = append(sameDimension, dimension)
+		}
+	}
+	reason = `same ` + strings.Join(sameDimension, `, `) + ` as ` +
+		strconv.Itoa(voteCount[[2]string{suggestion.Ledger, suggestion.Subledger}]) + ` of the ` + strconv.Itoa(len(closestRow)) +
+		` closest ledger_map rows, e.g. ` + suggestion.dimension()
+	return LedgerMapRow{Ledger: suggestion.Ledger, Subledger: suggestion.Subledger}, reason
+}
+
+// AcceptSuggestion returns the rows of templateTable as rows of ledger_map table
+// with SuggestedLedger and SuggestedSubledger instead of Ledger and Subledger if Ledger is empty
+// rows with neither Ledger nor SuggestedLedger keep an empty Ledger and are rejected by FilterLedgerMapTable
+func AcceptSuggestion(templateTable []LedgerMapTemplateRow) (ledgerMapTable []LedgerMapRow) {
+	for _, templateRow := range templateTable {
+		ledger, subledger := templateRow.Ledger, templateRow.Subledger
+		if ledger == `` {
+			ledger, subledger = templateRow.SuggestedLedger, templateRow.SuggestedSubledger
+		}
+		ledgerMapTable = append(ledgerMapTable,
+			LedgerMapRow{
+				TransactionType:      templateRow.TransactionType,
+				ItemStatus:           templateRow.ItemStatus,
+				PaymentMethod:        templateRow.PaymentMethod,
+				ShipmentProviderName: templateRow.ShipmentProviderName,
+				Ledger:               ledger,
+				Subledger:            subledger,
+				Priority:             templateRow.Priority,
+			})
+	}
+	return ledgerMapTable
+}
+
+// Upsert returns ledgerMapTable once uploadedTable is upserted into it, as by the upload of ledger_map.csv:
+// a row of uploadedTable replaces the row of ledgerMapTable with the same dimensions and priority
+func Upsert(ledgerMapTable, uploadedTable []LedgerMapRow) (upsertedTable []LedgerMapRow) {
+	isUploaded := make(map[string]bool)
+	for _, row := range uploadedTable {
+		isUploaded[row.key()] = true
+	}
+	for _, row := range ledgerMapTable {
+		if !isUploaded[row.key()] {
+			upsertedTable = append(upsertedTable, row)
+		}
+	}
+	return append(upsertedTable, uploadedTable...)
+}
+
+// key returns the dimensions and the priority level of LedgerMapRow, which identify a row of ledger_map table of BAA database
+func (row LedgerMapRow) key() string {
+	return row.dimension() + ` - ` + strconv.Itoa(row.PriorityLevel())
+}
+
+// dimension returns the dimensions of LedgerMapRow to identify it in error messages
+func (row LedgerMapRow) dimension() string {
+	return strings.Join([]string{row.TransactionType, row.ItemStatus, row.PaymentMethod, row.ShipmentProviderName}, ` - `)
+}
+
+// overlaps checks if row and otherRow can match the same transaction
+func (row LedgerMapRow) overlaps(otherRow LedgerMapRow) bool {
+	return overlapsDimension(row.TransactionType, otherRow.TransactionType) &&
+		overlapsDimension(row.ItemStatus, otherRow.ItemStatus) &&
+		overlapsDimension(row.PaymentMethod, otherRow.PaymentMethod) &&
+		overlapsDimension(row.ShipmentProviderName, otherRow.ShipmentProviderName)
+}
+
+func matchesDimension(ruleValue, value string) bool {
+	return ruleValue == Any || ruleValue == value
+}
+
+func overlapsDimension(ruleValue, otherRuleValue string) bool {
+	return ruleValue == Any || otherRuleValue == Any || ruleValue == otherRuleValue
+}
+
 // FilterLedgerMapTable splits LedgerMapTable into LedgerMapTableValidRow and LedgerMapTableInvalidRow
+// rows which can match the same transaction as another row with the same specificity and priority are invalid:
+// a transaction must match exactly one ledger and subledger
 func FilterLedgerMapTable(ledgerMapTable []LedgerMapRow) (LedgerMapTableValidRow, LedgerMapTableInvalidRow []LedgerMapRow) {
 
 	LedgerMapTableValidRow = filterPointer(ledgerMapTable, isValidRowFormat)
@@ -94,7 +290,24 @@ func FilterLedgerMapTable(ledgerMapTable []LedgerMapRow) (LedgerMapTableValidRow
 		LedgerMapTableInvalidRow[i].Err = LedgerMapTableInvalidRow[i].validateRowFormat().Error()
 	}
 
-	return LedgerMapTableValidRow, LedgerMapTableInvalidRow
+	var unambiguousRow []LedgerMapRow
+	for i, row := range LedgerMapTableValidRow {
+		var ambiguousWith []string
+		for j, otherRow := range LedgerMapTableValidRow {
+			if i != j && row.overlaps(otherRow) &&
+				row.Specificity() == otherRow.Specificity() && row.PriorityLevel() == otherRow.PriorityLevel() {
+				ambiguousWith = append(ambiguousWith, otherRow.dimension())
+			}
+		}
+		if len(ambiguousWith) > 0 {
+			row.Err = `matches the same transactions with the same specificity and priority as: ` + strings.Join(ambiguousWith, `; `)
+			LedgerMapTableInvalidRow = append(LedgerMapTableInvalidRow, row)
+			continue
+		}
+		unambiguousRow = append(unambiguousRow, row)
+	}
+
+	return unambiguousRow, LedgerMapTableInvalidRow
 
 }
 
@@ -119,7 +332,7 @@ func isValidRowFormat(row *LedgerMapRow) bool {
 
 }
 
-// check if SellerRejectionRow has invalid format
+// check if LedgerMapRow has invalid format
 func isInvalidRowFormat(row *LedgerMapRow) bool {
 
 	err := row.validateRowFormat()
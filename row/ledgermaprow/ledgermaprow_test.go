@@ -0,0 +1,136 @@
+package ledgermaprow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	ledgerMapTable := []LedgerMapRow{
+		{TransactionType: `Item Price`, ItemStatus: Any, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `1`},
+		{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `2`},
+		{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: `CashOnDelivery`, ShipmentProviderName: Any, Ledger: `3`},
+		{TransactionType: `Item Price`, ItemStatus: Any, PaymentMethod: `CashOnDelivery`, ShipmentProviderName: `Chapar`, Ledger: `4`},
+		{TransactionType: `Item Price`, ItemStatus: `closed`, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `5`},
+		{TransactionType: `Item Price`, ItemStatus: `closed`, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `6`, Priority: `1`},
+		{TransactionType: `Item Price Credit`, ItemStatus: `canceled`, PaymentMethod: `CashOnDelivery`, ShipmentProviderName: `Chapar`, Ledger: `7`},
+	}
+	tests := []struct {
+		name                                                         string
+		transactionType, itemStatus, paymentMethod, shipmentProvider string
+		wantLedger                                                   string
+		wantOk                                                       bool
+	}{
+		{name: "catch-all row", transactionType: `Item Price`, itemStatus: `canceled`, paymentMethod: `Prepaid`, shipmentProvider: `Post`, wantLedger: `1`, wantOk: true},
+		{name: "one specific dimension wins over none", transactionType: `Item Price`, itemStatus: `delivered`, paymentMethod: `Prepaid`, shipmentProvider: `Post`, wantLedger: `2`, wantOk: true},
+		{name: "two specific dimensions win over one", transactionType: `Item Price`, itemStatus: `delivered`, paymentMethod: `CashOnDelivery`, shipmentProvider: `Post`, wantLedger: `3`, wantOk: true},
+		{name: "same specificity, the first matching row", transactionType: `Item Price`, itemStatus: `delivered`, paymentMethod: `CashOnDelivery`, shipmentProvider: `Chapar`, wantLedger: `3`, wantOk: true},
+		{name: "same specificity, the highest priority", transactionType: `Item Price`, itemStatus: `closed`, paymentMethod: `Prepaid`, shipmentProvider: `Post`, wantLedger: `6`, wantOk: true},
+		{name: "every dimension specific", transactionType: `Item Price Credit`, itemStatus: `canceled`, paymentMethod: `CashOnDelivery`, shipmentProvider: `Chapar`, wantLedger: `7`, wantOk: true},
+		{name: "no matching row", transactionType: `Item Price Credit`, itemStatus: `delivered`, paymentMethod: `CashOnDelivery`, shipmentProvider: `Chapar`, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Match(ledgerMapTable, tt.transactionType, tt.itemStatus, tt.paymentMethod, tt.shipmentProvider)
+			if ok != tt.wantOk || got.Ledger != tt.wantLedger {
+				t.Errorf("Match() = ledger %q, %v, want ledger %q, %v", got.Ledger, ok, tt.wantLedger, tt.wantOk)
+			}
+		})
+	}
+	if _, ok := Match(nil, `Item Price`, `delivered`, `Prepaid`, `Post`); ok {
+		t.Errorf("Match() on an empty ledger_map = true, want false")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	ledgerMapTable := []LedgerMapRow{
+		{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: `Prepaid`, ShipmentProviderName: `Post`, Ledger: `1`},
+		{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: `Prepaid`, ShipmentProviderName: `Tipax`, Ledger: `2`, Subledger: `20`},
+		{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: `Prepaid`, ShipmentProviderName: `Mahex`, Ledger: `2`, Subledger: `20`},
+		{TransactionType: `Item Price`, ItemStatus: `closed`, PaymentMethod: `CashOnDelivery`, ShipmentProviderName: `Chapar`, Ledger: `3`},
+	}
+	tests := []struct {
+		name                                                         string
+		transactionType, itemStatus, paymentMethod, shipmentProvider string
+		want                                                         LedgerMapRow
+	}{
+		{name: "ledger shared by most of the closest rows", transactionType: `Item Price`, itemStatus: `delivered`, paymentMethod: `Prepaid`, shipmentProvider: `Chapar`, want: LedgerMapRow{Ledger: `2`, Subledger: `20`}},
+		{name: "item status weighs more than the other dimensions", transactionType: `Item Price`, itemStatus: `closed`, paymentMethod: `Prepaid`, shipmentProvider: `Post`, want: LedgerMapRow{Ledger: `3`}},
+		{name: "no row of the transaction type", transactionType: `Item Price Credit`, itemStatus: `closed`, paymentMethod: `Prepaid`, shipmentProvider: `Post`, want: LedgerMapRow{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := Suggest(ledgerMapTable, tt.transactionType, tt.itemStatus, tt.paymentMethod, tt.shipmentProvider)
+			if got != tt.want {
+				t.Errorf("Suggest() = %+v (%s), want %+v", got, reason, tt.want)
+			}
+			if reason == `` {
+				t.Errorf("Suggest() has no reason")
+			}
+		})
+	}
+}
+
+func TestFilterLedgerMapTable(t *testing.T) {
+	valid := LedgerMapRow{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `13004`}
+	samePriority := LedgerMapRow{TransactionType: `Item Price`, ItemStatus: Any, PaymentMethod: `SEP`, ShipmentProviderName: Any, Ledger: `94001`}
+	otherPriority := LedgerMapRow{TransactionType: `Item Price`, ItemStatus: Any, PaymentMethod: `SEP`, ShipmentProviderName: Any, Ledger: `33001`, Priority: `1`}
+	invalidFormat := LedgerMapRow{TransactionType: `Fee`, ItemStatus: `delivered`, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `13004`}
+	tests := []struct {
+		name        string
+		table       []LedgerMapRow
+		wantValid   []LedgerMapRow
+		wantInvalid int
+	}{
+		{name: "different priority", table: []LedgerMapRow{valid, otherPriority}, wantValid: []LedgerMapRow{valid, otherPriority}},
+		{name: "overlap with the same specificity and priority", table: []LedgerMapRow{valid, samePriority}, wantInvalid: 2},
+		{name: "invalid format", table: []LedgerMapRow{valid, invalidFormat}, wantValid: []LedgerMapRow{valid}, wantInvalid: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotValid, gotInvalid := FilterLedgerMapTable(tt.table)
+			if !reflect.DeepEqual(gotValid, tt.wantValid) {
+				t.Errorf("FilterLedgerMapTable() valid = %+v, want %+v", gotValid, tt.wantValid)
+			}
+			if len(gotInvalid) != tt.wantInvalid {
+				t.Errorf("FilterLedgerMapTable() invalid = %+v, want %d rows", gotInvalid, tt.wantInvalid)
+			}
+			for _, row := range gotInvalid {
+				if row.Err == `` {
+					t.Errorf("FilterLedgerMapTable() invalid row %+v has no error", row)
+				}
+			}
+		})
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	baa := []LedgerMapRow{
+		{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `1`},
+		{TransactionType: `Item Price`, ItemStatus: `closed`, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `2`},
+	}
+	uploaded := []LedgerMapRow{
+		{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `3`, Priority: `0`},
+		{TransactionType: `Item Price`, ItemStatus: `closed`, PaymentMethod: Any, ShipmentProviderName: Any, Ledger: `4`, Priority: `1`},
+	}
+	want := []LedgerMapRow{baa[1], uploaded[0], uploaded[1]}
+	if got := Upsert(baa, uploaded); !reflect.DeepEqual(got, want) {
+		t.Errorf("Upsert() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAcceptSuggestion(t *testing.T) {
+	templateTable := []LedgerMapTemplateRow{
+		{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: `Prepaid`, ShipmentProviderName: Any, SuggestedLedger: `1`, SuggestedSubledger: `10`},
+		{TransactionType: `Item Price`, ItemStatus: `closed`, PaymentMethod: `Prepaid`, ShipmentProviderName: Any, Ledger: `2`, SuggestedLedger: `1`, SuggestedSubledger: `10`, Priority: `1`},
+		{TransactionType: `Item Price`, ItemStatus: `canceled`, PaymentMethod: `Prepaid`, ShipmentProviderName: Any},
+	}
+	want := []LedgerMapRow{
+		{TransactionType: `Item Price`, ItemStatus: `delivered`, PaymentMethod: `Prepaid`, ShipmentProviderName: Any, Ledger: `1`, Subledger: `10`},
+		{TransactionType: `Item Price`, ItemStatus: `closed`, PaymentMethod: `Prepaid`, ShipmentProviderName: Any, Ledger: `2`, Priority: `1`},
+		{TransactionType: `Item Price`, ItemStatus: `canceled`, PaymentMethod: `Prepaid`, ShipmentProviderName: Any},
+	}
+	if got := AcceptSuggestion(templateTable); !reflect.DeepEqual(got, want) {
+		t.Errorf("AcceptSuggestion() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package quarantinerow
+
+import (
+	"github.com/thomas-bamilo/financebooking/money"
+	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+)
+
+// QuarantineRow represents a row of the table QuarantineTable:
+// a Seller Center transaction not booked because of missing master data (e.g. ledger_map or beneficiary_code),
+// to be booked in a follow-up run once the master data is fixed
+type QuarantineRow struct {
+	Reason               string     `csv:"reason"`
+	IDTransaction        int        `csv:"id_transaction"`
+	OmsIDSalesOrderItem  int        `csv:"oms_id_sales_order_item"`
+	OrderNr              string     `csv:"order_nr"`
+	IDSupplier           int        `csv:"id_supplier"`
+	ShortCode            string     `csv:"short_code"`
+	SupplierName         string     `csv:"supplier_name"`
+	IDTransactionType    int        `csv:"id_transaction_type"`
+	TransactionType      string     `csv:"transaction_type"`
+	TransactionValue     money.Rial `csv:"transaction_value"`
+	TransactionDate      string     `csv:"transaction_date"`
+	ItemStatus           string     `csv:"item_status"`
+	PaymentMethod        string     `csv:"payment_method"`
+	ShipmentProviderName string     `csv:"shipment_provider_name"`
+}
+
+// FromScOmsTable returns the rows of scOmsTable as QuarantineRow quarantined for reason
+func FromScOmsTable(reason string, scOmsTable []scomsrow.ScOmsRow) (quarantineTable []QuarantineRow) {
+	for _, scOmsRow := range scOmsTable {
+		quarantineTable = append(quarantineTable,
+			QuarantineRow{
+				Reason:               reason,
+				IDTransaction:        scOmsRow.IDTransaction,
+				OmsIDSalesOrderItem:  scOmsRow.OmsIDSalesOrderItem,
+				OrderNr:              scOmsRow.OrderNr,
+				IDSupplier:           scOmsRow.IDSupplier,
+				ShortCode:            scOmsRow.ShortCode,
+				SupplierName:         scOmsRow.SupplierName,
+				IDTransactionType:    scOmsRow.IDTransactionType,
+				TransactionType:      scOmsRow.TransactionType,
+				TransactionValue:     scOmsRow.TransactionValue,
+				TransactionDate:      scOmsRow.TransactionDate,
+				ItemStatus:           scOmsRow.ItemStatus,
+				PaymentMethod:        scOmsRow.PaymentMethod,
+				ShipmentProviderName: scOmsRow.ShipmentProviderName,
+			})
+	}
+	return quarantineTable
+}
@@ -0,0 +1,14 @@
+package reconciliationrow
+
+import "github.com/thomas-bamilo/financebooking/money"
+
+// ReconciliationRow represents a step of the reconciliation between Seller Center extract and NGS template:
+// a checkpoint (total at a given step), an exclusion bucket (value removed from booking on purpose)
+// or a check (difference between expected and actual value which should be 0)
+type ReconciliationRow struct {
+	Step     string     `csv:"step"`
+	RowCount int        `csv:"row_count"`
+	Amount   money.Rial `csv:"amount"`
+	Flag     string     `csv:"flag"`
+	Comment  string     `csv:"comment"`
+}
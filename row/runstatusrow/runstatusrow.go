@@ -0,0 +1,25 @@
+package runstatusrow
+
+// Status of a booking run
+const (
+	Succeeded = `succeeded`
+	Failed    = `failed`
+)
+
+// RunStatusRow represents the final status of a booking run:
+// Err is the error which stopped the booking process at FailedStage if Status is Failed
+type RunStatusRow struct {
+	RunID       string `csv:"run_id"`
+	Status      string `csv:"status"`
+	FailedStage string `csv:"failed_stage"`
+	Err         string `csv:"error"`
+	StartedAt   string `csv:"started_at"`
+	FinishedAt  string `csv:"finished_at"`
+	IssueCount  int    `csv:"issue_count"`
+	// OmsNotFoundCount is the number of oms_id_sales_order_item of Seller Center data not found in OMS
+	OmsNotFoundCount int    `csv:"oms_not_found_count"`
+	NgsTemplate      string `csv:"ngs_template"`
+	Reconciliation   string `csv:"reconciliation"`
+	// SQLite is the SQLite database of the run with all the tables and views of the booking
+	SQLite string `csv:"sqlite"`
+}
@@ -2,46 +2,47 @@ package scomsrow
 
 import (
 	"log"
-	"os"
-	"time"
 
-	"github.com/thomas-bamilo/email/goemail"
+	"github.com/thomas-bamilo/financebooking/errorreport"
+	"github.com/thomas-bamilo/financebooking/money"
+	"github.com/thomas-bamilo/financebooking/row/errorreportrow"
 
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
-	"github.com/gocarina/gocsv"
 )
 
 // ScOmsRow represents a row of data coming from Seller Center and OMS used in Finance Booking process
+// monetary values are exact amounts of Rial, see money.Rial
 type ScOmsRow struct {
 	Err string `json:"error"`
 	// Seller Center
-	IDTransaction          int     `json:"id_transaction"`
-	OmsIDSalesOrderItem    int     `json:"oms_id_sales_order_item"`
-	OrderNr                string  `json:"order_nr"`
-	IDSupplier             int     `json:"id_supplier"`
-	ShortCode              string  `json:"short_code"`
-	SupplierName           string  `json:"supplier_name"`
-	IDTransactionType      int     `json:"id_transaction_type"`
-	TransactionType        string  `json:"transaction_type"`
-	TransactionValue       float32 `json:"transaction_value"`
-	IDTransactionStatement int     `json:"id_transaction_statement"`
-	StatementStartDate     string  `json:"statement_start_date"`
-	StatementEndDate       string  `json:"statement_end_date"`
-	Comment                string  `json:"comment"`
+	IDTransaction          int        `json:"id_transaction"`
+	OmsIDSalesOrderItem    int        `json:"oms_id_sales_order_item"`
+	OrderNr                string     `json:"order_nr"`
+	IDSupplier             int        `json:"id_supplier"`
+	ShortCode              string     `json:"short_code"`
+	SupplierName           string     `json:"supplier_name"`
+	IDTransactionType      int        `json:"id_transaction_type"`
+	TransactionType        string     `json:"transaction_type"`
+	TransactionValue       money.Rial `json:"transaction_value"`
+	TransactionDate        string     `json:"transaction_date"`
+	IDTransactionStatement int        `json:"id_transaction_statement"`
+	StatementStartDate     string     `json:"statement_start_date"`
+	StatementEndDate       string     `json:"statement_end_date"`
+	Comment                string     `json:"comment"`
 	// OMS
-	ItemStatus           string  `json:"item_status"`
-	PaymentMethod        string  `json:"payment_method"`
-	ShipmentProviderName string  `json:"shipment_provider_name"`
-	PaidPrice            float32 `json:"paid_price"`
+	ItemStatus           string     `json:"item_status"`
+	PaymentMethod        string     `json:"payment_method"`
+	ShipmentProviderName string     `json:"shipment_provider_name"`
+	PaidPrice            money.Rial `json:"paid_price"`
 	// Finance
-	Voucher           float32 `json:"voucher"`
-	CommissionRevenue float32 `json:"commission_revenue"`
-	CommissionVat     float32 `json:"commission_vat"`
-	LedgerMapKey      string  `json:"ledger_map_key"`
-	Ledger            int     `json:"ledger"`
-	Subledger         int     `json:"subledger"`
-	BeneficiaryCode   int     `json:"beneficiary_code"`
+	Voucher                      money.Rial `json:"voucher"`
+	CommissionRevenue            money.Rial `json:"commission_revenue"`
+	CommissionVat                money.Rial `json:"commission_vat"`
+	CommissionRoundingDifference money.Rial `json:"commission_rounding_difference"`
+	Ledger                       int        `json:"ledger"`
+	Subledger                    int        `json:"subledger"`
+	BeneficiaryCode              int        `json:"beneficiary_code"`
 }
 
 // NgsRow represents a row of NgsTemplate, the final output for Finance
@@ -63,6 +64,7 @@ func (row ScOmsRow) validateScRowFormat() error {
 		validation.Field(&row.IDTransactionType, validation.Required),
 		validation.Field(&row.TransactionType, validation.Required),
 		validation.Field(&row.TransactionValue, validation.Required),
+		validation.Field(&row.TransactionDate, validation.Required, validation.Date(`2006-01-02`)),
 		validation.Field(&row.IDTransactionStatement, validation.Required),
 		validation.Field(&row.StatementStartDate, validation.Required),
 		validation.Field(&row.StatementEndDate, validation.Required),
@@ -84,36 +86,12 @@ func FilterSellerCenterTable(sellerCenter []ScOmsRow) (SellerCenterTableValidRow
 
 }
 
-// IfInvalidSellerCenterRow outputs an error csv and sends it to Finance
-// if there is any row in sellerCenterInvalidTable
-func IfInvalidSellerCenterRow(sellerCenterInvalidTable []ScOmsRow) {
+// IfInvalidSellerCenterRow adds the rows of sellerCenterInvalidTable to report:
+// the invalid rows are not booked and the booking process goes on
+func IfInvalidSellerCenterRow(report *errorreport.Report, sellerCenterInvalidTable []ScOmsRow) {
 	if len(sellerCenterInvalidTable) > 0 {
-		var csvErrorLogP []*ScOmsRow
-		for i := 0; i < len(sellerCenterInvalidTable); i++ {
-			csvErrorLogP = append(csvErrorLogP,
-				&ScOmsRow{
-					Err:                 sellerCenterInvalidTable[i].Err,
-					OmsIDSalesOrderItem: sellerCenterInvalidTable[i].OmsIDSalesOrderItem,
-					OrderNr:             sellerCenterInvalidTable[i].OrderNr,
-					ShortCode:           sellerCenterInvalidTable[i].ShortCode,
-					SupplierName:        sellerCenterInvalidTable[i].SupplierName,
-					TransactionType:     sellerCenterInvalidTable[i].TransactionType,
-					TransactionValue:    sellerCenterInvalidTable[i].TransactionValue,
-					StatementStartDate:  sellerCenterInvalidTable[i].StatementStartDate,
-					StatementEndDate:    sellerCenterInvalidTable[i].StatementEndDate,
-				})
-		}
-		// to write csvErrorLog to csv
-		file, err := os.OpenFile("FinanceBookingErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
-		checkError(err)
-		defer file.Close()
-		// save csvErrorLog to csv
-		err = gocsv.MarshalFile(&csvErrorLogP, file)
+		report.Add(errorReport(errorreport.InvalidSellerCenterRow, errorreport.SellerCenterValidation, sellerCenterInvalidTable)...)
 		log.Println("WARNING: sellerCentertable had some invalid rows, please see FinanceBookingErrorLog.csv")
-		time.Sleep(3 * time.Second)
-		// send csv by email
-		goemail.GoEmail()
-
 	}
 }
 
@@ -186,39 +164,34 @@ func FilterScOmsTable(sellerCenter []ScOmsRow) (ScOmsTableValidRow, ScOmsTableIn
 
 }
 
-// IfInvalidScOmsRow outputs an error csv and sends it to Finance
-// if there is any row in scOmsInvalidTable
-func IfInvalidScOmsRow(scOmsInvalidTable []ScOmsRow) {
+// IfInvalidScOmsRow adds the rows of scOmsInvalidTable to report:
+// the invalid rows are not booked and the booking process goes on
+func IfInvalidScOmsRow(report *errorreport.Report, scOmsInvalidTable []ScOmsRow) {
 	if len(scOmsInvalidTable) > 0 {
-		var csvErrorLogP []*ScOmsRow
-		for i := 0; i < len(scOmsInvalidTable); i++ {
-			csvErrorLogP = append(csvErrorLogP,
-				&ScOmsRow{
-					Err:                  scOmsInvalidTable[i].Err,
-					OmsIDSalesOrderItem:  scOmsInvalidTable[i].OmsIDSalesOrderItem,
-					OrderNr:              scOmsInvalidTable[i].OrderNr,
-					ShortCode:            scOmsInvalidTable[i].ShortCode,
-					SupplierName:         scOmsInvalidTable[i].SupplierName,
-					TransactionType:      scOmsInvalidTable[i].TransactionType,
-					TransactionValue:     scOmsInvalidTable[i].TransactionValue,
-					ItemStatus:           scOmsInvalidTable[i].ItemStatus,
-					PaymentMethod:        scOmsInvalidTable[i].PaymentMethod,
-					ShipmentProviderName: scOmsInvalidTable[i].ShipmentProviderName,
-					PaidPrice:            scOmsInvalidTable[i].PaidPrice,
-				})
-		}
-		// to write csvErrorLog to csv
-		file, err := os.OpenFile("FinanceBookingErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
-		checkError(err)
-		defer file.Close()
-		// save csvErrorLog to csv
-		err = gocsv.MarshalFile(&csvErrorLogP, file)
+		report.Add(errorReport(errorreport.InvalidItemPriceRow, errorreport.SQLiteValidation, scOmsInvalidTable)...)
 		log.Println("WARNING: scOmstable had some invalid rows, please see FinanceBookingErrorLog.csv")
-		time.Sleep(3 * time.Second)
-		// send csv by email
-		goemail.GoEmail()
+	}
+}
 
+// errorReport returns the warnings of category found at stage for the invalid rows of scOmsInvalidTable,
+// identified by their order_nr and transaction_type
+func errorReport(category, stage string, scOmsInvalidTable []ScOmsRow) (errorReportTable []errorreportrow.ErrorReportRow) {
+	for _, row := range scOmsInvalidTable {
+		errorReportTable = append(errorReportTable,
+			errorreportrow.ErrorReportRow{
+				Category:            category,
+				Severity:            errorreport.Warning,
+				Stage:               stage,
+				IDTransaction:       row.IDTransaction,
+				OmsIDSalesOrderItem: row.OmsIDSalesOrderItem,
+				ShortCode:           row.ShortCode,
+				SourceKey:           row.OrderNr + ` - ` + row.TransactionType,
+				RowCount:            1,
+				TransactionValue:    row.TransactionValue,
+				Message:             row.Err,
+			})
 	}
+	return errorReportTable
 }
 
 // filter an array of ScOmsRow
@@ -252,9 +225,3 @@ func isInvalidScOmsRowFormat(row *ScOmsRow) bool {
 	return false
 
 }
-
-func checkError(err error) {
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-}
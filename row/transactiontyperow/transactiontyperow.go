@@ -0,0 +1,13 @@
+package transactiontyperow
+
+import "github.com/thomas-bamilo/financebooking/money"
+
+// TransactionTypeRow represents a row of the table UnmappedTransactionTypeTable:
+// a transaction type of Seller Center with the number of rows and the total value found in sc table
+type TransactionTypeRow struct {
+	Err               string     `csv:"error"`
+	IDTransactionType int        `csv:"id_transaction_type"`
+	TransactionType   string     `csv:"transaction_type"`
+	RowCount          int        `csv:"row_count"`
+	TransactionValue  money.Rial `csv:"transaction_value"`
+}
@@ -0,0 +1,155 @@
+package vatraterow
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// VatRateRow represents a row of the table VatRateTable:
+// the VAT rate (in percent, up to 2 decimals e.g. 9 or 9.5) applied to the transactions created from ValidFrom (included) to ValidTo (excluded)
+// ValidTo is empty while the VAT rate is still valid
+type VatRateRow struct {
+	Err       string `csv:"error"`
+	ValidFrom string `csv:"valid_from"`
+	ValidTo   string `csv:"valid_to"`
+	VatRate   string `csv:"vat_rate"`
+}
+
+// define validation for each field of VatRateRow
+func (row VatRateRow) validateRowFormat() error {
+	return validation.ValidateStruct(&row,
+		validation.Field(&row.ValidFrom, validation.Required, validation.Date(`2006-01-02`)),
+		validation.Field(&row.ValidTo, validation.Date(`2006-01-02`), validation.By(row.isAfterValidFrom)),
+		validation.Field(&row.VatRate, validation.Required, validation.Match(vatRatePattern).Error("must be a percentage below 100 with at most 2 decimals")),
+	)
+}
+
+// vatRatePattern matches a VAT rate in percent below 100 with at most 2 decimals
+var vatRatePattern = regexp.MustCompile(`^[0-9]{1,2}(\.[0-9]{1,2})?$`)
+
+// BasisPoint returns VatRate in hundredths of a percent, e.g. 9.5 returns 950,
+// so that VAT can be computed in SQLite with integer arithmetic only
+func (row VatRateRow) BasisPoint() (int, error) {
+	if !vatRatePattern.MatchString(row.VatRate) {
+		return 0, fmt.Errorf("invalid vat_rate %q: must be a percentage below 100 with at most 2 decimals", row.VatRate)
+	}
+	integerPart, fractionalPart := row.VatRate, ``
+	if i := strings.Index(row.VatRate, `.`); i >= 0 {
+		integerPart, fractionalPart = row.VatRate[:i], row.VatRate[i+1:]
+	}
+	basisPoint, err := strconv.Atoi(integerPart + (fractionalPart + `00`)[:2])
+	if err != nil {
+		return 0, fmt.Errorf("invalid vat_rate %q: %v", row.VatRate, err)
+	}
+	return basisPoint, nil
+}
+
+// isAfterValidFrom checks that ValidTo, if any, is after ValidFrom
+func (row VatRateRow) isAfterValidFrom(value interface{}) error {
+	if row.ValidTo != `` && row.ValidTo <= row.ValidFrom {
+		return fmt.Errorf("must be after valid_from %s", row.ValidFrom)
+	}
+	return nil
+}
+
+// FilterVatRateTable splits VatRateTable into VatRateTableValidRow and VatRateTableInvalidRow
+// rows overlapping the validity dates of another row are invalid: a transaction date must match exactly one VAT rate
+func FilterVatRateTable(vatRateTable []VatRateRow) (VatRateTableValidRow, VatRateTableInvalidRow []VatRateRow) {
+
+	VatRateTableValidRow = filterPointer(vatRateTable, isValidRowFormat)
+	VatRateTableInvalidRow = filterPointer(vatRateTable, isInvalidRowFormat)
+
+	// add error message to VatRateTableInvalidRow
+	for i := 0; i < len(VatRateTableInvalidRow); i++ {
+		VatRateTableInvalidRow[i].Err = VatRateTableInvalidRow[i].validateRowFormat().Error()
+	}
+
+	// sort VatRateTableValidRow by ValidFrom to compare each row with the next one
+	sort.Slice(VatRateTableValidRow, func(i, j int) bool {
+		return VatRateTableValidRow[i].ValidFrom < VatRateTableValidRow[j].ValidFrom
+	})
+	var nonOverlappingRow []VatRateRow
+	for i, row := range VatRateTableValidRow {
+		if i+1 < len(VatRateTableValidRow) && (row.ValidTo == `` || row.ValidTo > VatRateTableValidRow[i+1].ValidFrom) {
+			row.Err = `valid_from - valid_to overlaps the row valid from ` + VatRateTableValidRow[i+1].ValidFrom
+			VatRateTableInvalidRow = append(VatRateTableInvalidRow, row)
+			continue
+		}
+		nonOverlappingRow = append(nonOverlappingRow, row)
+	}
+
+	return nonOverlappingRow, VatRateTableInvalidRow
+
+}
+
+// MissingVatRate returns the date ranges from from (included) to to (excluded) without VAT rate in vatRateTable
+// as VatRateRow without VatRate, ready to be filled in by Finance
+// vatRateTable should only contain valid rows, see FilterVatRateTable
+func MissingVatRate(vatRateTable []VatRateRow, from, to time.Time) (missingVatRateTable []VatRateRow) {
+
+	for date := from; date.Before(to); date = date.AddDate(0, 0, 1) {
+		dateStr := date.Format(`2006-01-02`)
+		covered := false
+		for _, row := range vatRateTable {
+			if row.ValidFrom <= dateStr && (row.ValidTo == `` || dateStr < row.ValidTo) {
+				covered = true
+				break
+			}
+		}
+		// extend the last missing date range if dateStr follows it, otherwise start a new one
+		last := len(missingVatRateTable) - 1
+		switch {
+		case covered:
+		case last >= 0 && missingVatRateTable[last].ValidTo == dateStr:
+			missingVatRateTable[last].ValidTo = date.AddDate(0, 0, 1).Format(`2006-01-02`)
+		default:
+			missingVatRateTable = append(missingVatRateTable, VatRateRow{
+				ValidFrom: dateStr,
+				ValidTo:   date.AddDate(0, 0, 1).Format(`2006-01-02`),
+			})
+		}
+	}
+
+	for i := 0; i < len(missingVatRateTable); i++ {
+		missingVatRateTable[i].Err = `missing VAT rate from ` + missingVatRateTable[i].ValidFrom + ` (included) to ` + missingVatRateTable[i].ValidTo + ` (excluded)`
+	}
+	return missingVatRateTable
+}
+
+// filter an array of VatRateRow with pointer
+func filterPointer(unfilteredTable []VatRateRow, test func(*VatRateRow) bool) (filteredTable []VatRateRow) {
+	for _, row := range unfilteredTable {
+		if test(&row) {
+			filteredTable = append(filteredTable, row)
+		}
+	}
+	return
+}
+
+// check if VatRateRow has valid format
+func isValidRowFormat(row *VatRateRow) bool {
+
+	err := row.validateRowFormat()
+	if err != nil {
+		return false
+	}
+	return true
+
+}
+
+// check if VatRateRow has invalid format
+func isInvalidRowFormat(row *VatRateRow) bool {
+
+	err := row.validateRowFormat()
+	if err != nil {
+		return true
+	}
+	return false
+
+}
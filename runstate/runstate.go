@@ -0,0 +1,177 @@
+package runstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thomas-bamilo/financebooking/bookingperiod"
+)
+
+// manifestFileName is the manifest of a run in the directory of the run
+const manifestFileName = `run.json`
+
+// Run is a booking run identified by ID: the state of each stage of the run is saved as <stage>.json
+// in the directory of the run so that the run can be resumed from any stage without redoing the previous stages
+type Run struct {
+	ID            string                      `json:"id"`
+	BookingPeriod bookingperiod.BookingPeriod `json:"booking_period"`
+	// CompletedStage lists the stages whose state is saved, in the order they were completed
+	CompletedStage []string `json:"completed_stage"`
+	// FailedStage is the stage which stopped the last execution of the run, if any, with the error Err
+	FailedStage string `json:"failed_stage,omitempty"`
+	Err         string `json:"error,omitempty"`
+	// Option holds the command line options which shape the booking, by name, to resume the run with the same options
+	Option map[string]string `json:"option,omitempty"`
+	dir    string
+}
+
+// NewID returns the ID of a new run of bookingPeriod started at now, e.g. 2018-04_20180502-093000
+func NewID(bookingPeriod bookingperiod.BookingPeriod, now time.Time) string {
+	return bookingPeriod.Label() + `_` + now.Format(`20060102-150405`)
+}
+
+// Exists is true if the run id has a manifest in dir
+func Exists(dir, id string) bool {
+	_, err := os.Stat(filepath.Join(dir, id, manifestFileName))
+	return err == nil
+}
+
+// Create creates the directory of the new run id of bookingPeriod in dir and saves its manifest
+func Create(dir, id string, bookingPeriod bookingperiod.BookingPeriod) (*Run, error) {
+	run := &Run{ID: id, BookingPeriod: bookingPeriod, dir: filepath.Join(dir, id)}
+	err := os.MkdirAll(run.dir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("create run %s: %w", id, err)
+	}
+	return run, run.save()
+}
+
+// Open reads the manifest of the existing run id in dir
+func Open(dir, id string) (*Run, error) {
+	run := &Run{dir: filepath.Join(dir, id)}
+	err := readJSON(filepath.Join(run.dir, manifestFileName), run)
+	if err != nil {
+		return nil, fmt.Errorf("open run %s: %w", id, err)
+	}
+	return run, nil
+}
+
+// Dir returns the directory of run
+func (run *Run) Dir() string {
+	return run.dir
+}
+
+// FileName returns the path of the file name in the directory of run, stamped with the booking period and the ID of run:
+// FinanceBooking.sqlite becomes FinanceBooking_2018-04_20180502-093000.sqlite
+func (run *Run) FileName(name string) string {
+	stamp := run.ID
+	if !strings.HasPrefix(stamp, run.BookingPeriod.Label()) {
+		stamp = run.BookingPeriod.Label() + `_` + stamp
+	}
+	extension := filepath.Ext(name)
+	return filepath.Join(run.dir, strings.TrimSuffix(name, extension)+`_`+stamp+extension)
+}
+
+// SaveOption saves option as the options of run
+func (run *Run) SaveOption(option map[string]string) error {
+	run.Option = option
+	return run.save()
+}
+
+// Completed is true if the state of stage is saved
+func (run *Run) Completed(stage string) bool {
+	for _, completedStage := range run.CompletedStage {
+		if completedStage == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// ResumeStage returns the first stage of stageList which is not completed, the stage to resume run from,
+// or an empty string if all the stages are completed
+func (run *Run) ResumeStage(stageList []string) string {
+	for _, stage := range stageList {
+		if !run.Completed(stage) {
+			return stage
+		}
+	}
+	return ``
+}
+
+// Start forgets the state of stage and of the stages completed after it since stage is executed again
+func (run *Run) Start(stage string) error {
+	for i, completedStage := range run.CompletedStage {
+		if completedStage == stage {
+			run.CompletedStage = run.CompletedStage[:i]
+			break
+		}
+	}
+	run.FailedStage = ``
+	run.Err = ``
+	return run.save()
+}
+
+// SaveState saves state as the state of the completed stage
+func (run *Run) SaveState(stage string, state interface{}) error {
+	err := writeJSON(filepath.Join(run.dir, stage+`.json`), state)
+	if err != nil {
+		return fmt.Errorf("save state of stage %s: %w", stage, err)
+	}
+	run.CompletedStage = append(run.CompletedStage, stage)
+	return run.save()
+}
+
+// LoadState loads the state saved by the completed stage into state
+func (run *Run) LoadState(stage string, state interface{}) error {
+	if !run.Completed(stage) {
+		return fmt.Errorf("load state of stage %s: stage %s of run %s is not completed", stage, stage, run.ID)
+	}
+	err := readJSON(filepath.Join(run.dir, stage+`.json`), state)
+	if err != nil {
+		return fmt.Errorf("load state of stage %s: %w", stage, err)
+	}
+	return nil
+}
+
+// Fail records that stage stopped run with stageErr: run can be resumed from stage
+func (run *Run) Fail(stage string, stageErr error) error {
+	run.FailedStage = stage
+	run.Err = stageErr.Error()
+	return run.save()
+}
+
+func (run *Run) save() error {
+	err := writeJSON(filepath.Join(run.dir, manifestFileName), run)
+	if err != nil {
+		return fmt.Errorf("save run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// writeJSON writes v to fileName through a temporary file
+// so that a run stopped while writing never leaves a truncated state behind
+func writeJSON(fileName string, v interface{}) error {
+	content, err := json.MarshalIndent(v, ``, ` `)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(fileName+`.tmp`, content, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fileName+`.tmp`, fileName)
+}
+
+func readJSON(fileName string, v interface{}) error {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
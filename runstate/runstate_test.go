@@ -0,0 +1,165 @@
+package runstate
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thomas-bamilo/financebooking/bookingperiod"
+)
+
+var stageList = []string{`extract_sc`, `validate`, `load_sqlite`, `output`}
+
+// newRun creates a run of April 2018 in a temporary directory with completedStage saved
+func newRun(t *testing.T, completedStage ...string) *Run {
+	t.Helper()
+	bookingPeriod, err := bookingperiod.FromMonth(4, 2018)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := Create(t.TempDir(), `2018-04_20180502-093000`, bookingPeriod)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	for _, stage := range completedStage {
+		err = run.SaveState(stage, map[string]string{`stage`: stage})
+		if err != nil {
+			t.Fatalf("SaveState() error = %v", err)
+		}
+	}
+	return run
+}
+
+func TestNewID(t *testing.T) {
+	bookingPeriod, err := bookingperiod.FromMonth(4, 2018)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := NewID(bookingPeriod, time.Date(2018, 5, 2, 9, 30, 0, 0, time.UTC)), `2018-04_20180502-093000`; got != want {
+		t.Errorf("NewID() = %s, want %s", got, want)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	run := newRun(t)
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{name: "ID starting with the booking period", id: `2018-04_20180502-093000`, want: `FinanceBooking_2018-04_20180502-093000.sqlite`},
+		{name: "ID without the booking period", id: `rerun`, want: `FinanceBooking_2018-04_rerun.sqlite`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run.ID = tt.id
+			if got, want := run.FileName(`FinanceBooking.sqlite`), filepath.Join(run.Dir(), tt.want); got != want {
+				t.Errorf("FileName() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestResumeStage(t *testing.T) {
+	tests := []struct {
+		name           string
+		completedStage []string
+		want           string
+	}{
+		{name: "new run", want: `extract_sc`},
+		{name: "failed run", completedStage: []string{`extract_sc`, `validate`}, want: `load_sqlite`},
+		{name: "completed run", completedStage: stageList, want: ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := newRun(t, tt.completedStage...)
+			if got := run.ResumeStage(stageList); got != tt.want {
+				t.Errorf("ResumeStage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name               string
+		completedStage     []string
+		stage              string
+		wantCompletedStage []string
+	}{
+		{name: "next stage", completedStage: []string{`extract_sc`}, stage: `validate`, wantCompletedStage: []string{`extract_sc`}},
+		{name: "stage executed again", completedStage: stageList, stage: `validate`, wantCompletedStage: []string{`extract_sc`}},
+		{name: "first stage executed again", completedStage: stageList, stage: `extract_sc`, wantCompletedStage: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := newRun(t, tt.completedStage...)
+			err := run.Fail(tt.stage, errTest)
+			if err != nil {
+				t.Fatalf("Fail() error = %v", err)
+			}
+			err = run.Start(tt.stage)
+			if err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			if !reflect.DeepEqual(run.CompletedStage, tt.wantCompletedStage) {
+				t.Errorf("Start() completed stages = %v, want %v", run.CompletedStage, tt.wantCompletedStage)
+			}
+			if run.FailedStage != `` || run.Err != `` {
+				t.Errorf("Start() kept the failure %s: %s", run.FailedStage, run.Err)
+			}
+			if _, err = Open(filepath.Dir(run.Dir()), run.ID); err != nil {
+				t.Errorf("Open() after Start() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestSaveState(t *testing.T) {
+	run := newRun(t, `extract_sc`)
+	err := run.SaveOption(map[string]string{`posting-rules`: `rules.csv`})
+	if err != nil {
+		t.Fatalf("SaveOption() error = %v", err)
+	}
+	err = run.Fail(`validate`, errTest)
+	if err != nil {
+		t.Fatalf("Fail() error = %v", err)
+	}
+
+	// the run is resumed from its manifest
+	if !Exists(filepath.Dir(run.Dir()), run.ID) {
+		t.Fatalf("Exists() = false, want true")
+	}
+	opened, err := Open(filepath.Dir(run.Dir()), run.ID)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if opened.ID != run.ID || !opened.BookingPeriod.From.Equal(run.BookingPeriod.From) || !opened.BookingPeriod.To.Equal(run.BookingPeriod.To) {
+		t.Errorf("Open() = %+v, want %+v", opened, run)
+	}
+	if !reflect.DeepEqual(opened.CompletedStage, []string{`extract_sc`}) || opened.FailedStage != `validate` || opened.Err != errTest.Error() {
+		t.Errorf("Open() stages = %v, failed %s: %s", opened.CompletedStage, opened.FailedStage, opened.Err)
+	}
+	if !reflect.DeepEqual(opened.Option, map[string]string{`posting-rules`: `rules.csv`}) {
+		t.Errorf("Open() options = %v", opened.Option)
+	}
+
+	var state map[string]string
+	err = opened.LoadState(`extract_sc`, &state)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if state[`stage`] != `extract_sc` {
+		t.Errorf("LoadState() = %v, want the state saved by extract_sc", state)
+	}
+	if err = opened.LoadState(`validate`, &state); err == nil {
+		t.Errorf("LoadState() of a stage not completed error = nil, want an error")
+	}
+	if Exists(filepath.Dir(run.Dir()), `unknown`) {
+		t.Errorf("Exists() of an unknown run = true, want false")
+	}
+}
+
+var errTest = errors.New(`stage failed`)
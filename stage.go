@@ -0,0 +1,839 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/thomas-bamilo/financebooking/bookingperiod"
+	"github.com/thomas-bamilo/financebooking/chartofaccount"
+	"github.com/thomas-bamilo/financebooking/csvinteract"
+	"github.com/thomas-bamilo/financebooking/errorreport"
+	"github.com/thomas-bamilo/financebooking/postingrule"
+	"github.com/thomas-bamilo/financebooking/reconciliation"
+	"github.com/thomas-bamilo/financebooking/row/accountrow"
+	"github.com/thomas-bamilo/financebooking/row/chartofaccountrow"
+	"github.com/thomas-bamilo/financebooking/row/ledgermaprow"
+	"github.com/thomas-bamilo/financebooking/row/quarantinerow"
+	"github.com/thomas-bamilo/financebooking/row/reconciliationrow"
+	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+	"github.com/thomas-bamilo/financebooking/row/vatraterow"
+	"github.com/thomas-bamilo/financebooking/runstate"
+
+	"github.com/thomas-bamilo/financebooking/dbinteract/omsinteract"
+	"github.com/thomas-bamilo/financebooking/dbinteract/scinteract"
+	"github.com/thomas-bamilo/financebooking/dbinteract/sqliteinteract/output"
+	"github.com/thomas-bamilo/financebooking/dbinteract/sqliteinteract/sqlitefile"
+	"github.com/thomas-bamilo/financebooking/dbinteract/sqliteinteract/transform"
+	"github.com/thomas-bamilo/financebooking/dbinteract/sqliteinteract/validate"
+	"github.com/thomas-bamilo/financebooking/validation"
+	"github.com/thomas-bamilo/sql/connectdb"
+)
+
+// Stage of the booking process, in order
+const (
+	extractScStage    = `extract_sc`
+	filterRetailStage = `filter_retail`
+	validateStage     = `validate`
+	extractOmsStage   = `extract_oms`
+	loadSQLiteStage   = `load_sqlite`
+	transformStage    = `transform`
+	outputStage       = `output`
+)
+
+// stage is a named step of the booking process which books from the state of the previous stage
+type stage struct {
+	name string
+	// a SQLite stage works on the SQLite tables created by the SQLite stages before it, see openSQLite
+	sqlite bool
+	run    func(booking *booking) error
+}
+
+// stageList lists the stages of the booking process, in order
+var stageList = []stage{
+	{name: extractScStage, run: (*booking).extractSc},
+	{name: filterRetailStage, run: (*booking).filterRetail},
+	{name: validateStage, run: (*booking).validate},
+	{name: extractOmsStage, run: (*booking).extractOms},
+	{name: loadSQLiteStage, sqlite: true, run: (*booking).loadSQLite},
+	{name: transformStage, sqlite: true, run: (*booking).transform},
+	{name: outputStage, sqlite: true, run: (*booking).output},
+}
+
+// stageName returns the names of stageList, in order
+func stageName() (name []string) {
+	for _, oneStage := range stageList {
+		name = append(name, oneStage.name)
+	}
+	return name
+}
+
+// stageIndex returns the index of the stage name in stageList
+func stageIndex(name string) (int, error) {
+	for i, oneStage := range stageList {
+		if oneStage.name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown stage %q, the stages are %v", name, stageName())
+}
+
+// bookingState is what the stages of the booking process pass on to the following stages:
+// the state of each stage is saved with runstate.Run to resume the booking process from the next stage
+type bookingState struct {
+	ErrorReport errorreport.State `json:"error_report"`
+	// ReconciliationTable follows the transaction_value of SellerCenterTable until the NGS template
+	ReconciliationTable []reconciliationrow.ReconciliationRow `json:"reconciliation_table"`
+	ScExtractCheckpoint reconciliationrow.ReconciliationRow   `json:"sc_extract_checkpoint"`
+	ScValidCheckpoint   reconciliationrow.ReconciliationRow   `json:"sc_valid_checkpoint"`
+	ScTableCheckpoint   reconciliationrow.ReconciliationRow   `json:"sc_table_checkpoint"`
+	// BookedExclusionTable lists the exclusion buckets between sc table and the final views
+	BookedExclusionTable []reconciliationrow.ReconciliationRow `json:"booked_exclusion_table"`
+
+	// OmsNotFoundCount is the number of oms_id_sales_order_item of Seller Center data not found in OMS
+	OmsNotFoundCount int `json:"oms_not_found_count"`
+
+	// the tables are dropped once loaded into SQLite, the SQLite snapshot of the stage keeps them:
+	// SellerCenterTable, OmsTable and QuarantineTable by load_sqlite, the master data tables by transform
+	SellerCenterTable      []scomsrow.ScOmsRow           `json:"seller_center_table,omitempty"`
+	ChartOfAccount         chartofaccount.ChartOfAccount `json:"chart_of_account"`
+	BeneficiaryCodeTable   []scomsrow.ScOmsRow           `json:"beneficiary_code_table,omitempty"`
+	VatRateTable           []vatraterow.VatRateRow       `json:"vat_rate_table,omitempty"`
+	QuarantineTable        []quarantinerow.QuarantineRow `json:"quarantine_table,omitempty"`
+	OmsTable               []scomsrow.ScOmsRow           `json:"oms_table,omitempty"`
+	LedgerMapTable         []ledgermaprow.LedgerMapRow   `json:"ledger_map_table,omitempty"`
+	NgsTemplateFileName    string                        `json:"ngs_template_file_name"`
+	ReconciliationFileName string                        `json:"reconciliation_file_name"`
+}
+
+// booking is a booking run going through the stages of the booking process
+type booking struct {
+	bookingPeriod bookingperiod.BookingPeriod
+	postingRule   []postingrule.PostingRule
+	option        bookingOption
+	errorReport   *errorreport.Report
+	state         bookingState
+	// run stamps every output file with the booking period and the run ID and writes it in the directory of the run
+	// so that no run overwrites the outputs of another run, e.g. a follow-up run with -book-quarantine
+	run *runstate.Run
+	// sqliteFileName is the SQLite database of the run, kept to investigate the booking once the run is over
+	sqliteFileName string
+	// the databases are connected once per run, by the first stage which needs them
+	dbSc, dbBaa, dbOms, dbSqlite *sql.DB
+	// baaFetch are the tables of BAA database fetched in the background for the stages of the run, see fetchBaa
+	baaFetch map[string]*baaFetch
+}
+
+// runStages executes the stages of booking from the stage fromStage to the stage toStage, both included,
+// starting from the state saved by run for the stage before fromStage and saving the state of each stage executed
+func runStages(booking *booking, run *runstate.Run, fromStage, toStage string) error {
+
+	first, err := stageIndex(fromStage)
+	if err != nil {
+		return err
+	}
+	last, err := stageIndex(toStage)
+	if err != nil {
+		return err
+	}
+	if first > 0 {
+		err = run.LoadState(stageList[first-1].name, &booking.state)
+		if err != nil {
+			return err
+		}
+		booking.errorReport.Restore(booking.state.ErrorReport)
+	}
+	// writing errorReport now clears the error report of a previous run
+	err = booking.errorReport.Write()
+	if err != nil {
+		return err
+	}
+	booking.fetchBaa(first, last)
+
+	for i := first; i <= last; i++ {
+		oneStage := stageList[i]
+		err = run.Start(oneStage.name)
+		if err != nil {
+			return err
+		}
+		log.Println(`stage ` + oneStage.name)
+		if oneStage.sqlite && booking.dbSqlite == nil {
+			err = openSQLite(booking, run, i)
+		}
+		if err == nil {
+			err = oneStage.run(booking)
+		}
+		if err != nil {
+			stageErr := fmt.Errorf("stage %s: %w", oneStage.name, err)
+			failErr := run.Fail(oneStage.name, stageErr)
+			if failErr != nil {
+				log.Println(`WARNING: ` + failErr.Error())
+			}
+			return stageErr
+		}
+		// the SQLite database is closed and saved for the next SQLite stage to be executed again from it,
+		// the next SQLite stage opens it again from the saved copy, see openSQLite
+		if oneStage.sqlite && i+1 < len(stageList) && stageList[i+1].sqlite {
+			err = booking.dbSqlite.Close()
+			booking.dbSqlite = nil
+			if err != nil {
+				return fmt.Errorf("close SQLite database %s: %w", booking.sqliteFileName, err)
+			}
+			err = sqlitefile.Snapshot(booking.sqliteFileName, sqliteSnapshotFileName(run, oneStage.name))
+			if err != nil {
+				return err
+			}
+		}
+		booking.state.ErrorReport = booking.errorReport.State()
+		err = run.SaveState(oneStage.name, booking.state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openSQLite opens the SQLite database of booking for the SQLite stage stageList[i]:
+// the first SQLite stage starts from an empty database, the other ones from the database saved by the SQLite stage before them
+func openSQLite(booking *booking, run *runstate.Run, i int) error {
+	var err error
+	if i > 0 && stageList[i-1].sqlite {
+		err = sqlitefile.Restore(sqliteSnapshotFileName(run, stageList[i-1].name), booking.sqliteFileName)
+	} else {
+		err = sqlitefile.Remove(booking.sqliteFileName)
+	}
+	if err != nil {
+		return err
+	}
+	booking.dbSqlite, err = sqlitefile.Open(booking.sqliteFileName)
+	if err != nil {
+		return err
+	}
+	log.Println(`SQLite database: ` + booking.sqliteFileName)
+	return nil
+}
+
+// sqliteSnapshotFileName returns the copy of the SQLite database of run saved by the SQLite stage
+func sqliteSnapshotFileName(run *runstate.Run, stage string) string {
+	return filepath.Join(run.Dir(), stage+`.sqlite`)
+}
+
+// close closes the databases connected by the stages of booking
+func (booking *booking) close() {
+	booking.waitAllBaa()
+	for _, db := range []*sql.DB{booking.dbSc, booking.dbBaa, booking.dbOms, booking.dbSqlite} {
+		if db != nil {
+			db.Close()
+		}
+	}
+}
+
+func (booking *booking) baa() *sql.DB {
+	if booking.dbBaa == nil {
+		booking.dbBaa = connectdb.ConnectToBaa()
+	}
+	return booking.dbBaa
+}
+
+// extractSc gets Seller Center data of the booking period
+func (booking *booking) extractSc() error {
+
+	// the tables of BAA database are fetched meanwhile, see fetchBaa
+	start := time.Now()
+	booking.dbSc = connectdb.ConnectToSc()
+	sellerCenterTable, err := scinteract.GetSellerCenterData(booking.dbSc, booking.bookingPeriod)
+	if err != nil {
+		return err
+	}
+	log.Println(`fetched sellerCenterTable from Seller Center in ` + time.Since(start).Round(time.Millisecond).String())
+	log.Println(`sellerCenterTable length: ` + strconv.Itoa(len(sellerCenterTable)))
+
+	booking.state.SellerCenterTable = sellerCenterTable
+	booking.state.ScExtractCheckpoint = reconciliation.ScOmsTableCheckpoint(`seller_center_extract`, `transaction_value extracted from Seller Center`, sellerCenterTable)
+	booking.state.ReconciliationTable = []reconciliationrow.ReconciliationRow{booking.state.ScExtractCheckpoint}
+	return nil
+}
+
+// filterRetail filters out retail suppliers
+// and, with -book-quarantine, keeps only the rows quarantined by a previous run
+func (booking *booking) filterRetail() error {
+
+	table, err := booking.waitBaa(retailShortCodeSource)
+	if err != nil {
+		return err
+	}
+	retailShortCodeTable := table.([]scomsrow.ScOmsRow)
+	sellerCenterTable := validation.FilterRetailShortCode(retailShortCodeTable, booking.state.SellerCenterTable)
+	log.Println(`retail suppliers filtered out`)
+	log.Println(`sellerCenterTable length: ` + strconv.Itoa(len(sellerCenterTable)))
+	scNoRetailCheckpoint := reconciliation.ScOmsTableCheckpoint(`seller_center_no_retail`, ``, sellerCenterTable)
+	booking.state.ReconciliationTable = append(booking.state.ReconciliationTable,
+		reconciliation.Exclusion(`excluded_retail_supplier`, `retail suppliers are not booked`, booking.state.ScExtractCheckpoint, scNoRetailCheckpoint))
+
+	// book only the rows quarantined by a previous run, once the master data is fixed
+	if booking.option.bookQuarantineFileName != `` {
+		var quarantineTableP []*quarantinerow.QuarantineRow
+		previousQuarantineTable, err := csvinteract.ReadQuarantineCSV(booking.option.bookQuarantineFileName, quarantineTableP)
+		if err != nil {
+			return err
+		}
+		log.Println(`previousQuarantineTable length: ` + strconv.Itoa(len(previousQuarantineTable)))
+		sellerCenterTable = validation.FilterQuarantine(previousQuarantineTable, sellerCenterTable)
+		log.Println(`sellerCenterTable length: ` + strconv.Itoa(len(sellerCenterTable)))
+		scQuarantinedCheckpoint := reconciliation.ScOmsTableCheckpoint(`seller_center_quarantined`, ``, sellerCenterTable)
+		booking.state.ReconciliationTable = append(booking.state.ReconciliationTable,
+			reconciliation.Exclusion(`excluded_not_quarantined`, `rows not quarantined in `+booking.option.bookQuarantineFileName+` are not booked again`, scNoRetailCheckpoint, scQuarantinedCheckpoint))
+	}
+
+	booking.state.SellerCenterTable = sellerCenterTable
+	return nil
+}
+
+// validate checks the master data of BAA database and the rows of Seller Center data:
+// chart_of_account, the format of Seller Center rows, beneficiary_code_map and vat_rate
+func (booking *booking) validate() error {
+
+	// resolve the Account Codes of the NGS template from chart_of_account table of BAA database, overridden by the command line
+	// and check them against the account master of NGS from account table of BAA database
+	chartOfAccount := make(chartofaccount.ChartOfAccount)
+	table, err := booking.waitBaa(chartOfAccountSource)
+	if err != nil {
+		return err
+	}
+	chartOfAccountTable := table.([]chartofaccountrow.ChartOfAccountRow)
+	chartOfAccountTable, chartOfAccountTableInvalidRow := chartofaccountrow.FilterChartOfAccountTable(chartOfAccountTable)
+	// IfInvalidChartOfAccount STOPs the booking process if any invalid row in chart_of_account table of BAA database
+	err = validation.IfInvalidChartOfAccount(booking.errorReport, chartOfAccountTableInvalidRow)
+	if err != nil {
+		return err
+	}
+	for _, chartOfAccountRow := range chartOfAccountTable {
+		chartOfAccount[chartOfAccountRow.AccountRole] = chartOfAccountRow.AccountCode
+	}
+	for accountRole, accountCode := range booking.option.accountCode {
+		chartOfAccount[accountRole] = accountCode
+	}
+	table, err = booking.waitBaa(accountSource)
+	if err != nil {
+		return err
+	}
+	// the rows of account table are checked by the upload of account.csv, invalid rows are left out
+	accountTable, _ := accountrow.FilterAccountTable(table.([]accountrow.AccountRow))
+	// IfInvalidAccountCode STOPs the booking process if any role of the posting rules has no valid Account Code
+	err = validation.IfInvalidAccountCode(booking.errorReport, chartOfAccount.Invalid(postingrule.AccountRole(booking.postingRule), accountrow.AccountCode(accountTable)))
+	if err != nil {
+		return err
+	}
+	log.Println(`chartOfAccount`)
+	booking.state.ChartOfAccount = chartOfAccount
+
+	// check if sellerCenterTable has any invalid row
+	// if sellerCenterTable has any invalid row, send the invalid rows to Finance
+	// and continue the process only with valid rows
+	// FYI: this step DOES NOT remove any seller without ShortCode (e.g. Bamilo) --> you should make sure they are removed
+	sellerCenterTable, sellerCenterTableInvalidRow := scomsrow.FilterSellerCenterTable(booking.state.SellerCenterTable)
+	log.Println(`checked seller center rows validity`)
+	log.Println(`sellerCenterTable length: ` + strconv.Itoa(len(sellerCenterTable)))
+	log.Println(`sellerCenterTableInvalidRow length: ` + strconv.Itoa(len(sellerCenterTableInvalidRow)))
+	scomsrow.IfInvalidSellerCenterRow(booking.errorReport, sellerCenterTableInvalidRow)
+	log.Println(`IfInvalidSellerCenterRow`)
+	booking.state.ReconciliationTable = append(booking.state.ReconciliationTable,
+		reconciliation.ScOmsTableExclusion(`excluded_invalid_seller_center_row`, `invalid rows sent to Finance in FinanceBookingErrorLog.csv`, sellerCenterTableInvalidRow))
+
+	// check benef_code_map is complete ------------------------------------------------
+	// get all the short_code from beneficiary_code_map table of BAA database to check against the ShortCode of sellerCenterTable
+	table, err = booking.waitBaa(beneficiaryCodeSource)
+	if err != nil {
+		return err
+	}
+	beneficiaryCodeTable := table.([]scomsrow.ScOmsRow)
+	log.Println(`beneficiaryCodeTable`)
+	log.Println(`beneficiaryCodeTable length: ` + strconv.Itoa(len(beneficiaryCodeTable)))
+	// split the rows of sellerCenterTable with a short_code missing in beneficairy_code_map table of BAA database
+	sellerCenterTable, sellerCenterTableMissingBeneficiaryCode := validation.QuarantineMissingBeneficiaryCode(beneficiaryCodeTable, sellerCenterTable)
+	log.Println(`sellerCenterTableMissingBeneficiaryCode length: ` + strconv.Itoa(len(sellerCenterTableMissingBeneficiaryCode)))
+
+	// IfMissingBeneficiaryCode STOPs the booking process if any missing short_code in beneficairy_code_map table of BAA database
+	// unless quarantineMissingMasterData: the rows with missing short_code are then quarantined and all other rows are booked
+	err = validation.IfMissingBeneficiaryCode(booking.errorReport, sellerCenterTableMissingBeneficiaryCode, booking.run.FileName(`benef_code_map_template.csv`), !booking.option.quarantineMissingMasterData)
+	if err != nil {
+		return err
+	}
+	log.Println(`IfMissingBeneficiaryCode`)
+	booking.state.QuarantineTable = quarantinerow.FromScOmsTable(`missing beneficiary_code`, sellerCenterTableMissingBeneficiaryCode)
+	booking.state.ReconciliationTable = append(booking.state.ReconciliationTable,
+		reconciliation.ScOmsTableExclusion(`excluded_quarantined_missing_beneficiary_code`, `rows with missing beneficiary_code quarantined in quarantine.csv`, sellerCenterTableMissingBeneficiaryCode))
+	booking.state.ScValidCheckpoint = reconciliation.Remainder(`seller_center_valid`, ``, booking.state.ScExtractCheckpoint, booking.state.ReconciliationTable[1:]...)
+
+	// check vat_rate is valid and complete ------------------------------------------------
+	// get the VAT rates and their validity dates from vat_rate table of BAA database
+	table, err = booking.waitBaa(vatRateSource)
+	if err != nil {
+		return err
+	}
+	vatRateTable := table.([]vatraterow.VatRateRow)
+	log.Println(`vatRateTable length: ` + strconv.Itoa(len(vatRateTable)))
+	vatRateTable, vatRateTableInvalidRow := vatraterow.FilterVatRateTable(vatRateTable)
+	// check if any date of the booking period has no VAT rate in vat_rate table of BAA database
+	vatRateTableInvalidRow = append(vatRateTableInvalidRow, vatraterow.MissingVatRate(vatRateTable, booking.bookingPeriod.From, booking.bookingPeriod.To)...)
+	log.Println(`vatRateTableInvalidRow length: ` + strconv.Itoa(len(vatRateTableInvalidRow)))
+	// IfInvalidVatRate STOPs the booking process if any invalid VAT rate or any date of the booking period without VAT rate
+	err = validation.IfInvalidVatRate(booking.errorReport, vatRateTableInvalidRow)
+	if err != nil {
+		return err
+	}
+	log.Println(`IfInvalidVatRate`)
+
+	booking.state.SellerCenterTable = sellerCenterTable
+	booking.state.BeneficiaryCodeTable = beneficiaryCodeTable
+	booking.state.VatRateTable = vatRateTable
+	return nil
+}
+
+// extractOms gets OMS data of the rows of Seller Center data currently booked
+func (booking *booking) extractOms() error {
+
+	// get uniqueOmsIDSalesOrderItemList from Seller Center table
+	// uniqueOmsIDSalesOrderItemList represents in OMS the rows currently booked
+	uniqueOmsIDSalesOrderItemList := uniqueOmsIDSalesOrderItem(booking.state.SellerCenterTable)
+	log.Println(`uniqueOmsIDSalesOrderItemList length: ` + strconv.Itoa(len(uniqueOmsIDSalesOrderItemList)))
+	if len(uniqueOmsIDSalesOrderItemList) == 0 {
+		log.Println(`WARNING: no Seller Center row to look up in OMS`)
+		booking.state.OmsTable = nil
+		booking.state.OmsNotFoundCount = 0
+		return nil
+	}
+
+	// get OMS data
+	start := time.Now()
+	booking.dbOms = connectdb.ConnectToOms()
+	omsTable, notFoundOmsIDSalesOrderItem, err := omsinteract.GetOmsData(booking.dbOms, uniqueOmsIDSalesOrderItemList, booking.option.omsChunkSize, booking.option.omsWorkerCount)
+	if err != nil {
+		return err
+	}
+	log.Println(`fetched omsTable from OMS in ` + time.Since(start).Round(time.Millisecond).String())
+	log.Println(`omsTable length: ` + strconv.Itoa(len(omsTable)))
+	// the ids not found in OMS are sent to Finance in the error report
+	// and their Item Price rows are reported as invalid item price rows while loading SQLite
+	validation.IfOmsNotFound(booking.errorReport, notFoundOmsIDSalesOrderItem, len(uniqueOmsIDSalesOrderItemList))
+	booking.state.OmsNotFoundCount = len(notFoundOmsIDSalesOrderItem)
+
+	booking.state.OmsTable = omsTable
+	return nil
+}
+
+// loadSQLite loads Seller Center and OMS data into SQLite, splits them by transaction type,
+// checks the item prices against ledger_map table of BAA database and loads vat_rate into SQLite
+func (booking *booking) loadSQLite() error {
+
+	dbSqlite := booking.dbSqlite
+	errorReport := booking.errorReport
+
+	// split sellerCenterTable by IDTransaction in SQLite------------------------------------------
+	// create sc table in SQLite
+	failedRow, err := validate.CreateScTable(dbSqlite, booking.state.SellerCenterTable)
+	if err != nil {
+		return err
+	}
+	err = validation.IfFailedSQLiteLoad(booking.errorReport, `sc`, failedRow)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreatedScTable`)
+	scTableRowCount, scTableTransactionValue, err := validate.ReturnScTableTotal(dbSqlite)
+	if err != nil {
+		return err
+	}
+	scTableCheckpoint := reconciliation.Checkpoint(`sc_table`, `transaction_value loaded into sc SQLite table`, scTableRowCount, scTableTransactionValue)
+	booking.state.ScTableCheckpoint = scTableCheckpoint
+	booking.state.ReconciliationTable = append(booking.state.ReconciliationTable,
+		scTableCheckpoint,
+		reconciliation.Check(`check_seller_center_valid_to_sc_table`, `rows lost while loading sc SQLite table`, booking.state.ScValidCheckpoint, scTableCheckpoint, booking.option.reconciliationTolerance))
+	err = validate.DownloadToCsvTest(dbSqlite, `sc`, booking.run)
+	if err != nil {
+		return err
+	}
+	// create oms table in SQLite
+	failedRow, err = validate.CreateOmsTableItemPrice(dbSqlite, booking.state.OmsTable)
+	if err != nil {
+		return err
+	}
+	err = validation.IfFailedSQLiteLoad(booking.errorReport, `oms`, failedRow)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreatedOmsTableItemPrice`)
+	err = validate.DownloadToCsvTest(dbSqlite, `oms`, booking.run)
+	if err != nil {
+		return err
+	}
+	// CreateTransactionTypeTable splits sc table into transaction_type views in SQLite
+	// - it also splits sc table between rows with comment vs. without comment
+	// - it also joins oms table to item_price and item_price_credit views without comment
+	err = validate.CreateTransactionTypeTable(dbSqlite)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreatedTransactionTypeTable`)
+	// check if sc table has any id_transaction_type not mapped to a transaction_type view
+	// if sc table has any unmapped id_transaction_type, send the unmapped transaction types to Finance
+	// and STOP the booking process if stopOnUnmappedTransactionType
+	unmappedTransactionTypeTable, err := validate.ReturnUnmappedTransactionTypeTable(dbSqlite)
+	if err != nil {
+		return err
+	}
+	log.Println(`unmappedTransactionTypeTable length: ` + strconv.Itoa(len(unmappedTransactionTypeTable)))
+	err = validation.IfUnmappedTransactionType(errorReport, unmappedTransactionTypeTable, booking.option.stopOnUnmappedTransactionType)
+	if err != nil {
+		return err
+	}
+	log.Println(`IfUnmappedTransactionType`)
+	unmappedTransactionTypeExclusion := reconciliation.TransactionTypeTableExclusion(`excluded_unmapped_transaction_type`, `transaction types not mapped in arrayOfTransactionType`, unmappedTransactionTypeTable)
+	booking.state.ReconciliationTable = append(booking.state.ReconciliationTable, unmappedTransactionTypeExclusion)
+	/*validate.DownloadToCsvTest(dbSqlite, `item_price_credit`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `item_price`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `commission`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `commission_credit`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `shipping_fee`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `shipping_fee_credit`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `cancel_penalty_wi_24`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `cancel_penalty_a_24`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `consign_handling_fee`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `down_payment_credit`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `lost_damaged_credit`, booking.run)
+	validate.DownloadToCsvTest(dbSqlite, `storage_fee`, booking.run)*/
+
+	// check if item_price_oms and item_price_credit_oms have invalid rows-----------------------------------------------------------------
+	// mostly, rows should not have missing values for fields involved in ledger mapping
+	// return itemPriceAndCreditTableForValidation to check if any invalid row
+	itemPriceAndCreditTableForValidation, err := validate.ReturnItemPriceAndCreditTableForValidation(dbSqlite)
+	if err != nil {
+		return err
+	}
+	log.Println(`ReturnedItemPriceAndCreditTableForValidation`)
+	log.Println(`itemPriceAndCreditTableForValidation length: ` + strconv.Itoa(len(itemPriceAndCreditTableForValidation)))
+
+	// check if itemPriceAndCreditTableForValidation has any invalid row
+	// if itemPriceAndCreditTableForValidation has any invalid row, send the invalid rows to Finance
+	// and continue the process only with valid rows
+	// FYI: itemPriceAndCreditTableForValidation is the union of item_price_oms and item_price_credit_oms SQLite views
+	itemPriceAndCreditTableForValidation, itemPriceAndCreditTableForValidationInvalidRow := scomsrow.FilterScOmsTable(itemPriceAndCreditTableForValidation)
+	log.Println(`FilteredScOmsTable`)
+	log.Println(`itemPriceAndCreditTableForValidation length: ` + strconv.Itoa(len(itemPriceAndCreditTableForValidation)))
+	log.Println(`itemPriceAndCreditTableForValidationInvalidRow length: ` + strconv.Itoa(len(itemPriceAndCreditTableForValidationInvalidRow)))
+	scomsrow.IfInvalidScOmsRow(errorReport, itemPriceAndCreditTableForValidationInvalidRow)
+	log.Println(`IfInvalidScOmsRow`)
+	invalidScOmsRowExclusion := reconciliation.ScOmsTableExclusion(`excluded_invalid_item_price_row`, `invalid item price and item price credit rows sent to Finance in FinanceBookingErrorLog.csv`, itemPriceAndCreditTableForValidationInvalidRow)
+	booking.state.ReconciliationTable = append(booking.state.ReconciliationTable, invalidScOmsRowExclusion)
+
+	// check ledger_map is complete -----------------------------------------------------------------------------------------------------
+	// get the rows of ledger_map table of BAA database to check against itemPriceAndCreditTableForValidation
+	table, err := booking.waitBaa(ledgerMapSource)
+	if err != nil {
+		return err
+	}
+	ledgerMapTable := table.([]ledgermaprow.LedgerMapRow)
+	log.Println(`GotLedgerMap`)
+	log.Println(`ledgerMapTable length: ` + strconv.Itoa(len(ledgerMapTable)))
+
+	// check that ledger_map rows are valid and that no transaction can match two rows with the same specificity and priority
+	// IfInvalidLedgerMap STOPs the booking process if any row of ledger_map is invalid
+	ledgerMapTable, ledgerMapTableInvalidRow := ledgermaprow.FilterLedgerMapTable(ledgerMapTable)
+	log.Println(`FilteredLedgerMapTable`)
+	log.Println(`ledgerMapTableInvalidRow length: ` + strconv.Itoa(len(ledgerMapTableInvalidRow)))
+	err = validation.IfInvalidLedgerMap(errorReport, ledgerMapTableInvalidRow)
+	if err != nil {
+		return err
+	}
+	log.Println(`IfInvalidLedgerMap`)
+
+	// split the rows of itemPriceAndCreditTableForValidation matching no row of ledger_map table of BAA database
+	itemPriceAndCreditTableForValidation, itemPriceAndCreditTableMissingLedgerMap := validation.QuarantineMissingLedgerMap(ledgerMapTable, itemPriceAndCreditTableForValidation)
+	log.Println(`itemPriceAndCreditTableMissingLedgerMap length: ` + strconv.Itoa(len(itemPriceAndCreditTableMissingLedgerMap)))
+
+	// IfMissingLedgerMap STOPs the booking process if any missing ledger_map in ledger_map table of BAA database compared to itemPriceAndCreditTableForValidation
+	// unless quarantineMissingMasterData: the rows with missing ledger_map are then quarantined and all other rows are booked
+	err = validation.IfMissingLedgerMap(errorReport, ledgerMapTable, itemPriceAndCreditTableMissingLedgerMap, booking.run.FileName(`ledger_map_template.csv`), !booking.option.quarantineMissingMasterData)
+	if err != nil {
+		return err
+	}
+	log.Println(`IfMissingLedgerMap`)
+	quarantineTable := append(booking.state.QuarantineTable, quarantinerow.FromScOmsTable(`missing ledger_map`, itemPriceAndCreditTableMissingLedgerMap)...)
+	missingLedgerMapExclusion := reconciliation.ScOmsTableExclusion(`excluded_quarantined_missing_ledger_map`, `item price and item price credit rows with missing ledger_map quarantined in quarantine.csv`, itemPriceAndCreditTableMissingLedgerMap)
+
+	// quarantine the whole order of the rows with missing ledger_map, otherwise its commission, fees and other item prices
+	// would be booked now and again by the follow-up run with -book-quarantine
+	// - the other item price and item price credit rows of the order are not loaded into item_price_credit_valid and item_price_valid
+	// - the other rows of the order are deleted from sc table so that no transaction_type view books them
+	itemPriceAndCreditTableForValidation, itemPriceAndCreditTableQuarantinedOrder := validation.QuarantineOrder(itemPriceAndCreditTableMissingLedgerMap, itemPriceAndCreditTableForValidation)
+	var scTableQuarantinedOrder []scomsrow.ScOmsRow
+	_, sellerCenterTableQuarantinedOrder := validation.QuarantineOrder(itemPriceAndCreditTableMissingLedgerMap, booking.state.SellerCenterTable)
+	for _, row := range sellerCenterTableQuarantinedOrder {
+		// item price and item price credit rows are handled above, rows of unmapped transaction types are not booked anyway
+		transactionType, ok := validate.TransactionTypeOf(row.IDTransactionType)
+		if ok && transactionType != `item_price` && transactionType != `item_price_credit` {
+			scTableQuarantinedOrder = append(scTableQuarantinedOrder, row)
+		}
+	}
+	err = validate.DeleteScRow(dbSqlite, scTableQuarantinedOrder)
+	if err != nil {
+		return err
+	}
+	quarantinedOrderTable := append(itemPriceAndCreditTableQuarantinedOrder, scTableQuarantinedOrder...)
+	log.Println(`quarantinedOrderTable length: ` + strconv.Itoa(len(quarantinedOrderTable)))
+	quarantineTable = append(quarantineTable, quarantinerow.FromScOmsTable(`order with missing ledger_map`, quarantinedOrderTable)...)
+	quarantinedOrderExclusion := reconciliation.ScOmsTableExclusion(`excluded_quarantined_order_missing_ledger_map`, `other rows of the orders with missing ledger_map quarantined in quarantine.csv`, quarantinedOrderTable)
+
+	booking.state.ReconciliationTable = append(booking.state.ReconciliationTable, missingLedgerMapExclusion, quarantinedOrderExclusion)
+	booking.state.BookedExclusionTable = []reconciliationrow.ReconciliationRow{unmappedTransactionTypeExclusion, invalidScOmsRowExclusion, missingLedgerMapExclusion, quarantinedOrderExclusion}
+
+	// Create item_price_credit_valid and item_price_valid SQLite tables
+	// before errorReport is sent so that the rows which could not be loaded are reported to Finance
+	failedRow, err = validate.CreateItemPriceCreditValidTable(dbSqlite, itemPriceAndCreditTableForValidation)
+	if err != nil {
+		return err
+	}
+	err = validation.IfFailedSQLiteLoad(booking.errorReport, `item_price_credit_valid`, failedRow)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateItemPriceCreditValidTable`)
+	err = validate.DownloadToCsvTest(dbSqlite, `item_price_credit_valid`, booking.run)
+	if err != nil {
+		return err
+	}
+	failedRow, err = validate.CreateItemPriceValidTable(dbSqlite, itemPriceAndCreditTableForValidation)
+	if err != nil {
+		return err
+	}
+	err = validation.IfFailedSQLiteLoad(booking.errorReport, `item_price_valid`, failedRow)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateItemPriceValidTable`)
+	err = validate.DownloadToCsvTest(dbSqlite, `item_price_valid`, booking.run)
+	if err != nil {
+		return err
+	}
+
+	// Create vat_rate SQLite table, used by transform, before errorReport is sent so that the rows which could not be loaded are reported to Finance
+	failedVatRateRow, err := transform.CreateVatRateTable(dbSqlite, booking.state.VatRateTable)
+	if err != nil {
+		return err
+	}
+	err = validation.IfFailedVatRateLoad(booking.errorReport, failedVatRateRow)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateVatRateTable`)
+
+	// all the validations are done: send the issues of errorReport to Finance, if any
+	err = errorReport.Send()
+	if err != nil {
+		return err
+	}
+	log.Println(`errorReport: ` + strconv.Itoa(errorReport.Len()) + ` issues`)
+
+	// Create quarantine SQLite table and report the quarantined rows and their totals, to be booked in a follow-up run with -book-quarantine
+	err = validate.CreateQuarantineTable(dbSqlite, quarantineTable)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateQuarantineTable`)
+	log.Println(`quarantineTable length: ` + strconv.Itoa(len(quarantineTable)))
+	err = validate.DownloadQuarantineToCsv(dbSqlite, booking.run)
+	if err != nil {
+		return err
+	}
+
+	booking.state.LedgerMapTable = ledgerMapTable
+	// the extract and vat_rate are in the SQLite snapshot of load_sqlite from now on, the next stages do not need them in their state
+	booking.state.SellerCenterTable = nil
+	booking.state.OmsTable = nil
+	booking.state.QuarantineTable = nil
+	booking.state.VatRateTable = nil
+	return nil
+}
+
+// transform adds all necessary data to the valid ipc, ipt and commission data by joining tables and adding calculated fields
+func (booking *booking) transform() error {
+
+	dbSqlite := booking.dbSqlite
+
+	// Create ledger_map SQLite table
+	err := transform.CreateLedgerMapTable(dbSqlite, booking.state.LedgerMapTable)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateLedgerMapTable`)
+	// Create beneficiary_code_map SQLite table
+	err = transform.CreateBeneficiaryCodeTable(dbSqlite, booking.state.BeneficiaryCodeTable)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateBeneficiaryCodeTable`)
+
+	// ipc_ipt_c process ---------------------------------------------------------------------------------------------------------------
+	// add all necessary data by joining tables and adding calculated fields
+	err = transform.CreateIpcFinal(dbSqlite)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateIpcFinal`)
+	err = transform.DownloadIpcIptToCsv(dbSqlite, `ipc_final`, booking.run)
+	if err != nil {
+		return err
+	}
+	err = transform.CreateIptFinal(dbSqlite)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateIptFinal`)
+	err = transform.DownloadIpcIptToCsv(dbSqlite, `ipt_final`, booking.run)
+	if err != nil {
+		return err
+	}
+	err = transform.CreateCommissionFinal(dbSqlite)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateCommissionFinal`)
+	err = transform.DownloadCommissionToCsv(dbSqlite, `commission_final`, booking.run)
+	if err != nil {
+		return err
+	}
+	err = transform.CreateShippingFeeFinal(dbSqlite)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateShippingFeeFinal`)
+	err = transform.DownloadToCsv(dbSqlite, `shipping_fee_final`, booking.run)
+	if err != nil {
+		return err
+	}
+	err = transform.CreateCancelPenaltyFinal(dbSqlite)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateCancelPenaltyFinal`)
+	err = transform.DownloadToCsv(dbSqlite, `cancel_penalty_final`, booking.run)
+	if err != nil {
+		return err
+	}
+	err = transform.CreateOtherTransactionFinal(dbSqlite, postingrule.OtherTransactionType(booking.postingRule))
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateOtherTransactionFinal`)
+	err = transform.DownloadToCsv(dbSqlite, `other_transaction_final`, booking.run)
+	if err != nil {
+		return err
+	}
+
+	// the master data is in the SQLite snapshot of transform from now on, output does not need it in its state
+	booking.state.LedgerMapTable = nil
+	booking.state.BeneficiaryCodeTable = nil
+	return nil
+}
+
+// output writes the NGS template from the posting rules and reconciles it with Seller Center data
+func (booking *booking) output() error {
+
+	dbSqlite := booking.dbSqlite
+	postingRule := booking.postingRule
+	chartOfAccount := booking.state.ChartOfAccount
+
+	// create all the "ngs-friendly" data tables from the posting rules
+	for _, ledgerAmountView := range postingrule.LedgerAmountView(postingRule) {
+		err := output.CreateLedgerAmountView(dbSqlite, ledgerAmountView, postingRule, chartOfAccount)
+		if err != nil {
+			return err
+		}
+		log.Println(`CreateLedgerAmountView ` + ledgerAmountView)
+		err = output.DownloadToCsvTest(dbSqlite, ledgerAmountView, booking.run)
+		if err != nil {
+			return err
+		}
+	}
+	err := output.CreateTotalLedgerAmountView(dbSqlite, postingRule, chartOfAccount)
+	if err != nil {
+		return err
+	}
+	log.Println(`CreateTotalLedgerAmountView`)
+	err = output.DownloadToCsvTest(dbSqlite, `total_ledger_amount`, booking.run)
+	if err != nil {
+		return err
+	}
+
+	err = validate.DownloadToCsvTest(dbSqlite, `item_price_oms`, booking.run)
+	if err != nil {
+		return err
+	}
+	err = validate.DownloadToCsvTest(dbSqlite, `item_price_credit_oms`, booking.run)
+	if err != nil {
+		return err
+	}
+
+	// output ngsIpcIptC template
+	// ReturnNgsIpcIptC STOPs the booking process if ngsIpcIptC template does not balance, unless allowUnbalancedDraft
+	ngsTemplateFileName, err := output.ReturnNgsIpcIptC(dbSqlite, booking.run, postingRule, booking.option.ngsBalanceTolerance, booking.option.allowUnbalancedDraft)
+	if err != nil {
+		return err
+	}
+	log.Println(`ReturnNgsIpcIptC`)
+
+	// reconcile Seller Center data with ngsIpcIptC template ----------------------------------------------------------------------------
+	// (i) the transaction_value of sc table minus the exclusion buckets should be the transaction_value of the final views
+	expectedBookedCheckpoint := reconciliation.Remainder(`expected_booked`, `sc_table minus exclusion buckets`, booking.state.ScTableCheckpoint, booking.state.BookedExclusionTable...)
+	bookedRowCount, bookedTransactionValue, err := output.ReturnBookedTransactionValue(dbSqlite, postingRule)
+	if err != nil {
+		return err
+	}
+	bookedCheckpoint := reconciliation.Checkpoint(`booked`, `transaction_value of all the final views`, bookedRowCount, bookedTransactionValue)
+	// (ii) the seller payable lines of ngsIpcIptC template, with the sign of transaction_value, should book the remainder of (i)
+	// transaction type by transaction type
+	bookedTable, err := output.ReturnBookedTransactionValueByTransactionType(dbSqlite, postingRule)
+	if err != nil {
+		return err
+	}
+	sellerPayableTable, err := output.ReturnSellerPayableByTransactionType(dbSqlite)
+	if err != nil {
+		return err
+	}
+	sellerPayableCheckpoint := reconciliation.TransactionTypeTableCheckpoint(`ngs_seller_payable`, `total_ledger_amount lines of ngsTemplateIpcIptC.csv with the sign of transaction_value`, sellerPayableTable)
+	// (iii) ngsTemplateIpcIptC.csv should have all the seller payable lines of ngs_template_ipc_ipt_c SQLite view
+	expectedNgsRowCount, expectedNgsAmount, err := output.ReturnSellerPayableAmount(dbSqlite, postingRule, chartOfAccount)
+	if err != nil {
+		return err
+	}
+	expectedNgsCheckpoint := reconciliation.Checkpoint(`expected_ngs_template_seller_payable`, `lines of ngs_template_ipc_ipt_c booked on seller payable`, expectedNgsRowCount, expectedNgsAmount)
+	ngsCheckpoint, err := reconciliation.NgsTemplateCheckpoint(`ngs_template_seller_payable`, `lines of ngsTemplateIpcIptC.csv booked on seller payable`, ngsTemplateFileName, chartOfAccount[chartofaccount.SellerPayable])
+	if err != nil {
+		return err
+	}
+	reconciliationTable := append(booking.state.ReconciliationTable,
+		expectedBookedCheckpoint,
+		bookedCheckpoint,
+		reconciliation.Check(`check_expected_booked_to_booked`, `rows lost between sc table and the final views`, expectedBookedCheckpoint, bookedCheckpoint, booking.option.reconciliationTolerance),
+		sellerPayableCheckpoint,
+		reconciliation.Check(`check_expected_booked_to_ngs_seller_payable`, `rows lost between sc table and the seller payable lines of ngsTemplateIpcIptC.csv`, expectedBookedCheckpoint, sellerPayableCheckpoint, booking.option.reconciliationTolerance))
+	reconciliationTable = append(reconciliationTable,
+		reconciliation.TransactionTypeCheck(`check_booked_to_ngs_seller_payable`, `rows lost between the final views and the seller payable lines of ngsTemplateIpcIptC.csv`, `booked`, `ngs_seller_payable`, bookedTable, sellerPayableTable, booking.option.reconciliationTolerance)...)
+	reconciliationTable = append(reconciliationTable,
+		expectedNgsCheckpoint,
+		ngsCheckpoint,
+		reconciliation.Check(`check_expected_ngs_template_seller_payable_to_ngs_template_seller_payable`, `lines lost while writing ngsTemplateIpcIptC.csv`, expectedNgsCheckpoint, ngsCheckpoint, booking.option.reconciliationTolerance))
+	reconciliationFileName := booking.run.FileName(`FinanceBookingReconciliation.csv`)
+	err = reconciliation.IfUnexplainedDifference(reconciliationTable, reconciliationFileName)
+	if err != nil {
+		return err
+	}
+	log.Println(`IfUnexplainedDifference`)
+
+	booking.state.NgsTemplateFileName = ngsTemplateFileName
+	booking.state.ReconciliationFileName = reconciliationFileName
+	return nil
+}
@@ -9,9 +9,12 @@ import (
 	"github.com/gocarina/gocsv"
 	"github.com/thomas-bamilo/financebooking/csvinteract"
 	"github.com/thomas-bamilo/financebooking/dbinteract/baainteract"
+	"github.com/thomas-bamilo/financebooking/row/accountrow"
 	"github.com/thomas-bamilo/financebooking/row/beneficiarycoderow"
+	"github.com/thomas-bamilo/financebooking/row/chartofaccountrow"
 	"github.com/thomas-bamilo/financebooking/row/ledgermaprow"
 	"github.com/thomas-bamilo/financebooking/row/retailshortcoderow"
+	"github.com/thomas-bamilo/financebooking/row/vatraterow"
 	"github.com/thomas-bamilo/sql/connectdb"
 
 	survey "gopkg.in/AlecAivazis/survey.v1"
@@ -33,7 +36,7 @@ var qs = []*survey.Question{
 		Prompt: &survey.Select{
 			Message: "Choose the file to upload:",
 			Help:    "The file should be a CSV with the exact same name in the same folder as the .exe file",
-			Options: []string{"benef_code_map.csv", "retail_supplier.csv", "ledger_map.csv"},
+			Options: []string{"benef_code_map.csv", "retail_supplier.csv", "ledger_map.csv", "vat_rate.csv", "chart_of_account.csv", "account.csv"},
 			Default: "benef_code_map.csv",
 		},
 	},
@@ -64,6 +67,15 @@ func main() {
 	if answers.Username == `shirin` && answers.Password == `gofinance` {
 		fmt.Println("The file should be a CSV in the same folder as the .exe file with the exact name:", answers.File)
 		fmt.Println("Please wait...")
+		// apply the migrations of BAA database required by the uploads before any upload
+		dbBaa := connectdb.ConnectToBaa()
+		err = baainteract.Migrate(dbBaa)
+		dbBaa.Close()
+		if err != nil {
+			fmt.Printf("FAILURE! %v\n", err)
+			time.Sleep(30 * time.Second)
+			return
+		}
 		switch answers.File {
 		case "benef_code_map.csv":
 			beneficiaryCodeTableP := []*beneficiarycoderow.BeneficiaryCodeRow{}
@@ -91,7 +103,12 @@ func main() {
 			} else {
 				dbBaa := connectdb.ConnectToBaa()
 				defer dbBaa.Close()
-				baainteract.LoadValidBeneficiaryCodeToBaa(dbBaa, beneficiaryCodeTableValidRow)
+				err = baainteract.LoadValidBeneficiaryCodeToBaa(dbBaa, beneficiaryCodeTableValidRow)
+				if err != nil {
+					fmt.Printf("FAILURE! %v\n", err)
+					time.Sleep(30 * time.Second)
+					return
+				}
 				fmt.Println("SUCCESS: upload of benef_code_map.csv successful!")
 				time.Sleep(30 * time.Second)
 
@@ -123,43 +140,175 @@ func main() {
 			} else {
 				dbBaa := connectdb.ConnectToBaa()
 				defer dbBaa.Close()
-				baainteract.LoadValidRetailShortCodeToBaa(dbBaa, retailShortCodeTableValidRow)
+				err = baainteract.LoadValidRetailShortCodeToBaa(dbBaa, retailShortCodeTableValidRow)
+				if err != nil {
+					fmt.Printf("FAILURE! %v\n", err)
+					time.Sleep(30 * time.Second)
+					return
+				}
 				fmt.Println("SUCCESS: upload of retail_supplier.csv successful!")
 				time.Sleep(30 * time.Second)
 			}
 		case "ledger_map.csv":
-			var ledgerMapTableP []*ledgermaprow.LedgerMapRow
-			ledgerMapTable := csvinteract.ReadLedgerMapCSV(ledgerMapTableP)
+			// ledger_map.csv filled in from the ledger_map template can use the suggested ledger and subledger of the rows with an empty ledger
+			acceptSuggestion := false
+			err = survey.AskOne(&survey.Confirm{
+				Message: "Use suggested_ledger and suggested_subledger for the rows with an empty ledger?",
+				Help:    "Only for ledger_map.csv filled in from the ledger_map template written by the booking",
+			}, &acceptSuggestion, nil)
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			var ledgerMapTable []ledgermaprow.LedgerMapRow
+			if acceptSuggestion {
+				var ledgerMapTemplateTableP []*ledgermaprow.LedgerMapTemplateRow
+				ledgerMapTable = ledgermaprow.AcceptSuggestion(csvinteract.ReadLedgerMapTemplateCSV(ledgerMapTemplateTableP))
+			} else {
+				var ledgerMapTableP []*ledgermaprow.LedgerMapRow
+				ledgerMapTable = csvinteract.ReadLedgerMapCSV(ledgerMapTableP)
+			}
 			ledgerMapTableValidRow, ledgerMapTableInvalidRow := ledgermaprow.FilterLedgerMapTable(ledgerMapTable)
 
 			if len(ledgerMapTableInvalidRow) > 0 {
-				var csvErrorLogP []*ledgermaprow.LedgerMapRow
-				for i := 0; i < len(ledgerMapTableInvalidRow); i++ {
+				writeLedgerMapErrorLog(ledgerMapTableInvalidRow)
+				fmt.Println("FAILURE: format of ledgerMap is wrong, please see LedgerMapErrorLog.csv for more details")
+				time.Sleep(30 * time.Second)
+
+			} else {
+				dbBaa := connectdb.ConnectToBaa()
+				defer dbBaa.Close()
+				// uploaded rows replace the rows of ledger_map table of BAA database with the same dimensions and priority
+				// and should not match the same transactions as the other rows with the same specificity and priority
+				baaLedgerMapTable, err := baainteract.GetLedgerMap(dbBaa)
+				if err != nil {
+					fmt.Printf("FAILURE! %v\n", err)
+					time.Sleep(30 * time.Second)
+					return
+				}
+				_, ledgerMapTableConflictRow := ledgermaprow.FilterLedgerMapTable(ledgermaprow.Upsert(baaLedgerMapTable, ledgerMapTableValidRow))
+				if len(ledgerMapTableConflictRow) > 0 {
+					writeLedgerMapErrorLog(ledgerMapTableConflictRow)
+					fmt.Println("FAILURE: ledgerMap conflicts with ledger_map of BAA database, please see LedgerMapErrorLog.csv for more details")
+					time.Sleep(30 * time.Second)
+					return
+				}
+				err = baainteract.LoadValidLedgerMapToBaa(dbBaa, ledgerMapTableValidRow)
+				if err != nil {
+					fmt.Printf("FAILURE! %v\n", err)
+					time.Sleep(30 * time.Second)
+					return
+				}
+				fmt.Println("SUCCESS: upload of ledger_map.csv successful!")
+				time.Sleep(30 * time.Second)
+			}
+		case "vat_rate.csv":
+			var vatRateTableP []*vatraterow.VatRateRow
+			vatRateTable := csvinteract.ReadVatRateCSV(vatRateTableP)
+			vatRateTableValidRow, vatRateTableInvalidRow := vatraterow.FilterVatRateTable(vatRateTable)
+
+			if len(vatRateTableInvalidRow) > 0 {
+				var csvErrorLogP []*vatraterow.VatRateRow
+				for i := 0; i < len(vatRateTableInvalidRow); i++ {
 					csvErrorLogP = append(csvErrorLogP,
-						&ledgermaprow.LedgerMapRow{
-							Err:                  ledgerMapTableInvalidRow[i].Err,
-							TransactionType:      ledgerMapTableInvalidRow[i].TransactionType,
-							ItemStatus:           ledgerMapTableInvalidRow[i].ItemStatus,
-							PaymentMethod:        ledgerMapTableInvalidRow[i].PaymentMethod,
-							ShipmentProviderName: ledgerMapTableInvalidRow[i].ShipmentProviderName,
-							Ledger:               ledgerMapTableInvalidRow[i].Ledger,
-							Subledger:            ledgerMapTableInvalidRow[i].Subledger,
+						&vatraterow.VatRateRow{
+							Err:       vatRateTableInvalidRow[i].Err,
+							ValidFrom: vatRateTableInvalidRow[i].ValidFrom,
+							ValidTo:   vatRateTableInvalidRow[i].ValidTo,
+							VatRate:   vatRateTableInvalidRow[i].VatRate,
 						})
 				}
 				// to write csvErrorLog to csv
-				file, err := os.OpenFile("LedgerMapErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+				file, err := os.OpenFile("VatRateErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
 				checkError(err)
 				defer file.Close()
 				// save csvErrorLog to csv
 				err = gocsv.MarshalFile(&csvErrorLogP, file)
-				fmt.Println("FAILURE: format of ledgerMap is wrong, please see LedgerMapErrorLog.csv for more details")
+				fmt.Println("FAILURE: format of vatRate is wrong, please see VatRateErrorLog.csv for more details")
 				time.Sleep(30 * time.Second)
 
 			} else {
 				dbBaa := connectdb.ConnectToBaa()
 				defer dbBaa.Close()
-				baainteract.LoadValidLedgerMapToBaa(dbBaa, ledgerMapTableValidRow)
-				fmt.Println("SUCCESS: upload of ledger_map.csv successful!")
+				err = baainteract.LoadValidVatRateToBaa(dbBaa, vatRateTableValidRow)
+				if err != nil {
+					fmt.Printf("FAILURE! %v\n", err)
+					time.Sleep(30 * time.Second)
+					return
+				}
+				fmt.Println("SUCCESS: upload of vat_rate.csv successful!")
+				time.Sleep(30 * time.Second)
+			}
+		case "chart_of_account.csv":
+			var chartOfAccountTableP []*chartofaccountrow.ChartOfAccountRow
+			chartOfAccountTable := csvinteract.ReadChartOfAccountCSV(chartOfAccountTableP)
+			chartOfAccountTableValidRow, chartOfAccountTableInvalidRow := chartofaccountrow.FilterChartOfAccountTable(chartOfAccountTable)
+
+			if len(chartOfAccountTableInvalidRow) > 0 {
+				var csvErrorLogP []*chartofaccountrow.ChartOfAccountRow
+				for i := 0; i < len(chartOfAccountTableInvalidRow); i++ {
+					csvErrorLogP = append(csvErrorLogP,
+						&chartofaccountrow.ChartOfAccountRow{
+							Err:         chartOfAccountTableInvalidRow[i].Err,
+							AccountRole: chartOfAccountTableInvalidRow[i].AccountRole,
+							AccountCode: chartOfAccountTableInvalidRow[i].AccountCode,
+						})
+				}
+				// to write csvErrorLog to csv
+				file, err := os.OpenFile("ChartOfAccountErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+				checkError(err)
+				defer file.Close()
+				// save csvErrorLog to csv
+				err = gocsv.MarshalFile(&csvErrorLogP, file)
+				fmt.Println("FAILURE: format of chartOfAccount is wrong, please see ChartOfAccountErrorLog.csv for more details")
+				time.Sleep(30 * time.Second)
+
+			} else {
+				dbBaa := connectdb.ConnectToBaa()
+				defer dbBaa.Close()
+				err = baainteract.LoadValidChartOfAccountToBaa(dbBaa, chartOfAccountTableValidRow)
+				if err != nil {
+					fmt.Printf("FAILURE! %v\n", err)
+					time.Sleep(30 * time.Second)
+					return
+				}
+				fmt.Println("SUCCESS: upload of chart_of_account.csv successful!")
+				time.Sleep(30 * time.Second)
+			}
+		case "account.csv":
+			var accountTableP []*accountrow.AccountRow
+			accountTable := csvinteract.ReadAccountCSV(accountTableP)
+			accountTableValidRow, accountTableInvalidRow := accountrow.FilterAccountTable(accountTable)
+
+			if len(accountTableInvalidRow) > 0 {
+				var csvErrorLogP []*accountrow.AccountRow
+				for i := 0; i < len(accountTableInvalidRow); i++ {
+					csvErrorLogP = append(csvErrorLogP,
+						&accountrow.AccountRow{
+							Err:         accountTableInvalidRow[i].Err,
+							AccountCode: accountTableInvalidRow[i].AccountCode,
+							AccountName: accountTableInvalidRow[i].AccountName,
+						})
+				}
+				// to write csvErrorLog to csv
+				file, err := os.OpenFile("AccountErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+				checkError(err)
+				defer file.Close()
+				// save csvErrorLog to csv
+				err = gocsv.MarshalFile(&csvErrorLogP, file)
+				fmt.Println("FAILURE: format of account is wrong, please see AccountErrorLog.csv for more details")
+				time.Sleep(30 * time.Second)
+
+			} else {
+				dbBaa := connectdb.ConnectToBaa()
+				defer dbBaa.Close()
+				err = baainteract.LoadValidAccountToBaa(dbBaa, accountTableValidRow)
+				if err != nil {
+					fmt.Printf("FAILURE! %v\n", err)
+					time.Sleep(30 * time.Second)
+					return
+				}
+				fmt.Println("SUCCESS: upload of account.csv successful!")
 				time.Sleep(30 * time.Second)
 			}
 		}
@@ -171,6 +320,31 @@ func main() {
 
 }
 
+// writeLedgerMapErrorLog writes ledgerMapTableInvalidRow to LedgerMapErrorLog.csv
+func writeLedgerMapErrorLog(ledgerMapTableInvalidRow []ledgermaprow.LedgerMapRow) {
+	var csvErrorLogP []*ledgermaprow.LedgerMapRow
+	for i := 0; i < len(ledgerMapTableInvalidRow); i++ {
+		csvErrorLogP = append(csvErrorLogP,
+			&ledgermaprow.LedgerMapRow{
+				Err:                  ledgerMapTableInvalidRow[i].Err,
+				TransactionType:      ledgerMapTableInvalidRow[i].TransactionType,
+				ItemStatus:           ledgerMapTableInvalidRow[i].ItemStatus,
+				PaymentMethod:        ledgerMapTableInvalidRow[i].PaymentMethod,
+				ShipmentProviderName: ledgerMapTableInvalidRow[i].ShipmentProviderName,
+				Ledger:               ledgerMapTableInvalidRow[i].Ledger,
+				Subledger:            ledgerMapTableInvalidRow[i].Subledger,
+				Priority:             ledgerMapTableInvalidRow[i].Priority,
+			})
+	}
+	// to write csvErrorLog to csv
+	file, err := os.OpenFile("LedgerMapErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
+	checkError(err)
+	defer file.Close()
+	// save csvErrorLog to csv
+	err = gocsv.MarshalFile(&csvErrorLogP, file)
+	checkError(err)
+}
+
 func checkError(err error) {
 	if err != nil {
 		log.Fatal(err.Error())
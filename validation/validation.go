@@ -1,79 +1,155 @@
 package validation
 
 import (
-	"errors"
+	"fmt"
 	"log"
 	"os"
-	"time"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/gocarina/gocsv"
-	"github.com/thomas-bamilo/email/goemail"
+	"github.com/thomas-bamilo/financebooking/errorreport"
+	"github.com/thomas-bamilo/financebooking/row/beneficiarycoderow"
+	"github.com/thomas-bamilo/financebooking/row/chartofaccountrow"
+	"github.com/thomas-bamilo/financebooking/row/errorreportrow"
+	"github.com/thomas-bamilo/financebooking/row/ledgermaprow"
+	"github.com/thomas-bamilo/financebooking/row/quarantinerow"
 	"github.com/thomas-bamilo/financebooking/row/scomsrow"
+	"github.com/thomas-bamilo/financebooking/row/transactiontyperow"
+	"github.com/thomas-bamilo/financebooking/row/vatraterow"
 )
 
-// LedgerMapKey -------------------------------------------------------------------------
+// LedgerMap -------------------------------------------------------------------------
 
-func MissingLedgerMapKey(ledgerMapKeyTable, scOmsTable []scomsrow.ScOmsRow) (missingLedgerMapKeyTable []scomsrow.ScOmsRow) {
+// IfInvalidLedgerMap STOPs the booking process if any row of ledger_map table of BAA database is invalid,
+// e.g. two rows matching the same transactions with the same specificity and priority
+func IfInvalidLedgerMap(report *errorreport.Report, ledgerMapTableInvalidRow []ledgermaprow.LedgerMapRow) error {
+	if len(ledgerMapTableInvalidRow) > 0 {
+		for _, row := range ledgerMapTableInvalidRow {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category:  errorreport.InvalidLedgerMap,
+				Severity:  errorreport.Error,
+				Stage:     errorreport.MasterDataValidation,
+				SourceKey: ledgerMapSourceKey(row.TransactionType, row.ItemStatus, row.PaymentMethod, row.ShipmentProviderName),
+				Message:   row.Err + ` (ledger ` + row.Ledger + `, subledger ` + row.Subledger + `, priority ` + row.Priority + `)`,
+			})
+		}
+		return report.Stop("invalid ledger_map, please see FinanceBookingErrorLog.csv for more details")
+	}
+	return nil
+}
+
+// QuarantineMissingLedgerMap splits scOmsTable into the rows matching a row of ledgerMapTable
+// and the rows matching no row of ledgerMapTable, which are quarantined instead of booked
+func QuarantineMissingLedgerMap(ledgerMapTable []ledgermaprow.LedgerMapRow, scOmsTable []scomsrow.ScOmsRow) (scOmsTableWithLedgerMap, scOmsTableMissingLedgerMap []scomsrow.ScOmsRow) {
+	for _, scOmsRow := range scOmsTable {
+		if _, ok := ledgermaprow.Match(ledgerMapTable, scOmsRow.TransactionType, scOmsRow.ItemStatus, scOmsRow.PaymentMethod, scOmsRow.ShipmentProviderName); ok {
+			scOmsTableWithLedgerMap = append(scOmsTableWithLedgerMap, scOmsRow)
+		} else {
+			scOmsTableMissingLedgerMap = append(scOmsTableMissingLedgerMap, scOmsRow)
+		}
+	}
+	return scOmsTableWithLedgerMap, scOmsTableMissingLedgerMap
+}
 
-	// initialize ledgerMapKeyMap with ledgerMapKeyTable
-	ledgerMapKeyMap := make(map[string]bool)
-	for _, ledgerMapKeyRow := range ledgerMapKeyTable {
-		ledgerMapKeyMap[ledgerMapKeyRow.LedgerMapKey] = true
+// QuarantineOrder splits scOmsTable into the rows of an order with no row in quarantinedTable
+// and the rows of an order with any row in quarantinedTable, so that an order is either booked or quarantined as a whole
+func QuarantineOrder(quarantinedTable, scOmsTable []scomsrow.ScOmsRow) (scOmsTableNotQuarantined, scOmsTableQuarantined []scomsrow.ScOmsRow) {
+
+	// initialize quarantinedOrderMap with the OrderNr of quarantinedTable
+	quarantinedOrderMap := make(map[string]bool)
+	for _, quarantinedRow := range quarantinedTable {
+		quarantinedOrderMap[quarantinedRow.OrderNr] = true
 	}
 
-	// for each scOmsRow in scOmsTable
-	// if scOmsRow.LedgerMapKey is in ledgerMapKeyMap
-	// then do nothing
-	// else add scOmsRow to missingLedgerMapKeyTable
-	// AND add scOmsRow.LedgerMapKey to ledgerMapKeyMap (not to return several times the same ledgerMapKey)
 	for _, scOmsRow := range scOmsTable {
-		if _, ok := ledgerMapKeyMap[scOmsRow.LedgerMapKey]; !ok {
-			missingLedgerMapKeyTable = append(missingLedgerMapKeyTable, scOmsRow)
-			ledgerMapKeyMap[scOmsRow.LedgerMapKey] = true
+		if quarantinedOrderMap[scOmsRow.OrderNr] {
+			scOmsTableQuarantined = append(scOmsTableQuarantined, scOmsRow)
+		} else {
+			scOmsTableNotQuarantined = append(scOmsTableNotQuarantined, scOmsRow)
 		}
+	}
+	return scOmsTableNotQuarantined, scOmsTableQuarantined
+}
+
+// IfMissingLedgerMap outputs templateFileName pre-filled with the missing ledger_map of scOmsTableMissingLedgerMap
+// and the ledger and subledger suggested from ledgerMapTable, see ledgerMapTemplate, and adds the missing ledger_map to report
+// and STOPs the booking process if stopOnMissingLedgerMap, otherwise the rows with missing ledger_map are quarantined
+func IfMissingLedgerMap(report *errorreport.Report, ledgerMapTable []ledgermaprow.LedgerMapRow, scOmsTableMissingLedgerMap []scomsrow.ScOmsRow, templateFileName string, stopOnMissingLedgerMap bool) error {
 
+	if len(scOmsTableMissingLedgerMap) > 0 {
+		csvTemplateP := ledgerMapTemplate(ledgerMapTable, scOmsTableMissingLedgerMap)
+		// templateFileName can be uploaded with userinteract as ledger_map.csv once Finance fills in the ledger or accepts the suggested ledger
+		err := writeCSV(templateFileName, &csvTemplateP)
+		if err != nil {
+			return err
+		}
+		report.Attach(errorreport.MissingLedgerMap, templateFileName)
+		for _, templateRow := range csvTemplateP {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category:         errorreport.MissingLedgerMap,
+				Severity:         severity(stopOnMissingLedgerMap),
+				Stage:            errorreport.MasterDataValidation,
+				SourceKey:        ledgerMapSourceKey(templateRow.TransactionType, templateRow.ItemStatus, templateRow.PaymentMethod, templateRow.ShipmentProviderName),
+				RowCount:         templateRow.RowCount,
+				TransactionValue: templateRow.TransactionValue,
+				Message: `no ledger_map matches, please fill in ` + templateFileName + `; suggested ledger ` + templateRow.SuggestedLedger +
+					`, subledger ` + templateRow.SuggestedSubledger + `: ` + templateRow.SuggestionReason,
+			})
+		}
+		if stopOnMissingLedgerMap {
+			return report.Stop("missing ledger_map, please fill in " + templateFileName + " or see FinanceBookingErrorLog.csv for more details")
+		}
+		log.Println("WARNING: missing ledger_map, the rows are quarantined, please fill in " + templateFileName + " or see FinanceBookingErrorLog.csv")
 	}
-	return missingLedgerMapKeyTable
+	return nil
+}
 
+// ledgerMapSourceKey identifies a ledger_map by its dimensions in report
+func ledgerMapSourceKey(transactionType, itemStatus, paymentMethod, shipmentProviderName string) string {
+	return strings.Join([]string{transactionType, itemStatus, paymentMethod, shipmentProviderName}, ` - `)
 }
 
-// IfMissingLedgerMap STOPs the booking process if any missing ledger_map (we can make it less blocking in the future)
-func IfMissingLedgerMap(missingLedgerMapKeyTable []scomsrow.ScOmsRow) {
+// ledgerMapTemplate groups scOmsTableMissingLedgerMap by transaction_type, item_status, payment_method and shipment_provider_name
+// into the rows of the ledger_map template to fill in, with their row count and value at stake, the most value at stake first,
+// and the ledger and subledger suggested from the closest rows of ledgerMapTable, see ledgermaprow.Suggest
+func ledgerMapTemplate(ledgerMapTable []ledgermaprow.LedgerMapRow, scOmsTableMissingLedgerMap []scomsrow.ScOmsRow) (csvTemplateP []*ledgermaprow.LedgerMapTemplateRow) {
 
-	if len(missingLedgerMapKeyTable) > 0 {
-		var csvErrorLogP []*scomsrow.ScOmsRow
-		for i := 0; i < len(missingLedgerMapKeyTable); i++ {
-			csvErrorLogP = append(csvErrorLogP,
-				&scomsrow.ScOmsRow{
-					TransactionType:      missingLedgerMapKeyTable[i].TransactionType,
-					ItemStatus:           missingLedgerMapKeyTable[i].ItemStatus,
-					PaymentMethod:        missingLedgerMapKeyTable[i].PaymentMethod,
-					ShipmentProviderName: missingLedgerMapKeyTable[i].ShipmentProviderName,
-					Ledger:               0,
-					Subledger:            0,
+	templateRowIndex := make(map[[4]string]int)
+	for _, scOmsRow := range scOmsTableMissingLedgerMap {
+		dimension := [4]string{scOmsRow.TransactionType, scOmsRow.ItemStatus, scOmsRow.PaymentMethod, scOmsRow.ShipmentProviderName}
+		i, ok := templateRowIndex[dimension]
+		if !ok {
+			i = len(csvTemplateP)
+			templateRowIndex[dimension] = i
+			suggestion, suggestionReason := ledgermaprow.Suggest(ledgerMapTable, scOmsRow.TransactionType, scOmsRow.ItemStatus, scOmsRow.PaymentMethod, scOmsRow.ShipmentProviderName)
+			csvTemplateP = append(csvTemplateP,
+				&ledgermaprow.LedgerMapTemplateRow{
+					TransactionType:      scOmsRow.TransactionType,
+					ItemStatus:           scOmsRow.ItemStatus,
+					PaymentMethod:        scOmsRow.PaymentMethod,
+					ShipmentProviderName: scOmsRow.ShipmentProviderName,
+					SuggestedLedger:      suggestion.Ledger,
+					SuggestedSubledger:   suggestion.Subledger,
+					SuggestionReason:     suggestionReason,
 				})
 		}
-		// to write csvErrorLog to csv
-		file, err := os.OpenFile("FinanceBookingErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
-		checkError(err)
-		defer file.Close()
-		// save csvErrorLog to csv
-		err = gocsv.MarshalFile(&csvErrorLogP, file)
-		checkError(err)
-		time.Sleep(5 * time.Second)
-		// send an email with FinanceBookingErrorLog.csv in attachment
-		goemail.GoEmail()
-		// creating an error and calling checkError() effectively stops the booking process
-		err = errors.New("FAILURE: missing ledger_map, please see FinanceBookingErrorLog.csv for more details")
-		checkError(err)
+		csvTemplateP[i].RowCount++
+		csvTemplateP[i].TransactionValue += scOmsRow.TransactionValue
 	}
+
+	sort.SliceStable(csvTemplateP, func(i, j int) bool {
+		return csvTemplateP[i].TransactionValue.Abs() > csvTemplateP[j].TransactionValue.Abs()
+	})
+	return csvTemplateP
 }
 
 // BeneficiaryCode ---------------------------------------------------------------------------------------------------------------------------------------------------
 
-// MissingBeneficiaryCode filters out ShortCode found in beneficiary_code_map table of BAA database from sellerCenterTable and outputs missingBeneficiaryCodeTable.
-// missingBeneficiaryCodeTable should be empty - otherwise, beneficiary_code_map needs to be updated
-func MissingBeneficiaryCode(beneficiaryCodeTable, sellerCenterTable []scomsrow.ScOmsRow) (missingBeneficiaryCodeTable []scomsrow.ScOmsRow) {
+// QuarantineMissingBeneficiaryCode splits sellerCenterTable into the rows with a ShortCode found in beneficiaryCodeTable
+// and the rows without, which are quarantined instead of booked
+func QuarantineMissingBeneficiaryCode(beneficiaryCodeTable, sellerCenterTable []scomsrow.ScOmsRow) (sellerCenterTableWithBeneficiaryCode, sellerCenterTableMissingBeneficiaryCode []scomsrow.ScOmsRow) {
 
 	// initialize beneficiaryCodeMap with beneficiaryCodeTable
 	beneficiaryCodeMap := make(map[string]bool)
@@ -81,42 +157,255 @@ func MissingBeneficiaryCode(beneficiaryCodeTable, sellerCenterTable []scomsrow.S
 		beneficiaryCodeMap[beneficiaryCodeRow.ShortCode] = true
 	}
 
-	// check if any BeneficiaryCode from sellerCenterTable is not in beneficiaryCodeMap - if not, add the BeneficiaryCode to missingBeneficiaryCodeTable
-	for _, beneficiaryCodeRow := range sellerCenterTable {
-		if _, ok := beneficiaryCodeMap[beneficiaryCodeRow.ShortCode]; !ok {
-			missingBeneficiaryCodeTable = append(missingBeneficiaryCodeTable, beneficiaryCodeRow)
+	for _, sellerCenterRow := range sellerCenterTable {
+		if beneficiaryCodeMap[sellerCenterRow.ShortCode] {
+			sellerCenterTableWithBeneficiaryCode = append(sellerCenterTableWithBeneficiaryCode, sellerCenterRow)
+		} else {
+			sellerCenterTableMissingBeneficiaryCode = append(sellerCenterTableMissingBeneficiaryCode, sellerCenterRow)
 		}
-
 	}
-	return missingBeneficiaryCodeTable
+	return sellerCenterTableWithBeneficiaryCode, sellerCenterTableMissingBeneficiaryCode
+}
 
+// IfMissingBeneficiaryCode outputs templateFileName pre-filled with the missing short_code of sellerCenterTableMissingBeneficiaryCode, see beneficiaryCodeTemplate,
+// and adds the missing short_code to report
+// and STOPs the booking process if stopOnMissingBeneficiaryCode, otherwise the rows with missing short_code are quarantined
+func IfMissingBeneficiaryCode(report *errorreport.Report, sellerCenterTableMissingBeneficiaryCode []scomsrow.ScOmsRow, templateFileName string, stopOnMissingBeneficiaryCode bool) error {
+	if len(sellerCenterTableMissingBeneficiaryCode) > 0 {
+		csvTemplateP := beneficiaryCodeTemplate(sellerCenterTableMissingBeneficiaryCode)
+		// templateFileName can be uploaded with userinteract as benef_code_map.csv once Finance fills in the beneficiary_code
+		err := writeCSV(templateFileName, &csvTemplateP)
+		if err != nil {
+			return err
+		}
+		report.Attach(errorreport.MissingBeneficiaryCode, templateFileName)
+		for _, templateRow := range csvTemplateP {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category:         errorreport.MissingBeneficiaryCode,
+				Severity:         severity(stopOnMissingBeneficiaryCode),
+				Stage:            errorreport.MasterDataValidation,
+				ShortCode:        templateRow.ShortCode,
+				SourceKey:        templateRow.SupplierName,
+				RowCount:         templateRow.RowCount,
+				TransactionValue: templateRow.TransactionValue,
+				Message:          `short_code without beneficiary_code, please fill in ` + templateFileName,
+			})
+		}
+		if stopOnMissingBeneficiaryCode {
+			return report.Stop("missing beneficiary_code, please fill in " + templateFileName + " or see FinanceBookingErrorLog.csv for more details")
+		}
+		log.Println("WARNING: missing beneficiary_code, the rows are quarantined, please fill in " + templateFileName + " or see FinanceBookingErrorLog.csv")
+	}
+	return nil
 }
 
-// IfMissingBeneficiaryCode STOPs the booking process if any missing short_code (we can make it less blocking in the future)
-func IfMissingBeneficiaryCode(missingBeneficiaryCodeTable []scomsrow.ScOmsRow) {
-	if len(missingBeneficiaryCodeTable) > 0 {
-		var csvErrorLogP []*scomsrow.ScOmsRow
-		for i := 0; i < len(missingBeneficiaryCodeTable); i++ {
-			csvErrorLogP = append(csvErrorLogP,
-				&scomsrow.ScOmsRow{
-					ShortCode: missingBeneficiaryCodeTable[i].ShortCode,
+// beneficiaryCodeTemplate groups sellerCenterTableMissingBeneficiaryCode by short_code
+// into the rows of the beneficiary_code template to fill in, with their supplier, row count and value at stake, the most value at stake first
+func beneficiaryCodeTemplate(sellerCenterTableMissingBeneficiaryCode []scomsrow.ScOmsRow) (csvTemplateP []*beneficiarycoderow.BeneficiaryCodeTemplateRow) {
+
+	templateRowIndex := make(map[string]int)
+	for _, scOmsRow := range sellerCenterTableMissingBeneficiaryCode {
+		i, ok := templateRowIndex[scOmsRow.ShortCode]
+		if !ok {
+			i = len(csvTemplateP)
+			templateRowIndex[scOmsRow.ShortCode] = i
+			csvTemplateP = append(csvTemplateP,
+				&beneficiarycoderow.BeneficiaryCodeTemplateRow{
+					ShortCode:    scOmsRow.ShortCode,
+					SupplierName: scOmsRow.SupplierName,
+					IDSupplier:   scOmsRow.IDSupplier,
 				})
+		}
+		csvTemplateP[i].RowCount++
+		csvTemplateP[i].TransactionValue += scOmsRow.TransactionValue
+	}
+
+	sort.SliceStable(csvTemplateP, func(i, j int) bool {
+		return csvTemplateP[i].TransactionValue.Abs() > csvTemplateP[j].TransactionValue.Abs()
+	})
+	return csvTemplateP
+}
+
+// FilterQuarantine keeps the rows of sellerCenterTable quarantined in quarantineTable by a previous run
+// to book them in a follow-up run once the master data is fixed
+func FilterQuarantine(quarantineTable []quarantinerow.QuarantineRow, sellerCenterTable []scomsrow.ScOmsRow) (sellerCenterTableQuarantined []scomsrow.ScOmsRow) {
+
+	// initialize quarantineMap with the IDTransaction of quarantineTable
+	quarantineMap := make(map[int]bool)
+	for _, quarantineRow := range quarantineTable {
+		quarantineMap[quarantineRow.IDTransaction] = true
+	}
+
+	for _, sellerCenterRow := range sellerCenterTable {
+		if quarantineMap[sellerCenterRow.IDTransaction] {
+			sellerCenterTableQuarantined = append(sellerCenterTableQuarantined, sellerCenterRow)
+		}
+	}
+	return sellerCenterTableQuarantined
+}
+
+// TransactionType ---------------------------------------------------------------------------------------------------------------------------------------------------
 
+// IfUnmappedTransactionType adds the rows of unmappedTransactionTypeTable to report
+// and STOPs the booking process if stopOnUnmappedTransactionType
+func IfUnmappedTransactionType(report *errorreport.Report, unmappedTransactionTypeTable []transactiontyperow.TransactionTypeRow, stopOnUnmappedTransactionType bool) error {
+	if len(unmappedTransactionTypeTable) > 0 {
+		for _, row := range unmappedTransactionTypeTable {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category:         errorreport.UnmappedTransactionType,
+				Severity:         severity(stopOnUnmappedTransactionType),
+				Stage:            errorreport.SQLiteValidation,
+				SourceKey:        strconv.Itoa(row.IDTransactionType) + ` - ` + row.TransactionType,
+				RowCount:         row.RowCount,
+				TransactionValue: row.TransactionValue,
+				Message:          `id_transaction_type not mapped in arrayOfTransactionType: rows are not booked`,
+			})
 		}
-		// to write csvErrorLog to csv
-		file, err := os.OpenFile("FinanceBookingErrorLog.csv", os.O_RDWR|os.O_CREATE, os.ModePerm)
-		checkError(err)
-		defer file.Close()
-		// save csvErrorLog to csv
-		err = gocsv.MarshalFile(&csvErrorLogP, file)
-		checkError(err)
-		time.Sleep(5 * time.Second)
-		// send an email with FinanceBookingErrorLog.csv in attachment
-		goemail.GoEmail()
-		// creating an error and calling checkError() effectively stops the booking process
-		err = errors.New("FAILURE: missing beneficiary_code, please see FinanceBookingErrorLog.csv for more details")
-		checkError(err)
+		log.Println("WARNING: sc table had some unmapped transaction types, please see FinanceBookingErrorLog.csv")
+		if stopOnUnmappedTransactionType {
+			return report.Stop("unmapped transaction types, please see FinanceBookingErrorLog.csv for more details")
+		}
+	}
+	return nil
+}
+
+// VatRate ---------------------------------------------------------------------------------------------------------------------------------------------------
+
+// IfInvalidVatRate STOPs the booking process if any invalid VAT rate or any date of the booking period without VAT rate
+// since commission and cancellation penalty revenue and VAT could not be booked
+func IfInvalidVatRate(report *errorreport.Report, vatRateTableInvalidRow []vatraterow.VatRateRow) error {
+	if len(vatRateTableInvalidRow) > 0 {
+		for _, row := range vatRateTableInvalidRow {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category:  errorreport.InvalidVatRate,
+				Severity:  errorreport.Error,
+				Stage:     errorreport.MasterDataValidation,
+				SourceKey: row.ValidFrom + ` - ` + row.ValidTo,
+				Message:   row.Err + ` (vat_rate ` + row.VatRate + `)`,
+			})
+		}
+		return report.Stop("invalid or missing vat_rate, please see FinanceBookingErrorLog.csv for more details")
+	}
+	return nil
+}
+
+// ChartOfAccount ---------------------------------------------------------------------------------------------------------------------------------------------------
+
+// IfInvalidChartOfAccount STOPs the booking process if any invalid row in chart_of_account table of BAA database
+// since the NGS template could be booked on the wrong Account Codes
+func IfInvalidChartOfAccount(report *errorreport.Report, chartOfAccountTableInvalidRow []chartofaccountrow.ChartOfAccountRow) error {
+	if len(chartOfAccountTableInvalidRow) > 0 {
+		for _, row := range chartOfAccountTableInvalidRow {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category:  errorreport.InvalidChartOfAccount,
+				Severity:  errorreport.Error,
+				Stage:     errorreport.MasterDataValidation,
+				SourceKey: row.AccountRole,
+				Message:   row.Err + ` (account_code ` + row.AccountCode + `)`,
+			})
+		}
+		return report.Stop("invalid chart_of_account, please see FinanceBookingErrorLog.csv for more details")
+	}
+	return nil
+}
+
+// IfInvalidAccountCode STOPs the booking process if the chart of account misses or has an invalid Account Code
+// for a role of the posting rules, see chartofaccount.ChartOfAccount.Invalid
+func IfInvalidAccountCode(report *errorreport.Report, chartOfAccountInvalid []string) error {
+	if len(chartOfAccountInvalid) > 0 {
+		for _, invalid := range chartOfAccountInvalid {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category: errorreport.InvalidChartOfAccount,
+				Severity: errorreport.Error,
+				Stage:    errorreport.MasterDataValidation,
+				Message:  invalid,
+			})
+		}
+		return report.Stop("invalid chart of account: " + strings.Join(chartOfAccountInvalid, `; `) + ", please see FinanceBookingErrorLog.csv for more details")
+	}
+	return nil
+}
+
+// PostingRule ---------------------------------------------------------------------------------------------------------------------------------------------------
+
+// IfInvalidPostingRule STOPs the booking process if the posting rules cannot be read or compiled into SQL, see postingrule.Invalid
+func IfInvalidPostingRule(report *errorreport.Report, postingRuleInvalid []string) error {
+	if len(postingRuleInvalid) > 0 {
+		for _, invalid := range postingRuleInvalid {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category: errorreport.InvalidPostingRule,
+				Severity: errorreport.Error,
+				Stage:    errorreport.Configuration,
+				Message:  invalid,
+			})
+		}
+		return report.Stop("invalid posting rules: " + strings.Join(postingRuleInvalid, `; `) + ", please see FinanceBookingErrorLog.csv for more details")
 	}
+	return nil
+}
+
+// OMS ---------------------------------------------------------------------------------------------------------------------------------------------------
+
+// IfOmsNotFound adds to report the ids of notFoundOmsIDSalesOrderItem, among the requestedCount oms_id_sales_order_item of Seller Center data,
+// not found in OMS: the booking process goes on, their item price rows are reported as invalid item price rows
+func IfOmsNotFound(report *errorreport.Report, notFoundOmsIDSalesOrderItem []int, requestedCount int) {
+	for _, omsIDSalesOrderItem := range notFoundOmsIDSalesOrderItem {
+		report.Add(errorreportrow.ErrorReportRow{
+			Category:            errorreport.OmsNotFound,
+			Severity:            errorreport.Warning,
+			Stage:               errorreport.OmsExtraction,
+			OmsIDSalesOrderItem: omsIDSalesOrderItem,
+			RowCount:            1,
+			Message:             `oms_id_sales_order_item not found in OMS, ` + strconv.Itoa(len(notFoundOmsIDSalesOrderItem)) + ` of the ` + strconv.Itoa(requestedCount) + ` requested`,
+		})
+	}
+	if len(notFoundOmsIDSalesOrderItem) > 0 {
+		log.Printf("WARNING: %d of the %d oms_id_sales_order_item of Seller Center data not found in OMS, e.g. %d", len(notFoundOmsIDSalesOrderItem), requestedCount, notFoundOmsIDSalesOrderItem[0])
+	}
+}
+
+// SQLite ---------------------------------------------------------------------------------------------------------------------------------------------------
+
+// IfFailedSQLiteLoad STOPs the booking process if any row of the SQLite table tableName could not be inserted, see bulkload.InsertScOmsTable
+// since the transaction_value of failedRow would be missing from the NGS template
+func IfFailedSQLiteLoad(report *errorreport.Report, tableName string, failedRow []scomsrow.ScOmsRow) error {
+	if len(failedRow) > 0 {
+		for _, row := range failedRow {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category:            errorreport.FailedSQLiteLoad,
+				Severity:            errorreport.Error,
+				Stage:               errorreport.SQLiteValidation,
+				IDTransaction:       row.IDTransaction,
+				OmsIDSalesOrderItem: row.OmsIDSalesOrderItem,
+				ShortCode:           row.ShortCode,
+				SourceKey:           tableName,
+				RowCount:            1,
+				TransactionValue:    row.TransactionValue,
+				Message:             row.Err,
+			})
+		}
+		return report.Stop("rows could not be loaded into SQLite table " + tableName + ", please see FinanceBookingErrorLog.csv for more details")
+	}
+	return nil
+}
+
+// IfFailedVatRateLoad STOPs the booking process if any row of vat_rate SQLite table could not be inserted, see IfFailedSQLiteLoad,
+// since commission and cancellation penalty revenue and VAT could not be booked
+func IfFailedVatRateLoad(report *errorreport.Report, failedRow []vatraterow.VatRateRow) error {
+	if len(failedRow) > 0 {
+		for _, row := range failedRow {
+			report.Add(errorreportrow.ErrorReportRow{
+				Category:  errorreport.FailedSQLiteLoad,
+				Severity:  errorreport.Error,
+				Stage:     errorreport.SQLiteValidation,
+				SourceKey: `vat_rate ` + row.ValidFrom + ` - ` + row.ValidTo,
+				RowCount:  1,
+				Message:   row.Err + ` (vat_rate ` + row.VatRate + `)`,
+			})
+		}
+		return report.Stop("rows could not be loaded into SQLite table vat_rate, please see FinanceBookingErrorLog.csv for more details")
+	}
+	return nil
 }
 
 // FilterRetailShortCode filters out ShortCode found in retail_short_code table of BAA database from sellerCenterTable and outputs sellerCenterTableNoRetail: a table without RetailShortCode
@@ -142,8 +431,24 @@ func FilterRetailShortCode(retailShortCodeTable, sellerCenterTable []scomsrow.Sc
 
 }
 
-func checkError(err error) {
+// severity returns the severity of an issue which STOPs the booking process if stop
+func severity(stop bool) string {
+	if stop {
+		return errorreport.Error
+	}
+	return errorreport.Warning
+}
+
+// writeCSV writes csvTableP to fileName, overwriting any previous content
+func writeCSV(fileName string, csvTableP interface{}) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("write %s: %w", fileName, err)
+	}
+	defer file.Close()
+	err = gocsv.MarshalFile(csvTableP, file)
 	if err != nil {
-		log.Fatal(err.Error())
+		return fmt.Errorf("write %s: %w", fileName, err)
 	}
+	return nil
 }